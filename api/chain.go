@@ -0,0 +1,279 @@
+package api
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"minchain/core"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/httpjson"
+	"minchain/logging"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var logger = logging.Logger(logging.Api)
+
+const (
+	defaultChainLimit = 20
+	maxChainLimit     = 100
+)
+
+var (
+	ErrorInvalidHash   = errors.New("invalid hash")
+	ErrorInvalidHeight = errors.New("invalid height")
+	ErrorInvalidRange  = errors.New("invalid range")
+	ErrorNotFound      = errors.New("not found")
+)
+
+// Mux is where the API registers its routes, e.g. lib.HttpApi or an http.ServeMux
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// ChainApi serves read-only views of the chain and the mempool
+type ChainApi struct {
+	db      database.Database
+	mempool core.Mempool
+}
+
+func NewChainApi(db database.Database, mempool core.Mempool) *ChainApi {
+	return &ChainApi{
+		db:      db,
+		mempool: mempool,
+	}
+}
+
+func (a *ChainApi) Register(mux Mux) {
+	mux.Handle("/head", get(a.handleHead))
+	mux.Handle("/blocks/height/", get(a.handleBlockByHeight))
+	mux.Handle("/blocks/", get(a.handleBlockByHash))
+	mux.Handle("/tx/", get(a.handleTransaction))
+	mux.Handle("/mempool", get(a.handleMempool))
+	mux.Handle("/chain", get(a.handleChain))
+}
+
+type BlockResponse struct {
+	Hash common.Hash `json:"hash"`
+	*types.Block
+}
+
+type TxStatus string
+
+const (
+	TxPending  TxStatus = "pending"
+	TxIncluded TxStatus = "included"
+)
+
+type TxResponse struct {
+	Hash        common.Hash  `json:"hash"`
+	Status      TxStatus     `json:"status"`
+	BlockHash   *common.Hash `json:"blockHash,omitempty"`
+	BlockHeight *int64       `json:"blockHeight,omitempty"`
+	types.Tx
+}
+
+func (a *ChainApi) Head() (*BlockResponse, error) {
+	head, err := a.head()
+	if err != nil {
+		return nil, err
+	}
+	return newBlockResponse(head), nil
+}
+
+func (a *ChainApi) BlockByHash(hash common.Hash) (*BlockResponse, error) {
+	block, err := a.db.GetBlockByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return newBlockResponse(block), nil
+}
+
+func (a *ChainApi) BlockByHeight(height int64) (*BlockResponse, error) {
+	if height < 0 {
+		return nil, ErrorInvalidHeight
+	}
+	hash, err := a.db.GetCanonicalHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return a.BlockByHash(hash)
+}
+
+// Transaction looks in the mempool first, then in the canonical chain
+func (a *ChainApi) Transaction(hash common.Hash) (*TxResponse, error) {
+	for _, tx := range a.mempool.ListPendingTransactions() {
+		if txHash, err := tx.Hash(); err == nil && txHash == hash {
+			return &TxResponse{Hash: hash, Status: TxPending, Tx: tx}, nil
+		}
+	}
+
+	blockHash, err := a.db.GetTransactionBlock(hash)
+	if errors.Is(err, database.ErrorTransactionNotFound) {
+		return nil, ErrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, err := a.db.GetBlockByHash(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range block.Transactions {
+		if txHash, err := tx.Hash(); err == nil && txHash == hash {
+			height := block.Header.Height
+			return &TxResponse{Hash: hash, Status: TxIncluded, BlockHash: &blockHash, BlockHeight: &height, Tx: tx}, nil
+		}
+	}
+	return nil, ErrorNotFound
+}
+
+func (a *ChainApi) Mempool() []TxResponse {
+	pending := a.mempool.ListPendingTransactions()
+	txs := make([]TxResponse, 0, len(pending))
+	for _, tx := range pending {
+		hash, err := tx.Hash()
+		if err != nil {
+			continue
+		}
+		txs = append(txs, TxResponse{Hash: hash, Status: TxPending, Tx: tx})
+	}
+	return txs
+}
+
+// Chain returns up to limit canonical blocks starting at height from, oldest first
+func (a *ChainApi) Chain(from int64, limit int64) ([]*BlockResponse, error) {
+	if from < 0 || limit < 1 || limit > maxChainLimit {
+		return nil, ErrorInvalidRange
+	}
+	blocks, err := database.CanonicalRange(a.db, from, int(limit))
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*BlockResponse, 0, len(blocks))
+	for _, block := range blocks {
+		response = append(response, newBlockResponse(block))
+	}
+	return response, nil
+}
+
+func (a *ChainApi) handleHead(w http.ResponseWriter, r *http.Request) {
+	result, err := a.Head()
+	respond(w, result, err)
+}
+
+func (a *ChainApi) handleBlockByHash(w http.ResponseWriter, r *http.Request) {
+	hash, err := parseHash(strings.TrimPrefix(r.URL.Path, "/blocks/"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := a.BlockByHash(hash)
+	respond(w, result, err)
+}
+
+func (a *ChainApi) handleBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/blocks/height/"), 10, 64)
+	if err != nil {
+		writeError(w, ErrorInvalidHeight)
+		return
+	}
+	result, err := a.BlockByHeight(height)
+	respond(w, result, err)
+}
+
+func (a *ChainApi) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	hash, err := parseHash(strings.TrimPrefix(r.URL.Path, "/tx/"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := a.Transaction(hash)
+	respond(w, result, err)
+}
+
+func (a *ChainApi) handleMempool(w http.ResponseWriter, r *http.Request) {
+	httpjson.Write(w, http.StatusOK, a.Mempool())
+}
+
+func (a *ChainApi) handleChain(w http.ResponseWriter, r *http.Request) {
+	from, err := queryInt(r, "from", 0)
+	if err != nil {
+		writeError(w, ErrorInvalidRange)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultChainLimit)
+	if err != nil {
+		writeError(w, ErrorInvalidRange)
+		return
+	}
+	result, err := a.Chain(from, limit)
+	respond(w, result, err)
+}
+
+func (a *ChainApi) head() (*types.Block, error) {
+	head, err := a.db.GetHead()
+	if err != nil {
+		return nil, err
+	}
+	return a.db.GetBlockByHash(head)
+}
+
+func newBlockResponse(block *types.Block) *BlockResponse {
+	return &BlockResponse{Hash: block.BlockHash(), Block: block}
+}
+
+func parseHash(s string) (common.Hash, error) {
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.HashLength {
+		return common.Hash{}, ErrorInvalidHash
+	}
+	return common.BytesToHash(b), nil
+}
+
+func queryInt(r *http.Request, key string, fallback int64) (int64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// get wraps a handler so it only serves GET requests
+func get(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpjson.WriteError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// respond writes the value, or the error if there is one
+func respond(w http.ResponseWriter, value interface{}, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusOK, value)
+}
+
+// writeError maps the error to a status code, anything unexpected is a 500
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrorInvalidHash), errors.Is(err, ErrorInvalidHeight), errors.Is(err, ErrorInvalidRange):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrorNotFound), errors.Is(err, database.ErrorBlockNotFound), errors.Is(err, database.ErrorHeadBlockNotSet):
+		status = http.StatusNotFound
+	default:
+		logger.Error("Request failed", "err", err)
+	}
+	httpjson.WriteError(w, status, err.Error())
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"minchain/core"
+	"minchain/core/chaintest"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/genesis"
+	"minchain/httpjson"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainApi(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	mempool := core.NewMempool(core.NewEventBus(), db)
+	chain := testChain(t, db, 3)
+	pending := chaintest.Tx(t, "pending")
+	require.NoError(t, mempool.ValidateAndStorePending(context.Background(), pending))
+
+	mux := http.NewServeMux()
+	NewChainApi(db, mempool).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var block BlockResponse
+	requireGet(t, server.URL+"/head", http.StatusOK, &block)
+	require.Equal(t, chain[3].BlockHash(), block.Hash)
+	require.Equal(t, int64(3), block.Header.Height)
+
+	requireGet(t, server.URL+"/blocks/"+chain[1].BlockHash().Hex(), http.StatusOK, &block)
+	require.Equal(t, chain[1].BlockHash(), block.Hash)
+
+	requireGet(t, server.URL+"/blocks/height/2", http.StatusOK, &block)
+	require.Equal(t, chain[2].BlockHash(), block.Hash)
+
+	var blocks []BlockResponse
+	requireGet(t, server.URL+"/chain?from=1&limit=2", http.StatusOK, &blocks)
+	require.Len(t, blocks, 2)
+	require.Equal(t, chain[1].BlockHash(), blocks[0].Hash)
+	require.Equal(t, chain[2].BlockHash(), blocks[1].Hash)
+
+	var tx TxResponse
+	includedHash, _ := chain[2].Transactions[0].Hash()
+	requireGet(t, server.URL+"/tx/"+includedHash.Hex(), http.StatusOK, &tx)
+	require.Equal(t, TxIncluded, tx.Status)
+	require.Equal(t, chain[2].BlockHash(), *tx.BlockHash)
+	require.Equal(t, "block 2", tx.Data)
+
+	pendingHash, _ := pending.Hash()
+	requireGet(t, server.URL+"/tx/"+pendingHash.Hex(), http.StatusOK, &tx)
+	require.Equal(t, TxPending, tx.Status)
+
+	var txs []TxResponse
+	requireGet(t, server.URL+"/mempool", http.StatusOK, &txs)
+	require.Len(t, txs, 1)
+	require.Equal(t, pendingHash, txs[0].Hash)
+}
+
+func TestChainApiErrors(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	mux := http.NewServeMux()
+	NewChainApi(db, core.NewMempool(core.NewEventBus(), db)).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var e httpjson.ErrorResponse
+	// Nothing stored yet
+	requireGet(t, server.URL+"/head", http.StatusNotFound, &e)
+
+	testChain(t, db, 1)
+	requireGet(t, server.URL+"/blocks/height/5", http.StatusNotFound, &e)
+	requireGet(t, server.URL+"/blocks/height/-1", http.StatusBadRequest, &e)
+	requireGet(t, server.URL+"/blocks/0x1234", http.StatusBadRequest, &e)
+	requireGet(t, server.URL+"/tx/"+crypto.Keccak256Hash([]byte("unknown")).Hex(), http.StatusNotFound, &e)
+	requireGet(t, server.URL+"/chain?limit=1000", http.StatusBadRequest, &e)
+	require.Equal(t, ErrorInvalidRange.Error(), e.Error)
+
+	response, err := http.Post(server.URL+"/head", "application/json", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func requireGet(t *testing.T, url string, status int, value interface{}) {
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, status, response.StatusCode)
+	require.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(response.Body).Decode(value))
+}
+
+// testChain stores genesis and length blocks on top of it, each with one transaction
+func testChain(t *testing.T, db database.Database, length int) []*types.Block {
+	chain := chaintest.Chain(t, genesis.Default().Block(), length)
+	for _, block := range chain {
+		require.NoError(t, db.PutBlock(block))
+	}
+	require.NoError(t, db.SetHead(chain[length].BlockHash()))
+	return chain
+}
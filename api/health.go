@@ -0,0 +1,179 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/httpjson"
+	"minchain/lib"
+	"net/http"
+	"time"
+)
+
+// Names of the checks in a HealthReport
+const (
+	CheckDatabase = "database"
+	CheckPeers    = "peers"
+	CheckHead     = "head"
+	CheckSync     = "sync"
+	CheckProducer = "producer"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Heartbeat is something which wakes up regularly, core.BlockProducer implements it
+type Heartbeat interface {
+	LastTick() time.Time
+}
+
+type CheckResult struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// HealthReport is OK when all its checks are
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func (r *HealthReport) add(name string, ok bool, detail string, args ...interface{}) {
+	r.Checks[name] = CheckResult{OK: ok, Detail: fmt.Sprintf(detail, args...)}
+	if !ok {
+		r.Status = StatusUnavailable
+	}
+}
+
+// Health answers the orchestrator's probes. Liveness only needs the process and the database, readiness also needs
+// the node to be caught up with its peers.
+type Health struct {
+	db         database.Database
+	peers      PeerSource
+	clock      lib.Clock
+	blockTime  time.Duration
+	thresholds lib.HealthThresholds
+	producer   Heartbeat
+}
+
+func NewHealth(db database.Database, peers PeerSource, clock lib.Clock, config lib.Config) *Health {
+	return &Health{
+		db:         db,
+		peers:      peers,
+		clock:      clock,
+		blockTime:  config.BlockTime,
+		thresholds: config.Health,
+	}
+}
+
+// WatchProducer adds the block producer to the readiness check. It has to be called before Register.
+func (h *Health) WatchProducer(producer Heartbeat) {
+	h.producer = producer
+}
+
+// Register serves /healthz and /readyz, both answer 503 when a check fails
+func (h *Health) Register(mux Mux) {
+	mux.Handle("/healthz", get(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, h.Live())
+	}))
+	mux.Handle("/readyz", get(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, h.Ready())
+	}))
+}
+
+func (h *Health) Live() HealthReport {
+	report := newHealthReport()
+	h.checkDatabase(&report)
+	return report
+}
+
+func (h *Health) Ready() HealthReport {
+	report := newHealthReport()
+	h.checkDatabase(&report)
+	h.checkPeers(&report)
+
+	head, err := h.head()
+	if err != nil {
+		report.add(CheckHead, false, "reading the head: %s", err)
+		report.add(CheckSync, false, "reading the head: %s", err)
+	} else {
+		h.checkHead(&report, head)
+		h.checkSync(&report, head)
+	}
+
+	if h.producer != nil {
+		h.checkProducer(&report)
+	}
+	return report
+}
+
+func newHealthReport() HealthReport {
+	return HealthReport{Status: StatusOK, Checks: make(map[string]CheckResult)}
+}
+
+// checkDatabase only fails on errors from the store itself, a database without a head is still open
+func (h *Health) checkDatabase(report *HealthReport) {
+	_, err := h.db.GetHead()
+	if err != nil && !errors.Is(err, database.ErrorHeadBlockNotSet) {
+		report.add(CheckDatabase, false, "%s", err)
+		return
+	}
+	report.add(CheckDatabase, true, "open")
+}
+
+func (h *Health) checkPeers(report *HealthReport) {
+	count := len(h.peers.All())
+	report.add(CheckPeers, count >= h.thresholds.MinPeers, "%d peers, %d required", count, h.thresholds.MinPeers)
+}
+
+func (h *Health) checkHead(report *HealthReport, head *types.Block) {
+	age := h.clock.Now().Sub(head.Time()).Truncate(time.Millisecond)
+	if h.thresholds.MaxHeadAge == 0 {
+		report.add(CheckHead, true, "height %d, %s old, age not checked", head.Header.Height, age)
+		return
+	}
+	maxAge := time.Duration(h.thresholds.MaxHeadAge) * h.blockTime
+	report.add(CheckHead, age <= maxAge, "height %d, %s old, at most %s allowed", head.Header.Height, age, maxAge)
+}
+
+// checkSync compares the head with the highest block of each peer, as reported in the handshake and moved forward by
+// the blocks it relayed or served since. A node which is far behind is waiting for blocks to be fetched.
+func (h *Health) checkSync(report *HealthReport, head *types.Block) {
+	highest := head.Header.Height
+	for _, status := range h.peers.All() {
+		if status.HeadHeight > highest {
+			highest = status.HeadHeight
+		}
+	}
+	behind := highest - head.Header.Height
+	report.add(CheckSync, behind <= h.thresholds.MaxBlocksBehind, "%d blocks behind the highest peer, at most %d allowed", behind, h.thresholds.MaxBlocksBehind)
+}
+
+func (h *Health) checkProducer(report *HealthReport) {
+	since := h.clock.Since(h.producer.LastTick()).Truncate(time.Millisecond)
+	if h.thresholds.MaxProducerStall == 0 {
+		report.add(CheckProducer, true, "last tick %s ago, not checked", since)
+		return
+	}
+	maxStall := time.Duration(h.thresholds.MaxProducerStall) * h.blockTime
+	report.add(CheckProducer, since <= maxStall, "last tick %s ago, at most %s allowed", since, maxStall)
+}
+
+func (h *Health) head() (*types.Block, error) {
+	hash, err := h.db.GetHead()
+	if err != nil {
+		return nil, err
+	}
+	return h.db.GetBlockByHash(hash)
+}
+
+func writeReport(w http.ResponseWriter, report HealthReport) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	httpjson.Write(w, status, report)
+}
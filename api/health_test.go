@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"minchain/database"
+	"minchain/lib"
+	"minchain/p2p"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testHeartbeat struct {
+	last time.Time
+}
+
+func (h *testHeartbeat) LastTick() time.Time {
+	return h.last
+}
+
+func TestHealth(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	testChain(t, db, 2)
+	// Test blocks have no timestamp, so they are from the epoch
+	clock := lib.NewManualClock(time.UnixMilli(0).Add(20 * time.Second))
+	peers := testPeers{peer.ID("a"): {HeadHeight: 3}}
+	config := lib.Config{
+		BlockTime: 5 * time.Second,
+		Health:    lib.HealthThresholds{MinPeers: 1, MaxHeadAge: 10, MaxBlocksBehind: 2, MaxProducerStall: 3},
+	}
+
+	health := NewHealth(db, peers, clock, config)
+	producer := &testHeartbeat{last: clock.Now()}
+	health.WatchProducer(producer)
+
+	require.Equal(t, StatusOK, health.Live().Status)
+	report := health.Ready()
+	require.Equal(t, StatusOK, report.Status, report)
+	require.Len(t, report.Checks, 5)
+
+	// Falling behind a peer counts as syncing
+	peers[peer.ID("b")] = p2p.Status{HeadHeight: 5}
+	report = health.Ready()
+	require.Equal(t, StatusUnavailable, report.Status)
+	require.False(t, report.Checks[CheckSync].OK)
+	require.True(t, report.Checks[CheckPeers].OK)
+
+	// So does a peer which moved ahead after the handshake
+	delete(peers, peer.ID("b"))
+	require.True(t, health.Ready().Checks[CheckSync].OK)
+	peers[peer.ID("a")] = p2p.Status{HeadHeight: 6}
+	report = health.Ready()
+	require.False(t, report.Checks[CheckSync].OK)
+	require.Equal(t, "4 blocks behind the highest peer, at most 2 allowed", report.Checks[CheckSync].Detail)
+
+	// A stale head and a stalled producer
+	clock.Advance(time.Minute)
+	report = health.Ready()
+	require.False(t, report.Checks[CheckHead].OK)
+	require.False(t, report.Checks[CheckProducer].OK)
+	// Liveness doesn't care
+	require.Equal(t, StatusOK, health.Live().Status)
+
+	// Thresholds of 0 turn the age checks off
+	config.Health = lib.HealthThresholds{}
+	report = NewHealth(db, testPeers{}, clock, config).Ready()
+	require.Equal(t, StatusOK, report.Status, report)
+	require.NotContains(t, report.Checks, CheckProducer)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	clock := lib.NewManualClock(time.Now())
+	config := lib.Config{BlockTime: 5 * time.Second, Health: lib.HealthThresholds{MinPeers: 1}}
+	mux := http.NewServeMux()
+	NewHealth(db, testPeers{}, clock, config).Register(mux)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Nothing but a database is needed to be alive
+	response, err := http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	response.Body.Close()
+
+	response, err = http.Get(server.URL + "/readyz")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	var report HealthReport
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&report))
+	require.Equal(t, StatusUnavailable, report.Status)
+	require.False(t, report.Checks[CheckPeers].OK)
+	require.Equal(t, "0 peers, 1 required", report.Checks[CheckPeers].Detail)
+	require.False(t, report.Checks[CheckHead].OK)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/database"
+	"minchain/lib"
+	"minchain/p2p"
+	"minchain/rpc"
+	"sort"
+)
+
+// Application error codes, from the range JSON-RPC leaves to servers
+const (
+	CodeNotFound        = -32001
+	CodeSigningDisabled = -32010
+)
+
+// Submitter queues transactions the same way the HTTP API does, lib.HttpApi implements it
+type Submitter interface {
+	Submit(ctx context.Context, submission *lib.Submission) (lib.SubmitResult, error)
+}
+
+// PeerSource lists the peers which passed the handshake, p2p.PeerStatuses implements it
+type PeerSource interface {
+	All() map[peer.ID]p2p.Status
+}
+
+type PeerResponse struct {
+	ID peer.ID `json:"id"`
+	p2p.Status
+}
+
+// RegisterRpc adds the chain, tx, mempool and net namespaces to the server
+func RegisterRpc(server *rpc.Server, chain *ChainApi, submitter Submitter, peers PeerSource) error {
+	namespaces := map[string]map[string]rpc.Handler{
+		"chain": {
+			"getHead": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				if err := rpc.ParseParams(params); err != nil {
+					return nil, err
+				}
+				return rpcResult(chain.Head())
+			},
+			"getBlockByHash": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				var hash common.Hash
+				if err := rpc.ParseParams(params, &hash); err != nil {
+					return nil, err
+				}
+				return rpcResult(chain.BlockByHash(hash))
+			},
+			"getBlockByHeight": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				var height int64
+				if err := rpc.ParseParams(params, &height); err != nil {
+					return nil, err
+				}
+				return rpcResult(chain.BlockByHeight(height))
+			},
+		},
+		"tx": {
+			"send": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				var request lib.SubmitRequest
+				if err := rpc.ParseParams(params, &request); err != nil {
+					return nil, err
+				}
+				return sendTransaction(ctx, submitter, request)
+			},
+			"get": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				var hash common.Hash
+				if err := rpc.ParseParams(params, &hash); err != nil {
+					return nil, err
+				}
+				return rpcResult(chain.Transaction(hash))
+			},
+		},
+		"mempool": {
+			"list": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				if err := rpc.ParseParams(params); err != nil {
+					return nil, err
+				}
+				return chain.Mempool(), nil
+			},
+		},
+		"net": {
+			"peers": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+				if err := rpc.ParseParams(params); err != nil {
+					return nil, err
+				}
+				return peerList(peers), nil
+			},
+		},
+	}
+
+	for namespace, methods := range namespaces {
+		if err := server.Register(namespace, methods); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendTransaction(ctx context.Context, submitter Submitter, request lib.SubmitRequest) (interface{}, error) {
+	submission, err := request.Submission()
+	if err != nil {
+		return nil, rpc.InvalidParams(err.Error())
+	}
+
+	result, err := submitter.Submit(ctx, submission)
+	switch {
+	case errors.Is(err, lib.ErrorTooManySubmissions), errors.Is(err, lib.ErrorNotAccepting), errors.Is(err, lib.ErrorSubmitTimeout):
+		return nil, rpc.NewError(rpc.CodeLimitExceeded, err.Error())
+	case err != nil:
+		return nil, err
+	case errors.Is(result.Err, lib.ErrorNodeSigningDisabled):
+		return nil, rpc.NewError(CodeSigningDisabled, result.Err.Error())
+	case result.Err != nil:
+		return nil, result.Err
+	}
+	// A rejection is still a result, the reason says why
+	return lib.SubmitResponse{SubmitResult: result, Metadata: request.Metadata}, nil
+}
+
+func peerList(peers PeerSource) []PeerResponse {
+	all := peers.All()
+	list := make([]PeerResponse, 0, len(all))
+	for id, status := range all {
+		list = append(list, PeerResponse{ID: id, Status: status})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// rpcResult maps the API errors to JSON-RPC errors
+func rpcResult(value interface{}, err error) (interface{}, error) {
+	switch {
+	case err == nil:
+		return value, nil
+	case errors.Is(err, ErrorInvalidHash), errors.Is(err, ErrorInvalidHeight), errors.Is(err, ErrorInvalidRange):
+		return nil, rpc.InvalidParams(err.Error())
+	case errors.Is(err, ErrorNotFound), errors.Is(err, database.ErrorBlockNotFound), errors.Is(err, database.ErrorHeadBlockNotSet):
+		return nil, rpc.NewError(CodeNotFound, err.Error())
+	}
+	return nil, err
+}
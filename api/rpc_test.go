@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+	"minchain/core"
+	"minchain/core/chaintest"
+	"minchain/database"
+	"minchain/lib"
+	"minchain/p2p"
+	"minchain/rpc"
+	"testing"
+)
+
+type testSubmitter struct {
+	err error
+}
+
+func (s *testSubmitter) Submit(ctx context.Context, submission *lib.Submission) (lib.SubmitResult, error) {
+	if submission.Tx == nil {
+		return lib.SubmitResult{Err: lib.ErrorNodeSigningDisabled}, s.err
+	}
+	hash, _ := submission.Tx.Hash()
+	return lib.SubmitResult{Hash: hash, Accepted: true}, s.err
+}
+
+type testPeers map[peer.ID]p2p.Status
+
+func (p testPeers) All() map[peer.ID]p2p.Status {
+	return p
+}
+
+func TestRpc(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	chain := testChain(t, db, 2)
+	submitter := &testSubmitter{}
+	id, err := test.RandPeerID()
+	require.NoError(t, err)
+	peers := testPeers{id: {ChainID: 1, HeadHeight: 2}}
+
+	server := rpc.NewServer()
+	require.NoError(t, RegisterRpc(server, NewChainApi(db, core.NewMempool(core.NewEventBus(), db)), submitter, peers))
+
+	var block BlockResponse
+	requireResult(t, server, `{"jsonrpc":"2.0","id":1,"method":"chain_getBlockByHeight","params":[1]}`, &block)
+	require.Equal(t, chain[1].BlockHash(), block.Hash)
+
+	requireResult(t, server, `{"jsonrpc":"2.0","id":1,"method":"chain_getHead"}`, &block)
+	require.Equal(t, chain[2].BlockHash(), block.Hash)
+
+	var list []PeerResponse
+	requireResult(t, server, `{"jsonrpc":"2.0","id":1,"method":"net_peers","params":[]}`, &list)
+	require.Equal(t, id, list[0].ID)
+	require.Equal(t, int64(2), list[0].HeadHeight)
+
+	tx := chaintest.Tx(t, "hello")
+	hash, _ := tx.Hash()
+	params, _ := json.Marshal([]lib.SubmitRequest{{Transaction: tx}})
+	var sent lib.SubmitResponse
+	requireResult(t, server, `{"jsonrpc":"2.0","id":1,"method":"tx_send","params":`+string(params)+`}`, &sent)
+	require.True(t, sent.Accepted)
+	require.Equal(t, hash, sent.Hash)
+
+	requireError(t, server, `{"jsonrpc":"2.0","id":1,"method":"tx_send","params":[{"message":"sign it"}]}`, CodeSigningDisabled)
+	requireError(t, server, `{"jsonrpc":"2.0","id":1,"method":"tx_send","params":[{}]}`, rpc.CodeInvalidParams)
+	submitter.err = lib.ErrorTooManySubmissions
+	requireError(t, server, `{"jsonrpc":"2.0","id":1,"method":"tx_send","params":`+string(params)+`}`, rpc.CodeLimitExceeded)
+
+	requireError(t, server, `{"jsonrpc":"2.0","id":1,"method":"tx_get","params":["`+common.Hash{1}.Hex()+`"]}`, CodeNotFound)
+	requireError(t, server, `{"jsonrpc":"2.0","id":1,"method":"chain_getBlockByHeight","params":[-1]}`, rpc.CodeInvalidParams)
+	requireError(t, server, `{"jsonrpc":"2.0","id":1,"method":"chain_getBlockByHash","params":["0x12"]}`, rpc.CodeInvalidParams)
+}
+
+func requireResult(t *testing.T, server *rpc.Server, request string, result interface{}) {
+	var reply struct {
+		Result json.RawMessage
+		Error  *rpc.Error
+	}
+	require.NoError(t, json.Unmarshal(server.Handle(context.Background(), []byte(request)), &reply))
+	require.Nil(t, reply.Error)
+	require.NoError(t, json.Unmarshal(reply.Result, result))
+}
+
+func requireError(t *testing.T, server *rpc.Server, request string, code int) {
+	var reply struct {
+		Error *rpc.Error
+	}
+	require.NoError(t, json.Unmarshal(server.Handle(context.Background(), []byte(request)), &reply))
+	require.NotNil(t, reply.Error)
+	require.Equal(t, code, reply.Error.Code)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"minchain/core"
+	"minchain/core/types"
+	"minchain/rpc"
+)
+
+// subscriptionBuffer is how many events a subscription may fall behind before its client is disconnected
+const subscriptionBuffer = 64
+
+// Subscription kinds for sub_subscribe
+const (
+	SubNewHeads               = "newHeads"
+	SubNewPendingTransactions = "newPendingTransactions"
+	SubTxIncluded             = "txIncluded"
+	SubReorg                  = "reorg"
+)
+
+type HeadNotification struct {
+	Hash   common.Hash       `json:"hash"`
+	Header types.BlockHeader `json:"header"`
+}
+
+// RegisterSubscriptions adds the sub namespace, available over WebSocket:
+//   - sub_subscribe("newHeads"), sub_subscribe("newPendingTransactions"), sub_subscribe("reorg")
+//   - sub_subscribe("txIncluded", hash) notifies once when the transaction is in the canonical chain
+//   - sub_unsubscribe(id)
+//
+// A connection holds at most rpc.MaxSubscriptions at once.
+func RegisterSubscriptions(server *rpc.Server, chain *ChainApi, events *core.EventBus) error {
+	return server.Register("sub", map[string]rpc.Handler{
+		"subscribe": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			notifier, err := rpc.NotifierFromContext(ctx)
+			if err != nil {
+				return nil, rpc.NewError(rpc.CodeMethodNotFound, err.Error())
+			}
+
+			var kind string
+			var args []json.RawMessage
+			if err := json.Unmarshal(params, &args); err != nil || len(args) == 0 || json.Unmarshal(args[0], &kind) != nil {
+				return nil, rpc.InvalidParams("expected the subscription kind as the first param")
+			}
+
+			switch kind {
+			case SubNewHeads:
+				return notifier.Subscribe(ctx, func(ctx context.Context, notify func(interface{}) error) {
+					forward(ctx, &events.HeadChanged, notifier, notify, func(e core.HeadChanged) (interface{}, bool) {
+						return HeadNotification{Hash: e.Block.BlockHash(), Header: e.Block.Header}, true
+					})
+				})
+			case SubNewPendingTransactions:
+				return notifier.Subscribe(ctx, func(ctx context.Context, notify func(interface{}) error) {
+					forward(ctx, &events.TxAdded, notifier, notify, func(e core.TxAdded) (interface{}, bool) {
+						return TxResponse{Hash: e.Hash, Status: TxPending, Tx: e.Tx}, true
+					})
+				})
+			case SubReorg:
+				return notifier.Subscribe(ctx, func(ctx context.Context, notify func(interface{}) error) {
+					forward(ctx, &events.Reorg, notifier, notify, func(e core.Reorg) (interface{}, bool) {
+						return e, true
+					})
+				})
+			case SubTxIncluded:
+				var hash common.Hash
+				if err := rpc.ParseParams(params, &kind, &hash); err != nil {
+					return nil, err
+				}
+				return notifier.Subscribe(ctx, func(ctx context.Context, notify func(interface{}) error) {
+					watchInclusion(ctx, chain, events, hash, notifier, notify)
+				})
+			}
+			return nil, rpc.InvalidParams(fmt.Sprintf("unknown subscription %q", kind))
+		},
+		"unsubscribe": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			notifier, err := rpc.NotifierFromContext(ctx)
+			if err != nil {
+				return nil, rpc.NewError(rpc.CodeMethodNotFound, err.Error())
+			}
+			var id string
+			if err := rpc.ParseParams(params, &id); err != nil {
+				return nil, err
+			}
+			return notifier.Unsubscribe(id), nil
+		},
+	})
+}
+
+// forward sends the events convert keeps until the subscription ends. Missing events would leave the client with a
+// wrong picture, so it's disconnected instead.
+func forward[T any](ctx context.Context, feed *core.Feed[T], notifier *rpc.Notifier, notify func(interface{}) error, convert func(T) (interface{}, bool)) {
+	sub := feed.Subscribe(ctx, subscriptionBuffer)
+	for {
+		select {
+		case event, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if result, send := convert(event); send {
+				if err := notify(result); err != nil {
+					return
+				}
+			}
+		case <-sub.Overflow():
+			notifier.Disconnect()
+			return
+		}
+	}
+}
+
+func watchInclusion(ctx context.Context, chain *ChainApi, events *core.EventBus, hash common.Hash, notifier *rpc.Notifier, notify func(interface{}) error) {
+	// Subscribe before looking at the chain, so a block imported in between isn't missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	heads := events.HeadChanged.Subscribe(ctx, subscriptionBuffer)
+
+	if tx, err := chain.Transaction(hash); err == nil && tx.Status == TxIncluded {
+		_ = notify(tx)
+		return
+	}
+
+	for {
+		select {
+		case event, ok := <-heads.C():
+			if !ok {
+				return
+			}
+			for _, tx := range event.Block.Transactions {
+				if txHash, err := tx.Hash(); err == nil && txHash == hash {
+					blockHash, height := event.Block.BlockHash(), event.Block.Header.Height
+					_ = notify(TxResponse{Hash: hash, Status: TxIncluded, BlockHash: &blockHash, BlockHeight: &height, Tx: tx})
+					return
+				}
+			}
+		case <-heads.Overflow():
+			notifier.Disconnect()
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"minchain/core"
+	"minchain/core/chaintest"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/rpc"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type notificationMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func subscriptionServer(t *testing.T) (*database.MemoryDatabase, *core.EventBus, *websocket.Conn) {
+	db := database.NewMemoryDatabase().(*database.MemoryDatabase)
+	events := core.NewEventBus()
+	server := rpc.NewServer()
+	require.NoError(t, RegisterSubscriptions(server, NewChainApi(db, core.NewMempool(events, db)), events))
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return db, events, conn
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, params string) string {
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"sub_subscribe","params":`+params+`}`)))
+	var reply notificationMessage
+	require.NoError(t, conn.ReadJSON(&reply))
+	var id string
+	require.NoError(t, json.Unmarshal(reply.Result, &id))
+	return id
+}
+
+func TestSubscriptions(t *testing.T) {
+	db, events, conn := subscriptionServer(t)
+	chain := testChain(t, db, 1)
+
+	heads := subscribe(t, conn, `["newHeads"]`)
+	pending := chaintest.Tx(t, "pending")
+	pendingHash, _ := pending.Hash()
+	included := subscribe(t, conn, `["txIncluded","`+pendingHash.Hex()+`"]`)
+	require.NotEqual(t, heads, included)
+
+	// The subscriptions start once their ID was sent, give them a moment to subscribe to the bus
+	time.Sleep(50 * time.Millisecond)
+
+	block := &types.Block{Header: types.BlockHeader{ParentHash: chain[1].BlockHash(), Height: 2}, Transactions: []types.Tx{*pending}}
+	events.HeadChanged.Publish(core.HeadChanged{Block: block})
+
+	results := make(map[string]json.RawMessage)
+	for len(results) < 2 {
+		var message notificationMessage
+		require.NoError(t, conn.ReadJSON(&message))
+		results[message.Params.Subscription] = message.Params.Result
+	}
+
+	var head HeadNotification
+	require.NoError(t, json.Unmarshal(results[heads], &head))
+	require.Equal(t, block.BlockHash(), head.Hash)
+
+	var tx TxResponse
+	require.NoError(t, json.Unmarshal(results[included], &tx))
+	require.Equal(t, TxIncluded, tx.Status)
+	require.Equal(t, block.BlockHash(), *tx.BlockHash)
+
+	// Already included transactions are reported right away
+	includedHash, _ := chain[1].Transactions[0].Hash()
+	id := subscribe(t, conn, `["txIncluded","`+includedHash.Hex()+`"]`)
+	var message notificationMessage
+	require.NoError(t, conn.ReadJSON(&message))
+	require.Equal(t, id, message.Params.Subscription)
+}
+
+func TestSubscriptionLimit(t *testing.T) {
+	_, _, conn := subscriptionServer(t)
+	var ids []string
+	for i := 0; i < rpc.MaxSubscriptions; i++ {
+		ids = append(ids, subscribe(t, conn, `["newHeads"]`))
+	}
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"sub_subscribe","params":["newHeads"]}`)))
+	var reply struct {
+		Error *rpc.Error `json:"error"`
+	}
+	require.NoError(t, conn.ReadJSON(&reply))
+	require.NotNil(t, reply.Error)
+	require.Equal(t, rpc.CodeLimitExceeded, reply.Error.Code)
+
+	// Unsubscribing makes room again
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"sub_unsubscribe","params":["`+ids[0]+`"]}`)))
+	var unsubscribed notificationMessage
+	require.NoError(t, conn.ReadJSON(&unsubscribed))
+	require.JSONEq(t, "true", string(unsubscribed.Result))
+	subscribe(t, conn, `["newHeads"]`)
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	_, events, conn := subscriptionServer(t)
+	subscribe(t, conn, `["newPendingTransactions"]`)
+	time.Sleep(50 * time.Millisecond)
+
+	// Far more than the buffers and the socket hold while the client doesn't read
+	data := strings.Repeat("x", 10*1024)
+	for i := 0; i < 5000; i++ {
+		events.TxAdded.Publish(core.TxAdded{Tx: types.Tx{Data: data}})
+	}
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	received := 0
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			require.False(t, strings.Contains(err.Error(), "timeout"), "connection wasn't closed: %s", err)
+			break
+		}
+		received++
+	}
+	require.Less(t, received, 5000)
+}
@@ -2,16 +2,19 @@ package app
 
 import (
 	"context"
-	"log"
+	"errors"
 	"minchain/core"
 	"minchain/database"
 	"minchain/genesis"
 	"minchain/lib"
+	"minchain/logging"
 	"minchain/p2p"
 	"minchain/services"
 	"minchain/validator"
 )
 
+var logger = logging.Logger(logging.Node)
+
 type App struct {
 	mempool            core.Mempool
 	database           database.Database
@@ -20,7 +23,12 @@ type App struct {
 	config             lib.Config
 	publisher          p2p.Publisher
 	consumer           p2p.Consumer
+	reporter           p2p.Reporter
 	transactionsInputs []lib.TransactionsInput
+	genesis            *genesis.Genesis
+	clock              lib.Clock
+	events             *core.EventBus
+	producer           *core.BlockProducer
 }
 
 func NewApp(
@@ -31,7 +39,11 @@ func NewApp(
 	config lib.Config,
 	publisher p2p.Publisher,
 	consumer p2p.Consumer,
+	reporter p2p.Reporter,
 	transactionsInputs []lib.TransactionsInput,
+	genesis *genesis.Genesis,
+	clock lib.Clock,
+	events *core.EventBus,
 ) *App {
 	return &App{
 		mempool:            mempool,
@@ -41,34 +53,82 @@ func NewApp(
 		config:             config,
 		publisher:          publisher,
 		consumer:           consumer,
+		reporter:           reporter,
 		transactionsInputs: transactionsInputs,
+		genesis:            genesis,
+		clock:              clock,
+		events:             events,
 	}
 }
 
 func (app *App) Start(ctx context.Context) {
-	log.Println("In App#start")
+	logger.Info("Starting node", "blockProducer", app.config.IsBlockProducer)
 	app.initializeGenesisState()
+	app.checkChainIntegrity()
 	app.launchTransactionsProcessing(ctx)
 	app.launchBlocksProcessing(ctx)
 
 	if app.config.IsBlockProducer {
-		go core.NewBlockProducer(app.mempool, app.database, app.publisher, app.config).BuildAndPublishBlock(ctx)
+		app.producer = core.NewBlockProducer(app.mempool, app.database, app.publisher, app.config, app.clock, app.events)
+		go app.producer.BuildAndPublishBlock(ctx)
 	}
 }
 
+// BlockProducer is the running producer, nil until Start or when the node doesn't produce blocks
+func (app *App) BlockProducer() *core.BlockProducer {
+	return app.producer
+}
+
+// checkChainIntegrity runs the check InitConfig validated. Configs built in code without one, e.g. in tests, skip it.
+func (app *App) checkChainIntegrity() {
+	mode := app.config.ChainCheck
+	if mode != lib.CHAIN_CHECK_VERIFY && mode != lib.CHAIN_CHECK_REPAIR {
+		return
+	}
+
+	report, err := core.VerifyChain(app.database, app.genesis.Block())
+	if errors.Is(err, database.ErrorHeadBlockNotSet) {
+		return
+	}
+	if err != nil {
+		logging.Fatal(logger, "Error checking chain integrity", "err", err)
+	}
+
+	logger.Info("Chain integrity checked", "report", report.String())
+	if !report.IsCorrupted() {
+		return
+	}
+
+	if mode == lib.CHAIN_CHECK_VERIFY {
+		logging.Fatal(logger, "Refusing to start on a corrupted chain. Restart with CHAIN_CHECK=repair to roll back the head")
+	}
+
+	if err := core.RepairChain(app.database, app.genesis.Block(), report); err != nil {
+		logging.Fatal(logger, "Error repairing the chain", "err", err)
+	}
+	head, _ := app.database.GetHead()
+	logger.Warn("Head rolled back", "head", head)
+}
+
 func (app *App) initializeGenesisState() {
-	err := genesis.InitializeGenesisState(app.database)
+	err := genesis.InitializeGenesisState(app.database, app.genesis)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal(logger, "Error initializing the genesis state", "err", err)
 	}
 }
 
 func (app *App) launchTransactionsProcessing(ctx context.Context) {
+	// Without a wallet only transactions signed by clients are accepted
+	var wallet *core.Wallet
+	if app.config.NodeSigning {
+		wallet = app.wallet
+	}
 	processTransactions := services.NewProcessTransactionsService(
 		app.mempool,
-		app.wallet,
+		wallet,
 		app.publisher,
 		app.consumer,
+		app.reporter,
 		app.transactionsInputs,
 	)
 	processTransactions.Start(ctx)
@@ -80,6 +140,9 @@ func (app *App) launchBlocksProcessing(ctx context.Context) {
 		app.database,
 		app.mempool,
 		app.consumer,
+		app.reporter,
+		app.clock,
+		app.events,
 	)
 	blocksProcessing.Start(ctx)
 }
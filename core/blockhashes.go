@@ -1,6 +1,7 @@
 package core
 
 import (
+	"github.com/ethereum/go-ethereum/common"
 	"minchain/database"
 	"strings"
 )
@@ -17,14 +18,15 @@ func PrintBlockHashes(database database.Database) (string, error) {
 
 	for {
 		hashes = append(hashes, blockHash.Hex())
-		if blockHash == GenesisBlock.BlockHash() {
-			break
-		}
 		currentBlock, err := database.GetBlockByHash(blockHash)
-		blockHash = currentBlock.Header.ParentHash
 		if err != nil {
 			return "", err
 		}
+		// Only genesis has no parent
+		if currentBlock.Header.ParentHash == (common.Hash{}) {
+			break
+		}
+		blockHash = currentBlock.Header.ParentHash
 	}
 
 	return strings.Join(hashes, " -> "), nil
@@ -8,19 +8,28 @@ import (
 	"testing"
 )
 
+var testGenesis = types.Block{
+	Header: types.BlockHeader{
+		ParentHash:      common.Hash{},
+		TransactionHash: common.Hash{},
+		Height:          0,
+	},
+	Transactions: make([]types.Tx, 0),
+}
+
 func TestPrintBlockHashes(t *testing.T) {
 	db := database.NewMemoryDatabase()
 	hashes, _ := PrintBlockHashes(db)
 	require.Equal(t, NoHeadMessage, hashes)
 
-	_ = db.PutBlock(&GenesisBlock)
-	_ = db.SetHead(GenesisBlock.BlockHash())
+	_ = db.PutBlock(&testGenesis)
+	_ = db.SetHead(testGenesis.BlockHash())
 	hashes, _ = PrintBlockHashes(db)
-	require.Equal(t, GenesisBlock.BlockHash().Hex(), hashes)
+	require.Equal(t, testGenesis.BlockHash().Hex(), hashes)
 
 	nextBlock := types.Block{
 		Header: types.BlockHeader{
-			ParentHash:      GenesisBlock.BlockHash(),
+			ParentHash:      testGenesis.BlockHash(),
 			TransactionHash: common.Hash{},
 		},
 		Transactions: make([]types.Tx, 0),
@@ -29,7 +38,7 @@ func TestPrintBlockHashes(t *testing.T) {
 	_ = db.PutBlock(&nextBlock)
 	_ = db.SetHead(nextBlock.BlockHash())
 
-	expected := nextBlock.BlockHash().Hex() + " -> " + GenesisBlock.BlockHash().Hex()
+	expected := nextBlock.BlockHash().Hex() + " -> " + testGenesis.BlockHash().Hex()
 	hashes, _ = PrintBlockHashes(db)
 	require.Equal(t, expected, hashes)
 }
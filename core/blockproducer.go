@@ -2,64 +2,125 @@ package core
 
 import (
 	"context"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"minchain/core/types"
 	"minchain/database"
 	"minchain/lib"
+	"minchain/logging"
+	"minchain/metrics"
 	"minchain/p2p"
+	"minchain/tracing"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	producerLogger = logging.Logger(logging.Producer)
+	producerTracer = tracing.Tracer(logging.Producer)
+)
+
 // BlockProducer reads mempool and then produces and publishes a block
 type BlockProducer struct {
 	mempool      Mempool
 	database     database.Database
 	config       lib.Config
 	p2pPublisher p2p.Publisher
+	clock        lib.Clock
+	events       *EventBus
+	// lastTick is when the block time ticker last fired, in unix milliseconds
+	lastTick atomic.Int64
 }
 
-func NewBlockProducer(mempool Mempool, database database.Database, p2pPublisher p2p.Publisher, config lib.Config) *BlockProducer {
-	return &BlockProducer{
+func NewBlockProducer(mempool Mempool, database database.Database, p2pPublisher p2p.Publisher, config lib.Config, clock lib.Clock, events *EventBus) *BlockProducer {
+	bp := &BlockProducer{
 		mempool:      mempool,
 		database:     database,
 		p2pPublisher: p2pPublisher,
 		config:       config,
+		clock:        clock,
+		events:       events,
 	}
+	// Counts as a tick, so the producer isn't reported stalled before its first slot
+	bp.lastTick.Store(clock.Now().UnixMilli())
+	return bp
+}
+
+// LastTick is when the producer last woke up for a slot, whether or not it produced a block
+func (bp *BlockProducer) LastTick() time.Time {
+	return time.UnixMilli(bp.lastTick.Load())
 }
 
 // TODO Split block production and publishing
 func (bp *BlockProducer) BuildAndPublishBlock(ctx context.Context) {
-	blocktimeTicker := time.NewTicker(bp.config.BlockTime)
+	blocktimeTicker := bp.clock.NewTicker(bp.config.BlockTime)
 	defer blocktimeTicker.Stop()
 
+	// The mempool is only read on a slot after transactions were added. Whatever was added before subscribing is
+	// picked up on the first slot.
+	added := bp.events.TxAdded.Subscribe(ctx, 1)
+	pending := true
+
 	for {
 		select {
-		case <-blocktimeTicker.C:
+		case <-ctx.Done():
+			return
+		case <-added.C():
+			// A full buffer drops events, which is fine since one is enough to know there's work
+			pending = true
+		case <-blocktimeTicker.C():
+			bp.lastTick.Store(bp.clock.Now().UnixMilli())
+			if !pending {
+				continue
+			}
 			// TODO more advanced selection logic
 			transactions := bp.mempool.ListPendingTransactions()
 			if len(transactions) == 0 {
+				pending = false
 				continue
 			}
 
+			start := time.Now()
 			block, err := bp.buildBlock(transactions)
-			log.Println("Building block. Block hash:", block.BlockHash())
 			if err != nil {
-				log.Println("error building the block")
+				producerLogger.Error("Error building the block", "err", err)
 				continue
 			}
 
 			if block != nil {
-				log.Println("Produced block: ", block.PrettyPrint())
-				if err := bp.p2pPublisher.PublishBlock(ctx, block); err != nil {
-					log.Println("Publish error:", err)
-				}
-
-				bp.mempool.PruneTransactions(block.Transactions)
+				bp.publishBlock(ctx, block, start)
 			}
 		}
 	}
 }
 
+// publishBlock gossips a block the producer built. Its span starts with the building and links to the spans which
+// admitted its transactions, the nodes importing the block continue its trace.
+func (bp *BlockProducer) publishBlock(ctx context.Context, block *types.Block, start time.Time) {
+	ctx, span := producerTracer.Start(ctx, "producer.produce",
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(bp.mempool.TraceLinks(block.Transactions)...),
+	)
+	span.SetAttributes(
+		attribute.String("block.hash", block.BlockHash().Hex()),
+		attribute.Int64("block.height", block.Header.Height),
+		attribute.Int("block.txs", len(block.Transactions)),
+	)
+	defer span.End()
+
+	producerLogger.Info("Produced block", "hash", block.BlockHash(), "height", block.Header.Height, "txs", len(block.Transactions))
+	if err := bp.p2pPublisher.PublishBlock(ctx, block); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		producerLogger.Warn("Error publishing the block", "hash", block.BlockHash(), "err", err)
+	} else {
+		metrics.BlocksProduced.Inc()
+	}
+
+	bp.mempool.PruneTransactions(block.Transactions)
+}
+
 type BlockBuilder interface {
 	buildBlock([]types.Tx) (*types.Block, error)
 }
@@ -67,18 +128,23 @@ type BlockBuilder interface {
 func (bp *BlockProducer) buildBlock(txs []types.Tx) (*types.Block, error) {
 	txHash, err := types.CombinedHash(txs)
 	if err != nil {
-		log.Println("Block production failed. Skipping") // TODO error handling
 		return nil, err
 	}
 
 	parent, err := bp.database.GetHead()
 	if err != nil {
-		log.Fatal("No parent in database due to incorrect node initialization. Should never happen")
+		logging.Fatal(producerLogger, "No parent in database due to incorrect node initialization. Should never happen", "err", err)
 	}
 
 	parentBlock, err := bp.database.GetBlockByHash(parent)
 	if err != nil {
-		log.Fatal("error getting parentBlock", err)
+		logging.Fatal(producerLogger, "Error getting the parent block", "hash", parent, "err", err)
+	}
+
+	timestamp, ok := bp.nextSlot(parentBlock.Header.Timestamp)
+	if !ok {
+		// Ticks and slots can drift apart, the block goes out on the next tick
+		return nil, nil
 	}
 
 	block := types.Block{
@@ -86,8 +152,20 @@ func (bp *BlockProducer) buildBlock(txs []types.Tx) (*types.Block, error) {
 			ParentHash:      parent,
 			TransactionHash: txHash,
 			Height:          parentBlock.Header.Height + 1,
+			Timestamp:       timestamp,
 		},
 		Transactions: txs,
 	}
 	return &block, nil
 }
+
+// nextSlot returns the timestamp of the latest slot which has started. Slots are BlockTime apart counting from the
+// parent, it's false if the first slot after the parent hasn't started yet.
+func (bp *BlockProducer) nextSlot(parentTimestamp int64) (int64, bool) {
+	slot := bp.config.BlockTime.Milliseconds()
+	elapsed := bp.clock.Now().UnixMilli() - parentTimestamp
+	if slot <= 0 || elapsed < slot {
+		return 0, false
+	}
+	return parentTimestamp + elapsed/slot*slot, true
+}
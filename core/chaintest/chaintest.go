@@ -0,0 +1,45 @@
+// Package chaintest builds signed transactions and blocks for tests
+package chaintest
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"testing"
+)
+
+// Key signs the transactions, it's the first account of the local dev networks
+var Key, _ = crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+
+// Tx is a transaction with the data, signed by Key
+func Tx(t *testing.T, data string) *types.Tx {
+	tx, err := types.SignTx(Key, data)
+	require.NoError(t, err)
+	return tx
+}
+
+// Block is a child of parent with the transactions
+func Block(t *testing.T, parent *types.Block, timestamp int64, txs ...types.Tx) *types.Block {
+	txHash, err := types.CombinedHash(txs)
+	require.NoError(t, err)
+
+	return &types.Block{
+		Header: types.BlockHeader{
+			ParentHash:      parent.BlockHash(),
+			TransactionHash: txHash,
+			Height:          parent.Header.Height + 1,
+			Timestamp:       timestamp,
+		},
+		Transactions: txs,
+	}
+}
+
+// Chain is root followed by length blocks on top of it, block i has the one transaction "block i"
+func Chain(t *testing.T, root *types.Block, length int) []*types.Block {
+	chain := []*types.Block{root}
+	for i := 1; i <= length; i++ {
+		chain = append(chain, Block(t, chain[i-1], 0, *Tx(t, fmt.Sprintf("block %d", i))))
+	}
+	return chain
+}
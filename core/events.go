@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/core/types"
+	"minchain/p2p"
+	"sync"
+	"sync/atomic"
+)
+
+// BlockImported is published once a valid block from the network is stored, before the head moves to it
+type BlockImported struct {
+	Block *types.Block
+}
+
+// HeadChanged is published after the head was moved to Block
+type HeadChanged struct {
+	Block *types.Block
+}
+
+// Reorg is published when the new head doesn't build on the old one. Depth is how many blocks of the old chain were
+// replaced.
+type Reorg struct {
+	OldHead        common.Hash `json:"oldHead"`
+	NewHead        common.Hash `json:"newHead"`
+	CommonAncestor common.Hash `json:"commonAncestor"`
+	Depth          int64       `json:"depth"`
+}
+
+// TxAdded is published when a transaction enters the mempool
+type TxAdded struct {
+	Hash common.Hash
+	Tx   types.Tx
+}
+
+type DropReason string
+
+const DropIncluded DropReason = "included"
+
+// TxDropped is published when a transaction leaves the mempool
+type TxDropped struct {
+	Hash   common.Hash
+	Reason DropReason
+}
+
+// PeerConnected is published when a peer passed the handshake
+type PeerConnected struct {
+	ID     peer.ID
+	Status p2p.Status
+}
+
+// EventBus carries chain, mempool and peer events to whoever is interested, without the publishers knowing about them
+type EventBus struct {
+	BlockImported Feed[BlockImported]
+	HeadChanged   Feed[HeadChanged]
+	Reorg         Feed[Reorg]
+	TxAdded       Feed[TxAdded]
+	TxDropped     Feed[TxDropped]
+	PeerConnected Feed[PeerConnected]
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Feed delivers events of one type. Publishing never blocks, a subscriber with a full buffer misses the event.
+type Feed[T any] struct {
+	lock          sync.RWMutex
+	subscriptions map[*Subscription[T]]struct{}
+}
+
+// Subscription receives events until its context is done, then C is closed
+type Subscription[T any] struct {
+	c        chan T
+	overflow chan struct{}
+	dropped  atomic.Uint64
+}
+
+func (s *Subscription[T]) C() <-chan T {
+	return s.c
+}
+
+// Overflow is closed once the subscriber missed an event because it didn't keep up
+func (s *Subscription[T]) Overflow() <-chan struct{} {
+	return s.overflow
+}
+
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (f *Feed[T]) Subscribe(ctx context.Context, buffer int) *Subscription[T] {
+	sub := &Subscription[T]{
+		c:        make(chan T, buffer),
+		overflow: make(chan struct{}),
+	}
+
+	f.lock.Lock()
+	if f.subscriptions == nil {
+		f.subscriptions = make(map[*Subscription[T]]struct{})
+	}
+	f.subscriptions[sub] = struct{}{}
+	f.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.lock.Lock()
+		delete(f.subscriptions, sub)
+		f.lock.Unlock()
+		close(sub.c)
+	}()
+	return sub
+}
+
+func (f *Feed[T]) Publish(event T) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	for sub := range f.subscriptions {
+		select {
+		case sub.c <- event:
+		default:
+			if sub.dropped.Add(1) == 1 {
+				close(sub.overflow)
+			}
+		}
+	}
+}
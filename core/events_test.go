@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"minchain/database"
+	"testing"
+)
+
+func TestFeed(t *testing.T) {
+	var feed Feed[int]
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := feed.Subscribe(ctx, 2)
+
+	feed.Publish(1)
+	feed.Publish(2)
+	// Publishing doesn't wait for a full subscriber
+	feed.Publish(3)
+
+	require.Equal(t, 1, <-sub.C())
+	require.Equal(t, 2, <-sub.C())
+	require.Equal(t, uint64(1), sub.Dropped())
+	select {
+	case <-sub.Overflow():
+	default:
+		t.Fatal("overflow not signalled")
+	}
+
+	cancel()
+	_, open := <-sub.C()
+	require.False(t, open)
+	// Nobody listens anymore
+	feed.Publish(4)
+}
+
+func TestNewReorg(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	root := &testGenesis
+	require.NoError(t, db.PutBlock(root))
+
+	// root - a1 - a2 - a3
+	//      \ b1 - b2
+	a1 := childBlock(t, root, "a1")
+	a2 := childBlock(t, a1, "a2")
+	a3 := childBlock(t, a2, "a3")
+	b1 := childBlock(t, root, "b1")
+	b2 := childBlock(t, b1, "b2")
+	for _, block := range []*types.Block{a1, a2, a3, b1, b2} {
+		require.NoError(t, db.PutBlock(block))
+	}
+
+	reorg, err := NewReorg(db, a3.BlockHash(), b2.BlockHash())
+	require.NoError(t, err)
+	require.Equal(t, root.BlockHash(), reorg.CommonAncestor)
+	require.Equal(t, int64(3), reorg.Depth)
+
+	reorg, err = NewReorg(db, b2.BlockHash(), a3.BlockHash())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), reorg.Depth)
+}
+
+func TestMempoolEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := NewEventBus()
+	added := events.TxAdded.Subscribe(ctx, 4)
+	dropped := events.TxDropped.Subscribe(ctx, 4)
+
+	mempool := NewMempool(events, database.NewMemoryDatabase())
+	block := childBlock(t, &testGenesis, "hello")
+	tx := block.Transactions[0]
+	hash, _ := tx.Hash()
+
+	require.NoError(t, mempool.ValidateAndStorePending(context.Background(), &tx))
+	// Known transactions aren't announced twice
+	require.NoError(t, mempool.ValidateAndStorePending(context.Background(), &tx))
+	require.Equal(t, TxAdded{Hash: hash, Tx: tx}, <-added.C())
+	require.Len(t, added.C(), 0)
+
+	mempool.PruneTransactions(block.Transactions)
+	mempool.PruneTransactions(block.Transactions)
+	require.Equal(t, TxDropped{Hash: hash, Reason: DropIncluded}, <-dropped.C())
+	require.Len(t, dropped.C(), 0)
+}
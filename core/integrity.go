@@ -0,0 +1,261 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math"
+	"minchain/core/types"
+	"minchain/database"
+	"sort"
+)
+
+var (
+	ErrorMissingBlock    = errors.New("missing block")
+	ErrorBrokenParent    = errors.New("parent hash doesn't match parent block")
+	ErrorBrokenHeight    = errors.New("height is not parent height + 1")
+	ErrorBrokenTxHash    = errors.New("transaction hash doesn't match transactions")
+	ErrorInvalidTx       = errors.New("invalid transaction signature")
+	ErrorUnknownGenesis  = errors.New("chain doesn't end at the genesis block")
+	ErrorNoValidAncestor = errors.New("no valid block found in the database")
+)
+
+// ChainReport is the result of verifying the canonical chain from head to genesis.
+type ChainReport struct {
+	Head common.Hash
+	// FirstCorruptedHeight is the lowest height which failed verification, -1 if the chain is intact
+	FirstCorruptedHeight int64
+	// LastGood is the highest block whose whole ancestry is valid, the rollback target for a repair
+	LastGood       common.Hash
+	LastGoodHeight int64
+	Reason         error
+}
+
+func (r *ChainReport) IsCorrupted() bool {
+	return r.Reason != nil
+}
+
+func (r *ChainReport) String() string {
+	if !r.IsCorrupted() {
+		return fmt.Sprintf("chain OK. Head %s at height %d", r.Head.Hex(), r.LastGoodHeight)
+	}
+	return fmt.Sprintf("chain corrupted at height %d: %v. Last good block %s at height %d",
+		r.FirstCorruptedHeight, r.Reason, r.LastGood.Hex(), r.LastGoodHeight)
+}
+
+// VerifyChain walks the canonical chain from head to genesis and re-checks parent links, heights,
+// transaction hashes and signatures. Returns database.ErrorHeadBlockNotSet for an uninitialized database.
+func VerifyChain(db database.Database, genesis *types.Block) (*ChainReport, error) {
+	genesisHash := genesis.BlockHash()
+	head, err := db.GetHead()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ChainReport{
+		Head:                 head,
+		FirstCorruptedHeight: -1,
+		LastGoodHeight:       -1,
+	}
+
+	chain, err := loadCanonicalChain(db, head, genesisHash)
+	var gap error
+	if errors.Is(err, ErrorMissingBlock) {
+		gap = err
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Without a complete chain down to genesis we can't tell which part of it to trust, so look for the best block
+	// below the gap that still connects to genesis. Blocks at or above it may be on a fork the head never followed.
+	if gap != nil {
+		report.Reason = gap
+		below := int64(math.MaxInt64)
+		if len(chain) > 0 {
+			below = chain[len(chain)-1].Header.Height - 1
+		}
+		if err := findLastGoodBlock(db, genesisHash, below, report); err != nil {
+			return nil, err
+		}
+		report.FirstCorruptedHeight = report.LastGoodHeight + 1
+		return report, nil
+	}
+
+	// chain is ordered head first, verify it from genesis up
+	for i := len(chain) - 1; i >= 0; i-- {
+		var parent *types.Block
+		if i < len(chain)-1 {
+			parent = chain[i+1]
+		}
+
+		if err := verifyBlock(chain[i], parent, genesisHash); err != nil {
+			report.Reason = err
+			report.FirstCorruptedHeight = chain[i].Header.Height
+			break
+		}
+
+		report.LastGood = chain[i].BlockHash()
+		report.LastGoodHeight = chain[i].Header.Height
+	}
+
+	// Not even the bottom of the chain verified, so only the genesis block itself can be trusted
+	if report.LastGoodHeight < 0 {
+		if err := findLastGoodBlock(db, genesisHash, 1, report); err != nil {
+			return nil, err
+		}
+		report.FirstCorruptedHeight = report.LastGoodHeight + 1
+	}
+
+	return report, nil
+}
+
+// RepairChain rolls the head back to the last good block of a corrupted chain.
+// If not even the genesis block survived, genesis is stored again.
+func RepairChain(db database.Database, genesis *types.Block, report *ChainReport) error {
+	if !report.IsCorrupted() {
+		return nil
+	}
+
+	if report.LastGoodHeight < 0 {
+		if err := db.PutBlock(genesis); err != nil {
+			return err
+		}
+		return db.SetHead(genesis.BlockHash())
+	}
+
+	return db.SetHead(report.LastGood)
+}
+
+// loadCanonicalChain returns blocks from head down to genesis. The chain is cut short with ErrorMissingBlock
+// if any of the blocks is missing or can't be decoded.
+func loadCanonicalChain(db database.Database, head common.Hash, genesisHash common.Hash) ([]*types.Block, error) {
+	chain := make([]*types.Block, 0)
+	visited := make(map[common.Hash]bool)
+	hash := head
+
+	for {
+		if visited[hash] {
+			return chain, fmt.Errorf("%w: cycle at %s", ErrorMissingBlock, hash.Hex())
+		}
+		visited[hash] = true
+
+		block, err := db.GetBlockByHash(hash)
+		if errors.Is(err, database.ErrorBlockNotFound) || errors.Is(err, database.ErrorCorruptedBlock) {
+			return chain, fmt.Errorf("%w: %s (%v)", ErrorMissingBlock, hash.Hex(), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if block.BlockHash() != hash {
+			return chain, fmt.Errorf("%w: %s stored under %s", ErrorMissingBlock, block.BlockHash().Hex(), hash.Hex())
+		}
+
+		chain = append(chain, block)
+		if hash == genesisHash || block.Header.ParentHash == (common.Hash{}) {
+			return chain, nil
+		}
+		hash = block.Header.ParentHash
+	}
+}
+
+// verifyBlock checks the block against its parent. A nil parent means the block must be genesis.
+func verifyBlock(block *types.Block, parent *types.Block, genesisHash common.Hash) error {
+	if parent == nil {
+		if block.BlockHash() != genesisHash {
+			return fmt.Errorf("%w: %s", ErrorUnknownGenesis, block.BlockHash().Hex())
+		}
+		return nil
+	}
+
+	if block.Header.ParentHash != parent.BlockHash() {
+		return fmt.Errorf("%w: %s", ErrorBrokenParent, parent.BlockHash().Hex())
+	}
+
+	if block.Header.Height != parent.Header.Height+1 {
+		return fmt.Errorf("%w: got %d, parent %d", ErrorBrokenHeight, block.Header.Height, parent.Header.Height)
+	}
+
+	txHash, err := types.CombinedHash(block.Transactions)
+	if err != nil {
+		return err
+	}
+	if txHash != block.Header.TransactionHash {
+		return ErrorBrokenTxHash
+	}
+
+	for i := range block.Transactions {
+		if !IsValid(&block.Transactions[i]) {
+			hash, _ := block.Transactions[i].Hash()
+			return fmt.Errorf("%w: %s", ErrorInvalidTx, hash.Hex())
+		}
+	}
+
+	return nil
+}
+
+// findLastGoodBlock scans the stored blocks lower than below and picks the highest one whose ancestry verifies down
+// to genesis.
+func findLastGoodBlock(db database.Database, genesisHash common.Hash, below int64, report *ChainReport) error {
+	candidates := make([]*types.Block, 0)
+	err := db.ForEachBlock(func(block *types.Block) error {
+		if block.Header.Height < below {
+			candidates = append(candidates, block)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Header.Height > candidates[j].Header.Height
+	})
+
+	known := make(map[common.Hash]bool)
+	for _, candidate := range candidates {
+		if connectsToGenesis(db, candidate, genesisHash, known) {
+			report.LastGood = candidate.BlockHash()
+			report.LastGoodHeight = candidate.Header.Height
+			return nil
+		}
+	}
+
+	report.LastGood = common.Hash{}
+	report.LastGoodHeight = -1
+	if report.Reason == nil {
+		report.Reason = ErrorNoValidAncestor
+	}
+	return nil
+}
+
+// connectsToGenesis verifies the block and its ancestors, remembering the outcome for every visited block.
+func connectsToGenesis(db database.Database, block *types.Block, genesisHash common.Hash, known map[common.Hash]bool) bool {
+	path := make([]common.Hash, 0)
+	valid := false
+
+	for {
+		hash := block.BlockHash()
+		if result, ok := known[hash]; ok {
+			valid = result
+			break
+		}
+		path = append(path, hash)
+
+		if hash == genesisHash {
+			valid = true
+			break
+		}
+
+		parent, err := db.GetBlockByHash(block.Header.ParentHash)
+		if err != nil || verifyBlock(block, parent, genesisHash) != nil {
+			break
+		}
+		block = parent
+	}
+
+	for _, hash := range path {
+		known[hash] = valid
+	}
+	return valid
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"minchain/core/chaintest"
+	"minchain/core/types"
+	"minchain/database"
+	"testing"
+)
+
+func TestVerifyChain(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	_ = db.PutBlock(&testGenesis)
+	_ = db.SetHead(testGenesis.BlockHash())
+
+	first := childBlock(t, &testGenesis, "first")
+	second := childBlock(t, first, "second")
+	_ = db.PutBlock(first)
+	_ = db.PutBlock(second)
+	_ = db.SetHead(second.BlockHash())
+
+	report, err := VerifyChain(db, &testGenesis)
+	require.NoError(t, err)
+	require.False(t, report.IsCorrupted())
+	require.Equal(t, second.BlockHash(), report.LastGood)
+
+	// Head points at a block which was never written
+	missing := childBlock(t, second, "missing")
+	_ = db.SetHead(missing.BlockHash())
+
+	report, err = VerifyChain(db, &testGenesis)
+	require.NoError(t, err)
+	require.ErrorIs(t, report.Reason, ErrorMissingBlock)
+	require.Equal(t, int64(3), report.FirstCorruptedHeight)
+	require.Equal(t, second.BlockHash(), report.LastGood)
+
+	require.NoError(t, RepairChain(db, &testGenesis, report))
+	head, _ := db.GetHead()
+	require.Equal(t, second.BlockHash(), head)
+}
+
+func TestVerifyChainBrokenTxHash(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	_ = db.PutBlock(&testGenesis)
+
+	first := childBlock(t, &testGenesis, "first")
+	broken := childBlock(t, first, "broken")
+	broken.Header.TransactionHash = common.Hash{1}
+	third := childBlock(t, broken, "third")
+	_ = db.PutBlock(first)
+	_ = db.PutBlock(broken)
+	_ = db.PutBlock(third)
+	_ = db.SetHead(third.BlockHash())
+
+	report, err := VerifyChain(db, &testGenesis)
+	require.NoError(t, err)
+	require.ErrorIs(t, report.Reason, ErrorBrokenTxHash)
+	require.Equal(t, int64(2), report.FirstCorruptedHeight)
+	require.Equal(t, first.BlockHash(), report.LastGood)
+}
+
+func TestVerifyChainGapNextToFork(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	_ = db.PutBlock(&testGenesis)
+
+	first := childBlock(t, &testGenesis, "first")
+	missing := childBlock(t, first, "missing")
+	third := childBlock(t, missing, "third")
+	_ = db.PutBlock(first)
+	_ = db.PutBlock(third)
+	_ = db.SetHead(third.BlockHash())
+
+	// An abandoned fork which is higher than the gap and still connects to genesis
+	fork := first
+	for _, message := range []string{"fork 2", "fork 3", "fork 4"} {
+		fork = childBlock(t, fork, message)
+		_ = db.PutBlock(fork)
+	}
+
+	report, err := VerifyChain(db, &testGenesis)
+	require.NoError(t, err)
+	require.ErrorIs(t, report.Reason, ErrorMissingBlock)
+	require.Equal(t, int64(2), report.FirstCorruptedHeight)
+	require.Equal(t, first.BlockHash(), report.LastGood)
+
+	require.NoError(t, RepairChain(db, &testGenesis, report))
+	head, _ := db.GetHead()
+	require.Equal(t, first.BlockHash(), head)
+}
+
+func TestVerifyChainWrongGenesis(t *testing.T) {
+	db := database.NewMemoryDatabase()
+
+	// The whole chain comes from another network, our genesis was never stored
+	otherGenesis := testGenesis
+	otherGenesis.Header.Timestamp++
+	first := childBlock(t, &otherGenesis, "first")
+	_ = db.PutBlock(&otherGenesis)
+	_ = db.PutBlock(first)
+	_ = db.SetHead(first.BlockHash())
+
+	report, err := VerifyChain(db, &testGenesis)
+	require.NoError(t, err)
+	require.ErrorIs(t, report.Reason, ErrorUnknownGenesis)
+	require.Equal(t, int64(-1), report.LastGoodHeight)
+	require.Equal(t, int64(0), report.FirstCorruptedHeight)
+
+	require.NoError(t, RepairChain(db, &testGenesis, report))
+	head, _ := db.GetHead()
+	require.Equal(t, testGenesis.BlockHash(), head)
+	stored, err := db.GetBlockByHash(testGenesis.BlockHash())
+	require.NoError(t, err)
+	require.Equal(t, testGenesis.BlockHash(), stored.BlockHash())
+
+	report, err = VerifyChain(db, &testGenesis)
+	require.NoError(t, err)
+	require.False(t, report.IsCorrupted())
+}
+
+func childBlock(t *testing.T, parent *types.Block, message string) *types.Block {
+	return chaintest.Block(t, parent, 0, *chaintest.Tx(t, message))
+}
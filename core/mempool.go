@@ -1,45 +1,105 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"minchain/core/types"
+	"minchain/database"
+	"minchain/logging"
+	"minchain/metrics"
+	"minchain/tracing"
 	"strings"
 	"sync"
 )
 
+var (
+	mempoolLogger = logging.Logger(logging.Mempool)
+	mempoolTracer = tracing.Tracer(logging.Mempool)
+)
+
+var (
+	ErrorInvalidTransaction  = errors.New("invalid transaction")
+	ErrorIncludedTransaction = errors.New("transaction already included")
+)
+
 type Mempool interface {
-	ValidateAndStorePending(transations *types.Tx)
+	// ValidateAndStorePending adds a valid transaction to the pending set, returning why it was refused otherwise
+	ValidateAndStorePending(ctx context.Context, transations *types.Tx) error
 	ListPendingTransactions() []types.Tx
 	PruneTransactions(transactions []types.Tx)
+	// TraceLinks points to the spans which admitted the transactions, so a block's span leads to its transactions
+	TraceLinks(transactions []types.Tx) []trace.Link
 }
 
 type MemoryMempool struct {
 	lock                sync.Mutex
 	pendingTransactions map[common.Hash]*types.Tx
+	// spans are the admission spans of pending transactions which were traced
+	spans  map[common.Hash]trace.SpanContext
+	events *EventBus
+	// db finds the transactions the canonical chain already includes. Signatures only cover the data, so a signed
+	// transaction could otherwise be replayed into any later block.
+	db database.Database
 }
 
-func NewMempool() Mempool {
+func NewMempool(events *EventBus, db database.Database) Mempool {
 	return &MemoryMempool{
 		lock:                sync.Mutex{},
 		pendingTransactions: make(map[common.Hash]*types.Tx),
+		spans:               make(map[common.Hash]trace.SpanContext),
+		events:              events,
+		db:                  db,
 	}
 }
 
-func (m *MemoryMempool) ValidateAndStorePending(tx *types.Tx) {
+func (m *MemoryMempool) ValidateAndStorePending(ctx context.Context, tx *types.Tx) error {
+	_, span := mempoolTracer.Start(ctx, "mempool.admit")
+	defer span.End()
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
 	txHash, err := tx.Hash()
 	if err != nil {
-		log.Println("error getting tx hash")
-		return
+		mempoolLogger.Warn("Error hashing transaction", "err", err)
+		metrics.MempoolRejected.WithLabelValues("unhashable").Inc()
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	span.SetAttributes(attribute.String("tx.hash", txHash.Hex()))
+
+	if !IsValid(tx) {
+		metrics.MempoolRejected.WithLabelValues("invalid").Inc()
+		span.SetStatus(codes.Error, ErrorInvalidTransaction.Error())
+		return ErrorInvalidTransaction
 	}
 
-	if IsValid(tx) {
-		m.pendingTransactions[txHash] = tx
+	if _, known := m.pendingTransactions[txHash]; known {
+		span.SetAttributes(attribute.Bool("tx.known", true))
+		return nil
 	}
+
+	if _, err := m.db.GetTransactionBlock(txHash); err == nil {
+		metrics.MempoolRejected.WithLabelValues("included").Inc()
+		span.SetStatus(codes.Error, ErrorIncludedTransaction.Error())
+		return ErrorIncludedTransaction
+	} else if !errors.Is(err, database.ErrorTransactionNotFound) {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	m.pendingTransactions[txHash] = tx
+	if spanContext := span.SpanContext(); spanContext.IsSampled() {
+		m.spans[txHash] = spanContext
+	}
+	metrics.MempoolAdmitted.Inc()
+	metrics.MempoolSize.Set(float64(len(m.pendingTransactions)))
+	m.events.TxAdded.Publish(TxAdded{Hash: txHash, Tx: *tx})
+	return nil
 }
 
 func IsValid(tx *types.Tx) bool {
@@ -48,14 +108,14 @@ func IsValid(tx *types.Tx) bool {
 	}
 
 	if len(tx.Signature) != 65 {
-		log.Println("Invalid signature length")
+		mempoolLogger.Debug("Invalid signature length", "length", len(tx.Signature))
 		return false
 	}
 
 	digest := crypto.Keccak256([]byte(tx.Data))
 	publicKey, err := crypto.Ecrecover(digest, tx.Signature)
 	if err != nil {
-		log.Println("publicKey error")
+		mempoolLogger.Debug("Error recovering the public key", "err", err)
 		return false
 	}
 
@@ -65,6 +125,13 @@ func IsValid(tx *types.Tx) bool {
 		return false
 	}
 
+	// Anyone can submit signed transactions, so the sender has to be the signer
+	signer, err := crypto.UnmarshalPubkey(publicKey)
+	if err != nil || !common.IsHexAddress(tx.From) || crypto.PubkeyToAddress(*signer) != common.HexToAddress(tx.From) {
+		mempoolLogger.Debug("Sender doesn't match the signature", "from", tx.From)
+		return false
+	}
+
 	return true
 }
 
@@ -88,6 +155,29 @@ func (m *MemoryMempool) PruneTransactions(transactions []types.Tx) {
 		if err != nil {
 			continue
 		}
+		if _, ok := m.pendingTransactions[hash]; !ok {
+			continue
+		}
 		delete(m.pendingTransactions, hash)
+		delete(m.spans, hash)
+		metrics.MempoolSize.Set(float64(len(m.pendingTransactions)))
+		m.events.TxDropped.Publish(TxDropped{Hash: hash, Reason: DropIncluded})
+	}
+}
+
+func (m *MemoryMempool) TraceLinks(transactions []types.Tx) []trace.Link {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var links []trace.Link
+	for _, t := range transactions {
+		hash, err := t.Hash()
+		if err != nil {
+			continue
+		}
+		if spanContext, ok := m.spans[hash]; ok {
+			links = append(links, trace.Link{SpanContext: spanContext})
+		}
 	}
+	return links
 }
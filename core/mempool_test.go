@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/metrics"
+	"testing"
+)
+
+func TestMempoolMetrics(t *testing.T) {
+	admitted := testutil.ToFloat64(metrics.MempoolAdmitted)
+	rejected := testutil.ToFloat64(metrics.MempoolRejected.WithLabelValues("invalid"))
+
+	mempool := NewMempool(NewEventBus(), database.NewMemoryDatabase())
+	block := childBlock(t, &testGenesis, "hello")
+	require.NoError(t, mempool.ValidateAndStorePending(context.Background(), &block.Transactions[0]))
+	require.ErrorIs(t, mempool.ValidateAndStorePending(context.Background(), &types.Tx{Data: "unsigned"}), ErrorInvalidTransaction)
+
+	require.Equal(t, admitted+1, testutil.ToFloat64(metrics.MempoolAdmitted))
+	require.Equal(t, rejected+1, testutil.ToFloat64(metrics.MempoolRejected.WithLabelValues("invalid")))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.MempoolSize))
+
+	mempool.PruneTransactions(block.Transactions)
+	require.Equal(t, float64(0), testutil.ToFloat64(metrics.MempoolSize))
+}
+
+func TestMempoolTraceLinks(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	mempool := NewMempool(NewEventBus(), database.NewMemoryDatabase())
+	block := childBlock(t, &testGenesis, "hello")
+	require.NoError(t, mempool.ValidateAndStorePending(context.Background(), &block.Transactions[0]))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "mempool.admit", spans[0].Name())
+
+	links := mempool.TraceLinks(block.Transactions)
+	require.Len(t, links, 1)
+	require.Equal(t, spans[0].SpanContext(), links[0].SpanContext)
+
+	mempool.PruneTransactions(block.Transactions)
+	require.Empty(t, mempool.TraceLinks(block.Transactions))
+}
+
+func TestMempoolRejectsIncludedTransactions(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	block := childBlock(t, &testGenesis, "hello")
+	require.NoError(t, db.PutBlock(&testGenesis))
+	require.NoError(t, db.PutBlock(block))
+
+	// Only once the block is canonical
+	mempool := NewMempool(NewEventBus(), db)
+	tx := block.Transactions[0]
+	require.NoError(t, mempool.ValidateAndStorePending(context.Background(), &tx))
+	mempool.PruneTransactions(block.Transactions)
+
+	require.NoError(t, db.SetHead(block.BlockHash()))
+	require.ErrorIs(t, mempool.ValidateAndStorePending(context.Background(), &tx), ErrorIncludedTransaction)
+	require.Empty(t, mempool.ListPendingTransactions())
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"minchain/database"
+)
+
+var ErrorNoCommonAncestor = errors.New("chains have no common ancestor")
+
+// NewReorg walks both chains back until they meet
+func NewReorg(db database.Database, oldHead common.Hash, newHead common.Hash) (Reorg, error) {
+	reorg := Reorg{OldHead: oldHead, NewHead: newHead}
+
+	old, err := db.GetBlockByHash(oldHead)
+	if err != nil {
+		return reorg, err
+	}
+	current, err := db.GetBlockByHash(newHead)
+	if err != nil {
+		return reorg, err
+	}
+
+	for old.BlockHash() != current.BlockHash() {
+		if old.Header.Height == 0 && current.Header.Height == 0 {
+			return reorg, ErrorNoCommonAncestor
+		}
+		if old.Header.Height >= current.Header.Height {
+			reorg.Depth++
+			old, err = db.GetBlockByHash(old.Header.ParentHash)
+		} else {
+			current, err = db.GetBlockByHash(current.Header.ParentHash)
+		}
+		if err != nil {
+			return reorg, err
+		}
+	}
+
+	reorg.CommonAncestor = old.BlockHash()
+	return reorg, nil
+}
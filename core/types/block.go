@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"time"
 )
 
 type Block struct {
@@ -16,10 +17,15 @@ type BlockHeader struct {
 	ParentHash      common.Hash `json:"parentHash"`
 	TransactionHash common.Hash `json:"transactionHash"`
 	Height          int64       `json:"height"`
+	// Timestamp is when the block was produced, in Unix milliseconds
+	Timestamp int64 `json:"timestamp"`
+	// Extra is only set on the genesis block, where it commits to the genesis spec
+	Extra []byte `json:"extra,omitempty"`
 }
 
+// BlockHash is keccak256 of the canonical header serialization, see BlockHeader.CanonicalBytes
 func (block *Block) BlockHash() common.Hash {
-	headerBytes, err := json.Marshal(block.Header)
+	headerBytes, err := block.Header.CanonicalBytes()
 	if err != nil {
 		return common.Hash{}
 	}
@@ -27,6 +33,10 @@ func (block *Block) BlockHash() common.Hash {
 	return common.BytesToHash(crypto.Keccak256(headerBytes))
 }
 
+func (block *Block) Time() time.Time {
+	return time.UnixMilli(block.Header.Timestamp)
+}
+
 func (block *Block) ToJson() ([]byte, error) {
 	return json.Marshal(block)
 }
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ShortTxID identifies a transaction inside a compact block, it's the first 8 bytes of the transaction hash
+type ShortTxID [8]byte
+
+func (id ShortTxID) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(id[:]).MarshalText()
+}
+
+func (id *ShortTxID) UnmarshalText(input []byte) error {
+	return hexutil.UnmarshalFixedText("ShortTxID", input, id[:])
+}
+
+func (t *Tx) ShortID() (ShortTxID, error) {
+	hash, err := t.Hash()
+	if err != nil {
+		return ShortTxID{}, err
+	}
+	var id ShortTxID
+	copy(id[:], hash[:len(id)])
+	return id, nil
+}
+
+// CompactBlock announces a block by its header and the short IDs of its transactions. Peers almost always have
+// the transactions in their mempool already, so they rebuild the block and only fetch the ones they're missing.
+type CompactBlock struct {
+	Header   BlockHeader `json:"blockHeader"`
+	ShortIDs []ShortTxID `json:"shortIds"`
+}
+
+type rlpCompactBlock struct {
+	Header   rlpHeader
+	ShortIDs []ShortTxID
+}
+
+func NewCompactBlock(block *Block) (*CompactBlock, error) {
+	compact := &CompactBlock{
+		Header:   block.Header,
+		ShortIDs: make([]ShortTxID, 0, len(block.Transactions)),
+	}
+	for i := range block.Transactions {
+		id, err := block.Transactions[i].ShortID()
+		if err != nil {
+			return nil, err
+		}
+		compact.ShortIDs = append(compact.ShortIDs, id)
+	}
+	return compact, nil
+}
+
+func (c *CompactBlock) BlockHash() common.Hash {
+	block := Block{Header: c.Header}
+	return block.BlockHash()
+}
+
+func (c *CompactBlock) ToJson() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func CompactBlockFromJson(data []byte) (*CompactBlock, error) {
+	var c CompactBlock
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *CompactBlock) ToBinary() ([]byte, error) {
+	if err := c.Header.checkUnsigned(); err != nil {
+		return nil, err
+	}
+
+	payload, err := rlp.EncodeToBytes(rlpCompactBlock{Header: toRlpHeader(&c.Header), ShortIDs: c.ShortIDs})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{EncodingVersionRLP}, payload...), nil
+}
+
+func CompactBlockFromBinary(data []byte) (*CompactBlock, error) {
+	payload, err := binaryPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded rlpCompactBlock
+	if err := rlp.DecodeBytes(payload, &decoded); err != nil {
+		return nil, err
+	}
+	header, err := fromRlpHeader(decoded.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompactBlock{
+		Header:   header,
+		ShortIDs: append(make([]ShortTxID, 0, len(decoded.ShortIDs)), decoded.ShortIDs...),
+	}, nil
+}
@@ -0,0 +1,199 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"math"
+)
+
+// Binary encoding is a version byte followed by the RLP of the value. It's used on the wire and in the database,
+// JSON stays for the HTTP API.
+const (
+	EncodingVersionRLP byte = 0x01
+	// jsonPrefix is how legacy JSON encoded values start, it can never clash with a version byte
+	jsonPrefix byte = '{'
+)
+
+var ErrorUnknownEncoding = errors.New("unknown encoding version")
+
+type rlpTx struct {
+	From      string
+	Data      string
+	Signature []byte
+}
+
+type rlpHeader struct {
+	ParentHash      common.Hash
+	TransactionHash common.Hash
+	Height          uint64
+	Timestamp       uint64
+	Extra           []byte
+}
+
+type rlpBlock struct {
+	Header       rlpHeader
+	Transactions []rlpTx
+}
+
+func (t *Tx) ToBinary() ([]byte, error) {
+	payload, err := rlp.EncodeToBytes(toRlpTx(t))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{EncodingVersionRLP}, payload...), nil
+}
+
+func TransactionFromBinary(data []byte) (*Tx, error) {
+	payload, err := binaryPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded rlpTx
+	if err := rlp.DecodeBytes(payload, &decoded); err != nil {
+		return nil, err
+	}
+	return fromRlpTx(decoded), nil
+}
+
+func (block *Block) ToBinary() ([]byte, error) {
+	if err := block.Header.checkUnsigned(); err != nil {
+		return nil, err
+	}
+
+	encoded := rlpBlock{
+		Header:       toRlpHeader(&block.Header),
+		Transactions: make([]rlpTx, 0, len(block.Transactions)),
+	}
+	for i := range block.Transactions {
+		encoded.Transactions = append(encoded.Transactions, toRlpTx(&block.Transactions[i]))
+	}
+
+	payload, err := rlp.EncodeToBytes(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{EncodingVersionRLP}, payload...), nil
+}
+
+func BlockFromBinary(data []byte) (*Block, error) {
+	payload, err := binaryPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded rlpBlock
+	if err := rlp.DecodeBytes(payload, &decoded); err != nil {
+		return nil, err
+	}
+	header, err := fromRlpHeader(decoded.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &Block{
+		Header:       header,
+		Transactions: make([]Tx, 0, len(decoded.Transactions)),
+	}
+	for _, tx := range decoded.Transactions {
+		block.Transactions = append(block.Transactions, *fromRlpTx(tx))
+	}
+	return block, nil
+}
+
+func (h *BlockHeader) ToBinary() ([]byte, error) {
+	payload, err := h.CanonicalBytes()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{EncodingVersionRLP}, payload...), nil
+}
+
+func HeaderFromBinary(data []byte) (*BlockHeader, error) {
+	payload, err := binaryPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded rlpHeader
+	if err := rlp.DecodeBytes(payload, &decoded); err != nil {
+		return nil, err
+	}
+	header, err := fromRlpHeader(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// DecodeBlock reads a block stored in either the binary or the legacy JSON encoding
+func DecodeBlock(data []byte) (*Block, error) {
+	if len(data) > 0 && data[0] == jsonPrefix {
+		return BlockFromJson(data)
+	}
+	return BlockFromBinary(data)
+}
+
+func binaryPayload(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+	if data[0] != EncodingVersionRLP {
+		return nil, fmt.Errorf("%w: %d", ErrorUnknownEncoding, data[0])
+	}
+	return data[1:], nil
+}
+
+// checkUnsigned rejects the values the unsigned RLP integers can't hold
+func (h *BlockHeader) checkUnsigned() error {
+	if h.Height < 0 {
+		return fmt.Errorf("negative block height %d", h.Height)
+	}
+	if h.Timestamp < 0 {
+		return fmt.Errorf("negative block timestamp %d", h.Timestamp)
+	}
+	return nil
+}
+
+func toRlpHeader(h *BlockHeader) rlpHeader {
+	return rlpHeader{
+		ParentHash:      h.ParentHash,
+		TransactionHash: h.TransactionHash,
+		Height:          uint64(h.Height),
+		Timestamp:       uint64(h.Timestamp),
+		Extra:           h.Extra,
+	}
+}
+
+func fromRlpHeader(h rlpHeader) (BlockHeader, error) {
+	if h.Height > math.MaxInt64 {
+		return BlockHeader{}, fmt.Errorf("block height %d out of range", h.Height)
+	}
+	if h.Timestamp > math.MaxInt64 {
+		return BlockHeader{}, fmt.Errorf("block timestamp %d out of range", h.Timestamp)
+	}
+	return BlockHeader{
+		ParentHash:      h.ParentHash,
+		TransactionHash: h.TransactionHash,
+		Height:          int64(h.Height),
+		Timestamp:       int64(h.Timestamp),
+		Extra:           nilIfEmpty(h.Extra),
+	}, nil
+}
+
+func toRlpTx(t *Tx) rlpTx {
+	return rlpTx{From: t.From, Data: t.Data, Signature: t.Signature}
+}
+
+func fromRlpTx(t rlpTx) *Tx {
+	return &Tx{From: t.From, Data: t.Data, Signature: nilIfEmpty(t.Signature)}
+}
+
+func nilIfEmpty(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
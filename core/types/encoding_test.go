@@ -0,0 +1,151 @@
+package types
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testBlock() *Block {
+	txs := []Tx{
+		{From: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", Data: "hello", Signature: make([]byte, 65)},
+		{From: "0x70997970C51812dc3A010C7d01b50e0d17dc79C8", Data: "world", Signature: make([]byte, 65)},
+	}
+	txHash, _ := CombinedHash(txs)
+	return &Block{
+		Header: BlockHeader{
+			ParentHash:      common.HexToHash("0x01"),
+			TransactionHash: txHash,
+			Height:          42,
+		},
+		Transactions: txs,
+	}
+}
+
+func TestTransactionBinaryRoundTrip(t *testing.T) {
+	tx := testBlock().Transactions[0]
+
+	data, err := tx.ToBinary()
+	require.NoError(t, err)
+	require.Equal(t, EncodingVersionRLP, data[0])
+
+	decoded, err := TransactionFromBinary(data)
+	require.NoError(t, err)
+	require.Equal(t, tx, *decoded)
+
+	expected, _ := tx.Hash()
+	actual, _ := decoded.Hash()
+	require.Equal(t, expected, actual)
+}
+
+func TestBlockBinaryRoundTrip(t *testing.T) {
+	block := testBlock()
+
+	data, err := block.ToBinary()
+	require.NoError(t, err)
+
+	decoded, err := BlockFromBinary(data)
+	require.NoError(t, err)
+	require.Equal(t, block, decoded)
+	require.Equal(t, block.BlockHash(), decoded.BlockHash())
+}
+
+func TestHeaderBinaryRoundTrip(t *testing.T) {
+	header := testBlock().Header
+	header.Extra = []byte("extra")
+
+	data, err := header.ToBinary()
+	require.NoError(t, err)
+	require.Equal(t, EncodingVersionRLP, data[0])
+
+	decoded, err := HeaderFromBinary(data)
+	require.NoError(t, err)
+	require.Equal(t, header, *decoded)
+}
+
+func TestDecodeBlockReadsLegacyJson(t *testing.T) {
+	block := testBlock()
+
+	data, err := block.ToJson()
+	require.NoError(t, err)
+
+	decoded, err := DecodeBlock(data)
+	require.NoError(t, err)
+	require.Equal(t, block.BlockHash(), decoded.BlockHash())
+}
+
+func TestBlockFromBinaryUnknownVersion(t *testing.T) {
+	data, err := testBlock().ToBinary()
+	require.NoError(t, err)
+	data[0] = 0x7f
+
+	_, err = BlockFromBinary(data)
+	require.ErrorIs(t, err, ErrorUnknownEncoding)
+}
+
+func FuzzBlockFromBinary(f *testing.F) {
+	data, _ := testBlock().ToBinary()
+	f.Add(data)
+	f.Add([]byte{EncodingVersionRLP})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		block, err := BlockFromBinary(data)
+		if err != nil {
+			return
+		}
+		encoded, err := block.ToBinary()
+		require.NoError(t, err)
+		again, err := BlockFromBinary(encoded)
+		require.NoError(t, err)
+		require.Equal(t, block.BlockHash(), again.BlockHash())
+	})
+}
+
+func FuzzTransactionFromBinary(f *testing.F) {
+	data, _ := testBlock().Transactions[0].ToBinary()
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx, err := TransactionFromBinary(data)
+		if err != nil {
+			return
+		}
+		encoded, err := tx.ToBinary()
+		require.NoError(t, err)
+		again, err := TransactionFromBinary(encoded)
+		require.NoError(t, err)
+		require.Equal(t, tx, again)
+	})
+}
+
+func BenchmarkBlockEncodeJson(b *testing.B) {
+	block := testBlock()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, _ := block.ToJson()
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes")
+}
+
+func BenchmarkBlockEncodeBinary(b *testing.B) {
+	block := testBlock()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, _ := block.ToBinary()
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes")
+}
+
+func BenchmarkBlockDecodeJson(b *testing.B) {
+	data, _ := testBlock().ToJson()
+	for i := 0; i < b.N; i++ {
+		_, _ = BlockFromJson(data)
+	}
+}
+
+func BenchmarkBlockDecodeBinary(b *testing.B) {
+	data, _ := testBlock().ToBinary()
+	for i := 0; i < b.N; i++ {
+		_, _ = BlockFromBinary(data)
+	}
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Hashes are computed over a canonical serialization instead of JSON, so any client with an RLP library
+// (https://ethereum.org/en/developers/docs/data-structures-and-encoding/rlp/) can reproduce them.
+//
+// Transaction: RLP list [from, data, sig]
+//   - from: UTF-8 bytes of the From string exactly as signed, e.g. "0xf39F..." (no case normalization)
+//   - data: UTF-8 bytes of Data
+//   - sig:  65 signature bytes, an empty string when unsigned
+//
+// Block header: RLP list [parentHash, transactionHash, height, timestamp, extra]
+//   - parentHash, transactionHash: 32 byte strings
+//   - height: unsigned integer, minimal big-endian without leading zeros (0 encodes as 0x80)
+//   - timestamp: Unix milliseconds, unsigned integer encoded like height
+//   - extra: byte string, empty when unset
+//
+// The hash is keccak256 of these bytes.
+//
+// Transaction root, the header's transactionHash (see CombinedHash): keccak256 of the 32 byte transaction hashes
+// concatenated in block order, without RLP or length prefixes. A block without transactions has keccak256 of the
+// empty string, 0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470.
+//
+// Test vectors of all three are in testdata/hash_vectors.json, next to those of the genesis spec encoding (see
+// genesis.Genesis.CanonicalBytes).
+
+// CanonicalBytes is the transaction serialization its hash is computed over
+func (t *Tx) CanonicalBytes() ([]byte, error) {
+	return rlp.EncodeToBytes(toRlpTx(t))
+}
+
+// CanonicalBytes is the header serialization the block hash is computed over
+func (h *BlockHeader) CanonicalBytes() ([]byte, error) {
+	if err := h.checkUnsigned(); err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(toRlpHeader(h))
+}
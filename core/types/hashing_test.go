@@ -0,0 +1,99 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+type hashVectors struct {
+	Transactions []struct {
+		Name      string        `json:"name"`
+		From      string        `json:"from"`
+		Data      string        `json:"data"`
+		Sig       hexutil.Bytes `json:"sig"`
+		Canonical hexutil.Bytes `json:"canonical"`
+		Hash      common.Hash   `json:"hash"`
+	} `json:"transactions"`
+	Headers []struct {
+		Name            string        `json:"name"`
+		ParentHash      common.Hash   `json:"parentHash"`
+		TransactionHash common.Hash   `json:"transactionHash"`
+		Height          int64         `json:"height"`
+		Timestamp       int64         `json:"timestamp"`
+		Extra           hexutil.Bytes `json:"extra"`
+		Canonical       hexutil.Bytes `json:"canonical"`
+		Hash            common.Hash   `json:"hash"`
+	} `json:"headers"`
+	TransactionRoots []struct {
+		Name         string      `json:"name"`
+		Transactions []string    `json:"transactions"`
+		Hash         common.Hash `json:"hash"`
+	} `json:"transactionRoots"`
+}
+
+func TestHashVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/hash_vectors.json")
+	require.NoError(t, err)
+	var vectors hashVectors
+	require.NoError(t, json.Unmarshal(data, &vectors))
+
+	for _, v := range vectors.Transactions {
+		t.Run(v.Name, func(t *testing.T) {
+			tx := Tx{From: v.From, Data: v.Data, Signature: v.Sig}
+
+			canonical, err := tx.CanonicalBytes()
+			require.NoError(t, err)
+			require.Equal(t, []byte(v.Canonical), canonical)
+
+			hash, err := tx.Hash()
+			require.NoError(t, err)
+			require.Equal(t, v.Hash, hash)
+		})
+	}
+
+	for _, v := range vectors.Headers {
+		t.Run(v.Name, func(t *testing.T) {
+			block := Block{Header: BlockHeader{
+				ParentHash:      v.ParentHash,
+				TransactionHash: v.TransactionHash,
+				Height:          v.Height,
+				Timestamp:       v.Timestamp,
+				Extra:           v.Extra,
+			}}
+
+			canonical, err := block.Header.CanonicalBytes()
+			require.NoError(t, err)
+			require.Equal(t, []byte(v.Canonical), canonical)
+			require.Equal(t, v.Hash, block.BlockHash())
+		})
+	}
+
+	byName := make(map[string]Tx)
+	for _, v := range vectors.Transactions {
+		byName[v.Name] = Tx{From: v.From, Data: v.Data, Signature: v.Sig}
+	}
+	for _, v := range vectors.TransactionRoots {
+		t.Run(v.Name, func(t *testing.T) {
+			txs := make([]Tx, 0, len(v.Transactions))
+			for _, name := range v.Transactions {
+				txs = append(txs, byName[name])
+			}
+
+			hash, err := CombinedHash(txs)
+			require.NoError(t, err)
+			require.Equal(t, v.Hash, hash)
+		})
+	}
+}
+
+func TestHashIgnoresJsonEscaping(t *testing.T) {
+	// json.Marshal escapes <>& so a JSON based hash differed from what other encoders produce
+	tx := Tx{From: "0x01", Data: "<&>"}
+	canonical, err := tx.CanonicalBytes()
+	require.NoError(t, err)
+	require.Contains(t, string(canonical), "<&>")
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
@@ -14,6 +15,20 @@ type Tx struct {
 	Signature []byte `json:"sig"`
 }
 
+// SignTx signs data with the key, the signature is over keccak256 of the data
+func SignTx(pk *ecdsa.PrivateKey, data string) (*Tx, error) {
+	signature, err := crypto.Sign(crypto.Keccak256([]byte(data)), pk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{
+		From:      crypto.PubkeyToAddress(pk.PublicKey).String(),
+		Data:      data,
+		Signature: signature,
+	}, nil
+}
+
 // ToJson serializes the Transaction to JSON
 func (t *Tx) ToJson() ([]byte, error) {
 	return json.Marshal(t)
@@ -37,8 +52,9 @@ func (t *Tx) PrettyPrint() string {
 	return string(jsonData)
 }
 
+// HashBytes is keccak256 of the canonical serialization, see CanonicalBytes
 func (t *Tx) HashBytes() ([]byte, error) {
-	serialized, err := t.ToJson()
+	serialized, err := t.CanonicalBytes()
 	if err != nil {
 		return []byte{}, err
 	}
@@ -53,6 +69,7 @@ func (t *Tx) Hash() (common.Hash, error) {
 	return common.BytesToHash(txBytes), nil
 }
 
+// CombinedHash is the transaction root a header commits to, see hashing.go for how it's built
 func CombinedHash(txs []Tx) (common.Hash, error) {
 	buffer := bytes.Buffer{}
 	for _, tx := range txs {
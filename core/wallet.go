@@ -2,7 +2,6 @@ package core
 
 import (
 	"crypto/ecdsa"
-	crypto "github.com/ethereum/go-ethereum/crypto"
 	"minchain/core/types"
 )
 
@@ -15,17 +14,5 @@ func NewWallet(pk *ecdsa.PrivateKey) *Wallet {
 }
 
 func (w *Wallet) SignedTransaction(message string) (*types.Tx, error) {
-	from := crypto.PubkeyToAddress(w.privateKey.PublicKey)
-	digest := crypto.Keccak256([]byte(message))
-
-	expectSig, err := crypto.Sign(digest, w.privateKey)
-	if err != nil {
-		return nil, err
-	}
-
-	return &types.Tx{
-		From:      from.String(),
-		Data:      message,
-		Signature: expectSig,
-	}, nil
+	return types.SignTx(w.privateKey, message)
 }
@@ -1,28 +1,77 @@
 package database
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/ethereum/go-ethereum/common"
 	"minchain/core/types"
+	"minchain/logging"
+	"minchain/metrics"
+	"time"
 )
 
-var badgerFilePath = "/tmp/badger"
+var logger = logging.Logger(logging.Db)
+
 var chainHeadKey = []byte("chain_head")
+var genesisKey = []byte("genesis_hash")
+
+// Index keys are longer than a hash, so ForEachBlock doesn't take them for blocks
+var (
+	heightPrefix = []byte("height/")
+	txPrefix     = []byte("tx/")
+)
+
+func heightKey(height int64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, heightPrefix...), uint64(height))
+}
+
+func txKey(hash common.Hash) []byte {
+	return append(append([]byte{}, txPrefix...), hash.Bytes()...)
+}
 
 type DiskDatabase struct {
 	inner *badger.DB
 }
 
-func NewDiskDatabase() (Database, error) {
-	open, err := badger.Open(badger.DefaultOptions(badgerFilePath))
+func NewDiskDatabase(path string) (Database, error) {
+	open, err := badger.Open(badger.DefaultOptions(path))
 	if err != nil {
 		return nil, err
 	}
-	return &DiskDatabase{inner: open}, nil
+	db := &DiskDatabase{inner: open}
+	db.reportSize()
+
+	// Databases written before the indexes existed get them on the first open, later opens only check the top
+	if head, err := db.GetHead(); err == nil {
+		if err := updateCanonical(diskIndex{db}, head); err != nil {
+			_ = open.Close()
+			return nil, fmt.Errorf("indexing the chain: %w", err)
+		}
+	}
+	return db, nil
+}
+
+// observe records how long an operation took, meant to be deferred
+func observe(operation string, start time.Time) {
+	metrics.ObserveSince(metrics.DatabaseOperationDuration.WithLabelValues(operation), start)
+}
+
+// reportSize exports the size of the LSM tree and the value log. Badger refreshes them periodically, so they can
+// lag behind the latest writes.
+func (db *DiskDatabase) reportSize() {
+	lsm, vlog := db.inner.Size()
+	metrics.DatabaseSize.WithLabelValues("lsm").Set(float64(lsm))
+	metrics.DatabaseSize.WithLabelValues("vlog").Set(float64(vlog))
 }
 
 func (db *DiskDatabase) SetHead(blockHash common.Hash) error {
+	defer observe("set_head", time.Now())
+	// The indexes go first, an interrupted update is picked up on the next open
+	if err := updateCanonical(diskIndex{db}, blockHash); err != nil {
+		return err
+	}
 	return db.inner.Update(func(txn *badger.Txn) error {
 		err := txn.Set(chainHeadKey, blockHash.Bytes())
 		if err != nil {
@@ -33,21 +82,32 @@ func (db *DiskDatabase) SetHead(blockHash common.Hash) error {
 }
 
 func (db *DiskDatabase) GetHead() (common.Hash, error) {
-	var bytes []byte
+	defer observe("get_head", time.Now())
+	return db.getHash(chainHeadKey, ErrorHeadBlockNotSet)
+}
+
+func (db *DiskDatabase) SetGenesis(genesisHash common.Hash) error {
+	defer observe("set_genesis", time.Now())
+	return db.inner.Update(func(txn *badger.Txn) error {
+		return txn.Set(genesisKey, genesisHash.Bytes())
+	})
+}
+
+func (db *DiskDatabase) GetGenesis() (common.Hash, error) {
+	defer observe("get_genesis", time.Now())
+	return db.getHash(genesisKey, ErrorGenesisNotSet)
+}
+
+// getHash reads a hash stored under key, returning errNotSet if there is none
+func (db *DiskDatabase) getHash(key []byte, errNotSet error) (common.Hash, error) {
+	var hash common.Hash
 
 	err := db.inner.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(chainHeadKey)
-		if err != nil {
-			if errors.Is(err, badger.ErrKeyNotFound) {
-				return ErrorHeadBlockNotSet
-			} else {
-				return err
-			}
+		var err error
+		hash, err = db.getHashIn(txn, key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return errNotSet
 		}
-		err = item.Value(func(val []byte) error {
-			bytes = val
-			return nil
-		})
 		return err
 	})
 
@@ -55,17 +115,32 @@ func (db *DiskDatabase) GetHead() (common.Hash, error) {
 		return common.Hash{}, err
 	}
 
-	return common.BytesToHash(bytes), nil
+	return hash, nil
+}
+
+func (db *DiskDatabase) getHashIn(txn *badger.Txn, key []byte) (common.Hash, error) {
+	item, err := txn.Get(key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var hash common.Hash
+	err = item.Value(func(val []byte) error {
+		hash = common.BytesToHash(val)
+		return nil
+	})
+	return hash, err
 }
 
 func (db *DiskDatabase) PutBlock(block *types.Block) error {
-	blockJson, err := block.ToJson()
+	defer observe("put_block", time.Now())
+	blockBytes, err := block.ToBinary()
 	if err != nil {
 		return err
 	}
 
+	defer db.reportSize()
 	return db.inner.Update(func(txn *badger.Txn) error {
-		err := txn.Set(block.BlockHash().Bytes(), blockJson)
+		err := txn.Set(block.BlockHash().Bytes(), blockBytes)
 		if err != nil {
 			return err
 		}
@@ -74,6 +149,7 @@ func (db *DiskDatabase) PutBlock(block *types.Block) error {
 }
 
 func (db *DiskDatabase) GetBlockByHash(hash common.Hash) (*types.Block, error) {
+	defer observe("get_block", time.Now())
 	var bytes []byte
 
 	err := db.inner.View(func(txn *badger.Txn) error {
@@ -96,7 +172,118 @@ func (db *DiskDatabase) GetBlockByHash(hash common.Hash) (*types.Block, error) {
 		return nil, err
 	}
 
-	return types.BlockFromJson(bytes)
+	// Blocks written before the binary encoding are still JSON
+	block, err := types.DecodeBlock(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrorCorruptedBlock, err)
+	}
+	return block, nil
+}
+
+func (db *DiskDatabase) ForEachBlock(fn func(block *types.Block) error) error {
+	defer observe("for_each_block", time.Now())
+	return db.inner.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			// Blocks are keyed by their hash, anything else (e.g. chain_head) is not a block
+			if len(item.Key()) != common.HashLength {
+				continue
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			block, err := types.DecodeBlock(value)
+			if err != nil {
+				logger.Warn("Skipping undecodable block", "key", fmt.Sprintf("%x", item.Key()), "err", err)
+				continue
+			}
+
+			if err := fn(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *DiskDatabase) GetCanonicalHash(height int64) (common.Hash, error) {
+	defer observe("get_canonical_hash", time.Now())
+	return db.getHash(heightKey(height), ErrorBlockNotFound)
+}
+
+func (db *DiskDatabase) GetTransactionBlock(txHash common.Hash) (common.Hash, error) {
+	defer observe("get_transaction_block", time.Now())
+	return db.getHash(txKey(txHash), ErrorTransactionNotFound)
+}
+
+// diskIndex is the indexStore of a DiskDatabase, every change is its own transaction so long chains can be indexed
+type diskIndex struct {
+	db *DiskDatabase
+}
+
+func (d diskIndex) block(hash common.Hash) (*types.Block, error) {
+	block, err := d.db.GetBlockByHash(hash)
+	if errors.Is(err, ErrorCorruptedBlock) {
+		// As good as missing, chain verification deals with it
+		return nil, fmt.Errorf("%w: %v", ErrorBlockNotFound, err)
+	}
+	return block, err
+}
+
+func (d diskIndex) canonicalHash(height int64) (common.Hash, error) {
+	return d.db.getHash(heightKey(height), ErrorBlockNotFound)
+}
+
+func (d diskIndex) index(block *types.Block) error {
+	hash := block.BlockHash()
+	return d.db.inner.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(heightKey(block.Header.Height), hash.Bytes()); err != nil {
+			return err
+		}
+		for _, tx := range block.Transactions {
+			txHash, err := tx.Hash()
+			if err != nil {
+				continue
+			}
+			if err := txn.Set(txKey(txHash), hash.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d diskIndex) unindex(height int64, block *types.Block) error {
+	return d.db.inner.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(heightKey(height)); err != nil {
+			return err
+		}
+		if block == nil {
+			return nil
+		}
+		hash := block.BlockHash()
+		for _, tx := range block.Transactions {
+			txHash, err := tx.Hash()
+			if err != nil {
+				continue
+			}
+			// The transaction may be in a canonical block too, e.g. after a reorg
+			indexed, err := d.db.getHashIn(txn, txKey(txHash))
+			if err != nil || indexed != hash {
+				continue
+			}
+			if err := txn.Delete(txKey(txHash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (db *DiskDatabase) Close() error {
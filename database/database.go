@@ -4,39 +4,70 @@ import (
 	"errors"
 	"github.com/ethereum/go-ethereum/common"
 	"minchain/core/types"
+	"sync"
 )
 
 var ErrorHeadBlockNotSet = errors.New("head block not set")
-var ErrorBlockNotFound = errors.New("head block not set")
+var ErrorBlockNotFound = errors.New("block not found")
+var ErrorCorruptedBlock = errors.New("corrupted block")
+var ErrorGenesisNotSet = errors.New("genesis not set")
 
 type Database interface {
 	SetHead(blockHash common.Hash) error
 	GetHead() (common.Hash, error)
+	SetGenesis(genesisHash common.Hash) error
+	GetGenesis() (common.Hash, error)
 	PutBlock(block *types.Block) error
 	GetBlockByHash(hash common.Hash) (*types.Block, error)
+	// GetCanonicalHash returns the hash of the canonical block at height, ErrorBlockNotFound above the head
+	GetCanonicalHash(height int64) (common.Hash, error)
+	// GetTransactionBlock returns the hash of the canonical block which includes the transaction,
+	// ErrorTransactionNotFound if none does
+	GetTransactionBlock(txHash common.Hash) (common.Hash, error)
+	// ForEachBlock calls fn for every stored block, in no particular order. Entries which can't be decoded are skipped.
+	ForEachBlock(fn func(block *types.Block) error) error
 	Close() error
 }
 
+// MemoryDatabase is safe for concurrent use, in-process test networks run many services against it
 type MemoryDatabase struct {
+	lock      sync.RWMutex
 	blocks    map[common.Hash]*types.Block
 	headBlock common.Hash
+	genesis   common.Hash
+	// heights and txs index the canonical chain
+	heights map[int64]common.Hash
+	txs     map[common.Hash]common.Hash
 }
 
 func NewMemoryDatabase() Database {
-	return &MemoryDatabase{blocks: make(map[common.Hash]*types.Block)}
+	return &MemoryDatabase{
+		blocks:  make(map[common.Hash]*types.Block),
+		heights: make(map[int64]common.Hash),
+		txs:     make(map[common.Hash]common.Hash),
+	}
 }
 
 func (db *MemoryDatabase) PutBlock(block *types.Block) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	db.blocks[block.BlockHash()] = block
 	return nil
 }
 
 func (db *MemoryDatabase) SetHead(blockHash common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if err := updateCanonical(memoryIndex{db}, blockHash); err != nil {
+		return err
+	}
 	db.headBlock = blockHash
 	return nil
 }
 
 func (db *MemoryDatabase) GetHead() (common.Hash, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
 	var zeroHash common.Hash
 	if db.headBlock == zeroHash {
 		return zeroHash, ErrorHeadBlockNotSet
@@ -45,7 +76,27 @@ func (db *MemoryDatabase) GetHead() (common.Hash, error) {
 	return db.headBlock, nil
 }
 
+func (db *MemoryDatabase) SetGenesis(genesisHash common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.genesis = genesisHash
+	return nil
+}
+
+func (db *MemoryDatabase) GetGenesis() (common.Hash, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	var zeroHash common.Hash
+	if db.genesis == zeroHash {
+		return zeroHash, ErrorGenesisNotSet
+	}
+
+	return db.genesis, nil
+}
+
 func (db *MemoryDatabase) GetBlockByHash(hash common.Hash) (*types.Block, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
 	block, exists := db.blocks[hash]
 	if !exists {
 		return nil, ErrorBlockNotFound
@@ -53,6 +104,85 @@ func (db *MemoryDatabase) GetBlockByHash(hash common.Hash) (*types.Block, error)
 	return block, nil
 }
 
+func (db *MemoryDatabase) GetCanonicalHash(height int64) (common.Hash, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return memoryIndex{db}.canonicalHash(height)
+}
+
+func (db *MemoryDatabase) GetTransactionBlock(txHash common.Hash) (common.Hash, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	hash, ok := db.txs[txHash]
+	if !ok {
+		return common.Hash{}, ErrorTransactionNotFound
+	}
+	return hash, nil
+}
+
+// memoryIndex is the indexStore of a MemoryDatabase, its caller holds the lock
+type memoryIndex struct {
+	db *MemoryDatabase
+}
+
+func (m memoryIndex) block(hash common.Hash) (*types.Block, error) {
+	block, ok := m.db.blocks[hash]
+	if !ok {
+		return nil, ErrorBlockNotFound
+	}
+	return block, nil
+}
+
+func (m memoryIndex) canonicalHash(height int64) (common.Hash, error) {
+	hash, ok := m.db.heights[height]
+	if !ok {
+		return common.Hash{}, ErrorBlockNotFound
+	}
+	return hash, nil
+}
+
+func (m memoryIndex) index(block *types.Block) error {
+	hash := block.BlockHash()
+	m.db.heights[block.Header.Height] = hash
+	for _, tx := range block.Transactions {
+		if txHash, err := tx.Hash(); err == nil {
+			m.db.txs[txHash] = hash
+		}
+	}
+	return nil
+}
+
+func (m memoryIndex) unindex(height int64, block *types.Block) error {
+	delete(m.db.heights, height)
+	if block == nil {
+		return nil
+	}
+	hash := block.BlockHash()
+	for _, tx := range block.Transactions {
+		if txHash, err := tx.Hash(); err == nil && m.db.txs[txHash] == hash {
+			delete(m.db.txs, txHash)
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDatabase) ForEachBlock(fn func(block *types.Block) error) error {
+	// fn may call back into the database
+	db.lock.RLock()
+	blocks := make([]*types.Block, 0, len(db.blocks))
+	for _, block := range db.blocks {
+		blocks = append(blocks, block)
+	}
+	db.lock.RUnlock()
+
+	for _, block := range blocks {
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *MemoryDatabase) Close() error {
 	return nil // no op
 }
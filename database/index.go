@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"minchain/core/types"
+)
+
+var ErrorTransactionNotFound = errors.New("transaction not found")
+
+// indexStore is what updateCanonical needs from a database to keep its height and transaction indexes. The indexes
+// only cover the canonical chain, they follow the head on SetHead.
+type indexStore interface {
+	block(hash common.Hash) (*types.Block, error)
+	// canonicalHash returns ErrorBlockNotFound when no block is indexed at height
+	canonicalHash(height int64) (common.Hash, error)
+	// index points the block's height and transactions at it
+	index(block *types.Block) error
+	// unindex removes height from the index and the transactions which point at block. block is nil when it's gone.
+	unindex(height int64, block *types.Block) error
+}
+
+// updateCanonical moves the indexes onto the chain ending in head. Only the blocks above the point where the new
+// chain joins the indexed one are visited, so following the head one block at a time is cheap. An empty index, e.g.
+// of a database written before there were indexes, is rebuilt down to genesis.
+func updateCanonical(store indexStore, head common.Hash) error {
+	block, err := store.block(head)
+	if errors.Is(err, ErrorBlockNotFound) {
+		// Nothing to index, e.g. a head which is about to be repaired
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Heights above the new head belong to a chain which isn't canonical anymore
+	for height := block.Header.Height + 1; ; height++ {
+		if err := unindexHeight(store, height); errors.Is(err, ErrorBlockNotFound) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var path []*types.Block
+	for {
+		indexed, err := store.canonicalHash(block.Header.Height)
+		if err == nil && indexed == block.BlockHash() {
+			break
+		}
+		if err != nil && !errors.Is(err, ErrorBlockNotFound) {
+			return err
+		}
+		path = append(path, block)
+		if block.Header.Height == 0 || block.Header.ParentHash == (common.Hash{}) {
+			break
+		}
+
+		block, err = store.block(block.Header.ParentHash)
+		if errors.Is(err, ErrorBlockNotFound) {
+			// A broken chain, index what can be reached. Chain verification on startup repairs it.
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Oldest first, so an interrupted update leaves an index which the next one picks up from
+	for i := len(path) - 1; i >= 0; i-- {
+		if err := unindexHeight(store, path[i].Header.Height); err != nil && !errors.Is(err, ErrorBlockNotFound) {
+			return err
+		}
+		if err := store.index(path[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexHeight removes the block indexed at height, ErrorBlockNotFound if there's none
+func unindexHeight(store indexStore, height int64) error {
+	hash, err := store.canonicalHash(height)
+	if err != nil {
+		return err
+	}
+	block, err := store.block(hash)
+	if err != nil && !errors.Is(err, ErrorBlockNotFound) {
+		return err
+	}
+	return store.unindex(height, block)
+}
+
+// CanonicalRange returns the canonical blocks in [from, from+count), oldest first. It stops at the head, so it's
+// empty when from is above it.
+func CanonicalRange(db Database, from int64, count int) ([]*types.Block, error) {
+	var blocks []*types.Block
+	for height := from; height < from+int64(count); height++ {
+		hash, err := db.GetCanonicalHash(height)
+		if errors.Is(err, ErrorBlockNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		block, err := db.GetBlockByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"testing"
+)
+
+func testBlock(t *testing.T, parent *types.Block, data string) *types.Block {
+	txs := []types.Tx{{From: "0x01", Data: data}}
+	txHash, err := types.CombinedHash(txs)
+	require.NoError(t, err)
+	return &types.Block{
+		Header:       types.BlockHeader{Height: parent.Header.Height + 1, ParentHash: parent.BlockHash(), TransactionHash: txHash},
+		Transactions: txs,
+	}
+}
+
+func txHash(t *testing.T, block *types.Block) common.Hash {
+	hash, err := block.Transactions[0].Hash()
+	require.NoError(t, err)
+	return hash
+}
+
+func requireCanonical(t *testing.T, db Database, blocks ...*types.Block) {
+	t.Helper()
+	for _, block := range blocks {
+		hash, err := db.GetCanonicalHash(block.Header.Height)
+		require.NoError(t, err)
+		require.Equal(t, block.BlockHash(), hash, "height %d", block.Header.Height)
+	}
+	_, err := db.GetCanonicalHash(blocks[len(blocks)-1].Header.Height + 1)
+	require.ErrorIs(t, err, ErrorBlockNotFound)
+}
+
+func testIndexes(t *testing.T, db Database) {
+	genesis := &types.Block{Transactions: []types.Tx{}}
+	first := testBlock(t, genesis, "first")
+	second := testBlock(t, first, "second")
+	forkSecond := testBlock(t, first, "fork second")
+	forkThird := testBlock(t, forkSecond, "fork third")
+	for _, block := range []*types.Block{genesis, first, second, forkSecond, forkThird} {
+		require.NoError(t, db.PutBlock(block))
+	}
+
+	require.NoError(t, db.SetHead(genesis.BlockHash()))
+	requireCanonical(t, db, genesis)
+	require.NoError(t, db.SetHead(second.BlockHash()))
+	requireCanonical(t, db, genesis, first, second)
+
+	included, err := db.GetTransactionBlock(txHash(t, second))
+	require.NoError(t, err)
+	require.Equal(t, second.BlockHash(), included)
+
+	// A reorg moves both indexes onto the fork
+	require.NoError(t, db.SetHead(forkThird.BlockHash()))
+	requireCanonical(t, db, genesis, first, forkSecond, forkThird)
+	_, err = db.GetTransactionBlock(txHash(t, second))
+	require.ErrorIs(t, err, ErrorTransactionNotFound)
+	included, err = db.GetTransactionBlock(txHash(t, forkThird))
+	require.NoError(t, err)
+	require.Equal(t, forkThird.BlockHash(), included)
+
+	// Rolling back drops what's above the new head
+	require.NoError(t, db.SetHead(first.BlockHash()))
+	requireCanonical(t, db, genesis, first)
+	_, err = db.GetTransactionBlock(txHash(t, forkThird))
+	require.ErrorIs(t, err, ErrorTransactionNotFound)
+
+	blocks, err := CanonicalRange(db, 1, 5)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	require.Equal(t, first.BlockHash(), blocks[0].BlockHash())
+
+	// A head which was never stored leaves the indexes alone
+	require.NoError(t, db.SetHead(common.Hash{1}))
+	requireCanonical(t, db, genesis, first)
+}
+
+func TestMemoryIndexes(t *testing.T) {
+	testIndexes(t, NewMemoryDatabase())
+}
+
+func TestDiskIndexes(t *testing.T) {
+	db, err := NewDiskDatabase(t.TempDir())
+	require.NoError(t, err)
+	defer db.Close()
+	testIndexes(t, db)
+}
+
+func TestDiskIndexesBuiltOnOpen(t *testing.T) {
+	path := t.TempDir()
+	db, err := NewDiskDatabase(path)
+	require.NoError(t, err)
+
+	genesis := &types.Block{Transactions: []types.Tx{}}
+	first := testBlock(t, genesis, "first")
+	second := testBlock(t, first, "second")
+	for _, block := range []*types.Block{genesis, first, second} {
+		require.NoError(t, db.PutBlock(block))
+	}
+	require.NoError(t, db.SetHead(second.BlockHash()))
+
+	// As written before there were indexes
+	disk := db.(*DiskDatabase)
+	for _, block := range []*types.Block{genesis, first, second} {
+		require.NoError(t, diskIndex{disk}.unindex(block.Header.Height, block))
+	}
+	_, err = db.GetCanonicalHash(0)
+	require.ErrorIs(t, err, ErrorBlockNotFound)
+	require.NoError(t, db.Close())
+
+	db, err = NewDiskDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+	requireCanonical(t, db, genesis, first, second)
+	included, err := db.GetTransactionBlock(txHash(t, first))
+	require.NoError(t, err)
+	require.Equal(t, first.BlockHash(), included)
+}
@@ -2,13 +2,15 @@ package test
 
 import (
 	"context"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 	"minchain/app"
 	"minchain/core"
+	"minchain/core/chaintest"
 	"minchain/core/types"
 	"minchain/database"
+	"minchain/genesis"
 	"minchain/lib"
+	"minchain/p2p"
 	"minchain/validator"
 	"sync"
 	"testing"
@@ -18,116 +20,131 @@ import (
 func TestE2E(t *testing.T) {
 	var ctx = context.Background()
 	var db = database.NewMemoryDatabase()
-	var mempool = core.NewMempool()
-	var pk, _ = crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+	var events = core.NewEventBus()
+	var mempool = core.NewMempool(events, db)
 
 	var testConfig = lib.Config{
-		PrivateKey:      pk,
+		PrivateKey:      chaintest.Key,
 		IsBlockProducer: true,
-		BlockTime:       1 * time.Millisecond,
+		BlockTime:       5 * time.Second,
+		NodeSigning:     true,
 	}
+	var clock = lib.NewManualClock(time.Now())
 
-	var publisher = TestPublisher{
-		publishedBlocks:       make([]*types.Block, 0),
-		publishedTransactions: make([]*types.Tx, 0),
-	}
+	var publisher = TestPublisher{}
 
 	var consumer = TestConsumer{
 		make(chan *types.Block),
 		make(chan *types.Tx),
 	}
 
-	var input = TestTransactionsInput{input: make(chan string)}
+	var input = TestTransactionsInput{input: make(chan *lib.Submission)}
 
 	var testApp = app.NewApp(
 		mempool,
 		db,
-		validator.NewBlockValidator(db),
+		validator.NewBlockValidator(db, testConfig.BlockTime, clock),
 		core.NewWallet(testConfig.PrivateKey),
 		testConfig,
 		&publisher,
 		&consumer,
+		p2p.NopReporter{},
 		[]lib.TransactionsInput{&input},
+		genesis.Default(),
+		clock,
+		events,
 	)
 
 	testApp.Start(ctx)
 
 	// Simulate new transaction from a user
 	input.NewUserInput("hello world")
-	waitForPropagation()
-
-	require.Equal(t, 1, len(publisher.publishedTransactions))
-	require.Equal(t, "hello world", publisher.publishedTransactions[0].Data)
+	require.Eventually(t, func() bool { return len(publisher.Transactions()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, "hello world", publisher.Transactions()[0].Data)
 
 	// Simulate the transaction has been received from p2p
-	publishedTx := publisher.publishedTransactions[0]
+	publishedTx := publisher.Transactions()[0]
 	consumer.TxChannel <- publishedTx
+	require.Eventually(t, func() bool { return len(mempool.ListPendingTransactions()) == 1 }, time.Second, time.Millisecond)
 
-	waitForPropagation()
-
-	require.Equal(t, 1, len(publisher.publishedBlocks))
-	require.Equal(t, "hello world", publisher.publishedBlocks[0].Transactions[0].Data)
+	// Nothing is produced until the block time passes
+	require.Eventually(t, func() bool { return clock.Waiters() > 0 }, time.Second, time.Millisecond)
+	require.Empty(t, publisher.Blocks())
+	clock.Advance(testConfig.BlockTime)
+	require.Eventually(t, func() bool { return len(publisher.Blocks()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, "hello world", publisher.Blocks()[0].Transactions[0].Data)
 
 	// Simulate the block has been received from p2p
-	publishedBlock := publisher.publishedBlocks[0]
+	imported := events.BlockImported.Subscribe(ctx, 1)
+	heads := events.HeadChanged.Subscribe(ctx, 1)
+	publishedBlock := publisher.Blocks()[0]
 	consumer.BlocksChannel <- publishedBlock
-
-	waitForPropagation()
+	require.Equal(t, publishedBlock.BlockHash(), (<-imported.C()).Block.BlockHash())
+	require.Equal(t, publishedBlock.BlockHash(), (<-heads.C()).Block.BlockHash())
+	require.Eventually(t, func() bool {
+		headBlock, _ := db.GetHead()
+		return headBlock == publishedBlock.BlockHash()
+	}, time.Second, time.Millisecond)
 
 	blockStoredInDb, _ := db.GetBlockByHash(publishedBlock.BlockHash())
-	headBlock, _ := db.GetHead()
 	require.Equal(t, publishedBlock.BlockHash(), blockStoredInDb.BlockHash())
-	require.Equal(t, publishedBlock.BlockHash(), headBlock)
 	require.Equal(t, publishedBlock.Header.Height, int64(1))
 	require.Equal(t, 0, len(mempool.ListPendingTransactions()))
 }
 
-func waitForPropagation() {
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		time.Sleep(10 * time.Millisecond)
-	}()
-	wg.Wait()
-}
-
 type TestPublisher struct {
+	lock                  sync.Mutex
 	publishedBlocks       []*types.Block
 	publishedTransactions []*types.Tx
 }
 
 func (p *TestPublisher) PublishBlock(ctx context.Context, block *types.Block) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.publishedBlocks = append(p.publishedBlocks, block)
 	return nil
 }
 
 func (p *TestPublisher) PublishTransaction(ctx context.Context, transaction *types.Tx) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.publishedTransactions = append(p.publishedTransactions, transaction)
 	return nil
 }
 
+func (p *TestPublisher) Blocks() []*types.Block {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*types.Block(nil), p.publishedBlocks...)
+}
+
+func (p *TestPublisher) Transactions() []*types.Tx {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*types.Tx(nil), p.publishedTransactions...)
+}
+
 type TestConsumer struct {
 	BlocksChannel chan *types.Block
 	TxChannel     chan *types.Tx
 }
 
-func (c *TestConsumer) ConsumeTransaction(ctx context.Context) (*types.Tx, error) {
-	return <-c.TxChannel, nil
+func (c *TestConsumer) ConsumeTransaction(ctx context.Context) (context.Context, *types.Tx, error) {
+	return ctx, <-c.TxChannel, nil
 }
 
-func (c *TestConsumer) ConsumeBlock(ctx context.Context) (*types.Block, error) {
-	return <-c.BlocksChannel, nil
+func (c *TestConsumer) ConsumeBlock(ctx context.Context) (context.Context, *types.Block, error) {
+	return ctx, <-c.BlocksChannel, nil
 }
 
 type TestTransactionsInput struct {
-	input chan string
+	input chan *lib.Submission
 }
 
-func (ui *TestTransactionsInput) InputChannel(ctx context.Context) <-chan string {
+func (ui *TestTransactionsInput) InputChannel(ctx context.Context) <-chan *lib.Submission {
 	return ui.input
 }
 
 func (ui *TestTransactionsInput) NewUserInput(message string) {
-	ui.input <- message
+	ui.input <- lib.NewSubmission(message, nil)
 }
@@ -0,0 +1,150 @@
+package simnet
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/p2p"
+)
+
+var ErrorUnreachable = errors.New("peer unreachable")
+
+var _ p2p.Fetcher = (*Endpoint)(nil)
+
+// ID is how other endpoints address this one in requests
+func (e *Endpoint) ID() peer.ID {
+	return peer.ID(e.name)
+}
+
+// Serve answers the requests of other endpoints from the node's database and mempool
+func (e *Endpoint) Serve(db database.Database, pool p2p.TransactionPool) {
+	e.network.lock.Lock()
+	defer e.network.lock.Unlock()
+	e.db = db
+	e.pool = pool
+}
+
+// Deliver hands a block to the node as if it was gossiped, e.g. one it fetched from a peer
+func (e *Endpoint) Deliver(block *types.Block) {
+	e.receive(&envelope{from: e.name, to: e.name, block: block})
+}
+
+// request finds the endpoint serving id. Requests are answered right away, they're lost to partitions and drops
+// like messages but don't wait for the link latency.
+func (n *Network) request(from string, id peer.ID) (*Endpoint, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	to := string(id)
+	target, ok := n.endpoints[to]
+	if !ok || target.db == nil || n.partition[from] != n.partition[to] {
+		return nil, ErrorUnreachable
+	}
+	if config := n.linkConfig(from, to); config.DropRate > 0 && n.rng.Float64() < config.DropRate {
+		n.dropped++
+		return nil, ErrorUnreachable
+	}
+	return target, nil
+}
+
+func (e *Endpoint) GetBlockByHash(_ context.Context, id peer.ID, hash common.Hash) (*types.Block, error) {
+	target, err := e.network.request(e.name, id)
+	if err != nil {
+		return nil, err
+	}
+	return target.findBlock(hash)
+}
+
+func (e *Endpoint) GetBlocksByRange(_ context.Context, id peer.ID, from int64, count int) ([]*types.Block, error) {
+	target, err := e.network.request(e.name, id)
+	if err != nil {
+		return nil, err
+	}
+	if from < 0 || count <= 0 {
+		return nil, p2p.ErrorInvalidRequest
+	}
+	return database.CanonicalRange(target.db, from, count)
+}
+
+func (e *Endpoint) GetHeaders(ctx context.Context, id peer.ID, from int64, count int) ([]types.BlockHeader, error) {
+	blocks, err := e.GetBlocksByRange(ctx, id, from, count)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]types.BlockHeader, 0, len(blocks))
+	for _, block := range blocks {
+		headers = append(headers, block.Header)
+	}
+	return headers, nil
+}
+
+// GetTransactions answers from the mempool and the canonical chain
+func (e *Endpoint) GetTransactions(_ context.Context, id peer.ID, hashes []common.Hash) ([]types.Tx, error) {
+	target, err := e.network.request(e.name, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[common.Hash]types.Tx)
+	if target.pool != nil {
+		for _, tx := range target.pool.ListPendingTransactions() {
+			if hash, err := tx.Hash(); err == nil {
+				pending[hash] = tx
+			}
+		}
+	}
+
+	txs := make([]types.Tx, 0, len(hashes))
+	for _, hash := range hashes {
+		if tx, ok := pending[hash]; ok {
+			txs = append(txs, tx)
+			continue
+		}
+		blockHash, err := target.db.GetTransactionBlock(hash)
+		if err != nil {
+			continue
+		}
+		block, err := target.db.GetBlockByHash(blockHash)
+		if err != nil {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			if txHash, err := tx.Hash(); err == nil && txHash == hash {
+				txs = append(txs, tx)
+				break
+			}
+		}
+	}
+	return txs, nil
+}
+
+func (e *Endpoint) GetBlockTransactions(_ context.Context, id peer.ID, blockHash common.Hash, indexes []int) ([]types.Tx, error) {
+	target, err := e.network.request(e.name, id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := target.findBlock(blockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]types.Tx, 0, len(indexes))
+	for _, index := range indexes {
+		if index < 0 || index >= len(block.Transactions) {
+			return nil, p2p.ErrorInvalidRequest
+		}
+		txs = append(txs, block.Transactions[index])
+	}
+	return txs, nil
+}
+
+func (e *Endpoint) findBlock(hash common.Hash) (*types.Block, error) {
+	block, err := e.db.GetBlockByHash(hash)
+	if errors.Is(err, database.ErrorBlockNotFound) {
+		return nil, p2p.ErrorNotFound
+	}
+	return block, err
+}
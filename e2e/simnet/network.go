@@ -0,0 +1,317 @@
+// Package simnet connects many nodes in one process through a simulated network, so integration tests
+// control latency, drops, partitions and reordering instead of depending on real sockets and timing.
+package simnet
+
+import (
+	"context"
+	"math/rand"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/lib"
+	"minchain/p2p"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inboxSize bounds the delivered but not yet consumed messages of one node
+const inboxSize = 1024
+
+// LinkConfig describes how messages travel from one node to another
+type LinkConfig struct {
+	Latency time.Duration
+	// Jitter adds a random delay in [0, Jitter) on top of Latency
+	Jitter time.Duration
+	// DropRate is the probability in [0, 1] that a message is lost
+	DropRate float64
+	// Reorder shuffles the messages which become due in the same Advance
+	Reorder bool
+}
+
+// Network is a simulated gossip network. Time is virtual: published messages are queued and only delivered
+// when a test calls Advance or Settle, and all randomness comes from the seed, so runs are reproducible.
+// The nodes run on the network's clock, so block production follows the same virtual time.
+type Network struct {
+	lock        sync.Mutex
+	rng         *rand.Rand
+	clock       *lib.ManualClock
+	now         time.Duration
+	seq         uint64
+	defaultLink LinkConfig
+	links       map[link]LinkConfig
+	endpoints   map[string]*Endpoint
+	// partition maps node names to their partition, nodes in different partitions can't reach each other
+	partition map[string]int
+	queue     []*envelope
+	dropped   int
+}
+
+type link struct {
+	from string
+	to   string
+}
+
+type envelope struct {
+	from   string
+	to     string
+	target *Endpoint
+	due    time.Duration
+	seq    uint64
+	block  *types.Block
+	tx     *types.Tx
+}
+
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		rng:       rand.New(rand.NewSource(seed)),
+		clock:     lib.NewManualClock(time.Unix(0, 0)),
+		links:     make(map[link]LinkConfig),
+		endpoints: make(map[string]*Endpoint),
+		partition: make(map[string]int),
+	}
+}
+
+// Join adds a node to the network and returns its publisher, consumer and fetcher
+func (n *Network) Join(name string) *Endpoint {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	endpoint := &Endpoint{
+		name:    name,
+		network: n,
+		blocks:  make(chan *types.Block, inboxSize),
+		txs:     make(chan *types.Tx, inboxSize),
+	}
+	n.endpoints[name] = endpoint
+	return endpoint
+}
+
+// SetDefaultLink configures every link which has no explicit configuration
+func (n *Network) SetDefaultLink(config LinkConfig) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.defaultLink = config
+}
+
+// SetLink configures the direction from -> to
+func (n *Network) SetLink(from string, to string, config LinkConfig) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.links[link{from: from, to: to}] = config
+}
+
+// Partition splits the network into the given groups. Nodes not listed form one more group together.
+// Messages in flight between groups are lost when they become due.
+func (n *Network) Partition(groups ...[]string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.partition = make(map[string]int)
+	for i, group := range groups {
+		for _, name := range group {
+			n.partition[name] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// Clock is the clock the network's nodes run on
+func (n *Network) Clock() *lib.ManualClock {
+	return n.clock
+}
+
+// Now is the virtual time elapsed since the network was created
+func (n *Network) Now() time.Duration {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.now
+}
+
+// Pending is the number of messages in flight
+func (n *Network) Pending() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return len(n.queue)
+}
+
+// Dropped is the number of messages lost so far, to drops or partitions
+func (n *Network) Dropped() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.dropped
+}
+
+// Advance moves the virtual clock forward and delivers the messages which became due, returning how many
+func (n *Network) Advance(d time.Duration) int {
+	n.lock.Lock()
+	n.now += d
+	due := n.takeDue()
+	n.lock.Unlock()
+
+	// Inboxes are written without the lock, so a node can publish while its full inbox is drained
+	for _, e := range due {
+		e.target.receive(e)
+	}
+	n.clock.Advance(d)
+	return len(due)
+}
+
+// Settle advances the clock until nothing is in flight, returning how many messages were delivered
+func (n *Network) Settle() int {
+	delivered := 0
+	for {
+		n.lock.Lock()
+		if len(n.queue) == 0 {
+			n.lock.Unlock()
+			return delivered
+		}
+		next := n.queue[0].due
+		for _, e := range n.queue {
+			if e.due < next {
+				next = e.due
+			}
+		}
+		step := next - n.now
+		n.lock.Unlock()
+
+		delivered += n.Advance(step)
+	}
+}
+
+// takeDue removes the due messages from the queue, in delivery order
+func (n *Network) takeDue() []*envelope {
+	var due, waiting []*envelope
+	for _, e := range n.queue {
+		if e.due <= n.now {
+			due = append(due, e)
+		} else {
+			waiting = append(waiting, e)
+		}
+	}
+	n.queue = waiting
+
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].due != due[j].due {
+			return due[i].due < due[j].due
+		}
+		return due[i].seq < due[j].seq
+	})
+
+	delivered := due[:0]
+	for _, e := range due {
+		if n.partition[e.from] != n.partition[e.to] {
+			n.dropped++
+			continue
+		}
+		delivered = append(delivered, e)
+	}
+
+	// Only messages over links which allow reordering are shuffled, the rest keep their order
+	var shuffled []int
+	for i, e := range delivered {
+		if n.linkConfig(e.from, e.to).Reorder {
+			shuffled = append(shuffled, i)
+		}
+	}
+	n.rng.Shuffle(len(shuffled), func(i, j int) {
+		a, b := shuffled[i], shuffled[j]
+		delivered[a], delivered[b] = delivered[b], delivered[a]
+	})
+	return delivered
+}
+
+func (n *Network) linkConfig(from string, to string) LinkConfig {
+	if config, ok := n.links[link{from: from, to: to}]; ok {
+		return config
+	}
+	return n.defaultLink
+}
+
+// broadcast queues a message to every other node. Like gossipsub, the sender receives its own message too,
+// the returned envelope is delivered to it immediately and never dropped.
+func (n *Network) broadcast(from string, block *types.Block, tx *types.Tx) *envelope {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	names := make([]string, 0, len(n.endpoints))
+	for name := range n.endpoints {
+		names = append(names, name)
+	}
+	// Map order is random, the seeded draws below must happen in the same order on every run
+	sort.Strings(names)
+
+	for _, to := range names {
+		if to == from {
+			continue
+		}
+		config := n.linkConfig(from, to)
+		if config.DropRate > 0 && n.rng.Float64() < config.DropRate {
+			n.dropped++
+			continue
+		}
+
+		n.seq++
+		e := &envelope{from: from, to: to, target: n.endpoints[to], due: n.now + config.Latency, seq: n.seq, block: block, tx: tx}
+		if config.Jitter > 0 {
+			e.due += time.Duration(n.rng.Int63n(int64(config.Jitter)))
+		}
+		n.queue = append(n.queue, e)
+	}
+	return &envelope{from: from, to: from, block: block, tx: tx}
+}
+
+// Endpoint is one node's connection to the network, it implements p2p.Publisher, p2p.Consumer and p2p.Fetcher
+type Endpoint struct {
+	name    string
+	network *Network
+	blocks  chan *types.Block
+	txs     chan *types.Tx
+	// db and pool answer requests, they're set by Serve
+	db   database.Database
+	pool p2p.TransactionPool
+}
+
+func (e *Endpoint) Name() string {
+	return e.name
+}
+
+func (e *Endpoint) PublishBlock(_ context.Context, block *types.Block) error {
+	e.receive(e.network.broadcast(e.name, block, nil))
+	return nil
+}
+
+func (e *Endpoint) PublishTransaction(_ context.Context, transaction *types.Tx) error {
+	e.receive(e.network.broadcast(e.name, nil, transaction))
+	return nil
+}
+
+func (e *Endpoint) ConsumeBlock(ctx context.Context) (context.Context, *types.Block, error) {
+	select {
+	case block := <-e.blocks:
+		return ctx, block, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (e *Endpoint) ConsumeTransaction(ctx context.Context) (context.Context, *types.Tx, error) {
+	select {
+	case tx := <-e.txs:
+		return ctx, tx, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (e *Endpoint) receive(env *envelope) {
+	if env.block != nil {
+		e.blocks <- env.block
+	}
+	if env.tx != nil {
+		e.txs <- env.tx
+	}
+}
@@ -0,0 +1,52 @@
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"testing"
+	"time"
+)
+
+func TestDeliveryIsDeterministic(t *testing.T) {
+	run := func(seed int64) []string {
+		network := NewNetwork(seed)
+		network.SetDefaultLink(LinkConfig{Latency: 10 * time.Millisecond, Jitter: 50 * time.Millisecond, DropRate: 0.2, Reorder: true})
+		sender := network.Join("sender")
+		receiver := network.Join("receiver")
+
+		for i := 0; i < 50; i++ {
+			require.NoError(t, sender.PublishTransaction(context.Background(), &types.Tx{Data: fmt.Sprint(i)}))
+		}
+		network.Settle()
+
+		var received []string
+		for len(receiver.txs) > 0 {
+			_, tx, err := receiver.ConsumeTransaction(context.Background())
+			require.NoError(t, err)
+			received = append(received, tx.Data)
+		}
+		return received
+	}
+
+	first := run(7)
+	require.Equal(t, first, run(7))
+	require.Less(t, len(first), 50)
+	require.NotEqual(t, first, run(8))
+}
+
+func TestPartitionDropsInFlightMessages(t *testing.T) {
+	network := NewNetwork(1)
+	network.SetDefaultLink(LinkConfig{Latency: time.Second})
+	a := network.Join("a")
+	b := network.Join("b")
+
+	require.NoError(t, a.PublishBlock(context.Background(), &types.Block{}))
+	require.Len(t, a.blocks, 1, "sender receives its own message right away")
+
+	network.Partition([]string{"a"}, []string{"b"})
+	require.Equal(t, 0, network.Advance(time.Second))
+	require.Len(t, b.blocks, 0)
+	require.Equal(t, 1, network.Dropped())
+}
@@ -0,0 +1,105 @@
+package simnet
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/crypto"
+	"minchain/app"
+	"minchain/core"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/genesis"
+	"minchain/lib"
+	"minchain/p2p"
+	"minchain/validator"
+)
+
+// Node is a full node on the simulated network, with an in-memory database and mempool
+type Node struct {
+	Name     string
+	App      *app.App
+	Database database.Database
+	Mempool  core.Mempool
+	Events   *core.EventBus
+	Endpoint *Endpoint
+	input    *Input
+}
+
+// StartNode joins a new node to the network and starts it. Without a private key in the config one is generated.
+func (n *Network) StartNode(ctx context.Context, name string, config lib.Config, chainGenesis *genesis.Genesis) (*Node, error) {
+	if config.PrivateKey == nil {
+		pk, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		config.PrivateKey = pk
+	}
+	config.ChainID = chainGenesis.ChainID
+	config.GenesisHash = chainGenesis.Hash()
+
+	events := core.NewEventBus()
+	db := database.NewMemoryDatabase()
+	node := &Node{
+		Name:     name,
+		Database: db,
+		Mempool:  core.NewMempool(events, db),
+		Events:   events,
+		Endpoint: n.Join(name),
+		input:    &Input{submissions: make(chan *lib.Submission, inboxSize)},
+	}
+	node.Endpoint.Serve(node.Database, node.Mempool)
+	node.App = app.NewApp(
+		node.Mempool,
+		node.Database,
+		validator.NewBlockValidator(node.Database, config.BlockTime, n.clock),
+		core.NewWallet(config.PrivateKey),
+		config,
+		node.Endpoint,
+		node.Endpoint,
+		p2p.NopReporter{},
+		[]lib.TransactionsInput{node.input},
+		chainGenesis,
+		n.clock,
+		events,
+	)
+	node.App.Start(ctx)
+	return node, nil
+}
+
+// SubmitTransaction signs the message with the node's wallet and gossips it, like a user typing it in
+func (node *Node) SubmitTransaction(message string) {
+	node.input.submissions <- lib.NewSubmission(message, nil)
+}
+
+// Head returns the node's current head block
+func (node *Node) Head() (*types.Block, error) {
+	head, err := node.Database.GetHead()
+	if err != nil {
+		return nil, err
+	}
+	return node.Database.GetBlockByHash(head)
+}
+
+// Input feeds transactions to a node, it implements lib.TransactionsInput
+type Input struct {
+	submissions chan *lib.Submission
+}
+
+func (i *Input) InputChannel(ctx context.Context) <-chan *lib.Submission {
+	out := make(chan *lib.Submission)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case submission := <-i.submissions:
+				select {
+				case out <- submission:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
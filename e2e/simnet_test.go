@@ -0,0 +1,219 @@
+package test
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"minchain/e2e/simnet"
+	"minchain/genesis"
+	"minchain/lib"
+	"minchain/p2p"
+	"testing"
+	"time"
+)
+
+func TestBlockPropagation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network := simnet.NewNetwork(1)
+	network.SetDefaultLink(simnet.LinkConfig{Latency: 50 * time.Millisecond, Jitter: 20 * time.Millisecond, Reorder: true})
+	nodes := startNodes(t, ctx, network, "producer", "a", "b")
+
+	nodes[1].SubmitTransaction("hello world")
+
+	require.Eventually(t, func() bool {
+		network.Advance(10 * time.Millisecond)
+		return sameHeadAtHeight(nodes, 1)
+	}, 5*time.Second, time.Millisecond)
+
+	head, err := nodes[2].Head()
+	require.NoError(t, err)
+	require.Equal(t, "hello world", head.Transactions[0].Data)
+}
+
+func TestPartition(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network := simnet.NewNetwork(1)
+	nodes := startNodes(t, ctx, network, "producer", "a", "b")
+	network.Partition([]string{"b"})
+
+	nodes[1].SubmitTransaction("hello world")
+	require.Eventually(t, func() bool {
+		network.Advance(10 * time.Millisecond)
+		return sameHeadAtHeight(nodes[:2], 1)
+	}, 5*time.Second, time.Millisecond)
+
+	head, err := nodes[2].Head()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), head.Header.Height)
+	require.Positive(t, network.Dropped())
+
+	// Once healed, new transactions reach b again
+	network.Heal()
+	nodes[1].SubmitTransaction("after partition")
+	require.Eventually(t, func() bool {
+		network.Settle()
+		return len(nodes[2].Mempool.ListPendingTransactions()) == 1
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestDroppedLink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network := simnet.NewNetwork(1)
+	nodes := startNodes(t, ctx, network, "producer", "a")
+	network.SetLink("a", "producer", simnet.LinkConfig{DropRate: 1})
+
+	nodes[1].SubmitTransaction("lost")
+	require.Eventually(t, func() bool {
+		network.Settle()
+		return network.Dropped() == 1
+	}, 5*time.Second, time.Millisecond)
+	require.Empty(t, nodes[0].Mempool.ListPendingTransactions())
+}
+
+func TestCatchUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network := simnet.NewNetwork(1)
+	nodes := startNodes(t, ctx, network, "producer", "a", "b")
+	producer, b := nodes[0], nodes[2]
+	network.Partition([]string{"b"})
+
+	for i, message := range []string{"first", "second", "third"} {
+		nodes[1].SubmitTransaction(message)
+		require.Eventually(t, func() bool {
+			network.Advance(10 * time.Millisecond)
+			return sameHeadAtHeight(nodes[:2], int64(i+1))
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	// Requests don't cross the partition either
+	_, err := b.Endpoint.GetHeaders(ctx, producer.Endpoint.ID(), 1, 64)
+	require.ErrorIs(t, err, simnet.ErrorUnreachable)
+
+	// Once healed, b fetches what it missed, nothing is gossiped again
+	network.Heal()
+	head, err := b.Head()
+	require.NoError(t, err)
+	blocks, err := b.Endpoint.GetBlocksByRange(ctx, producer.Endpoint.ID(), head.Header.Height+1, 64)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	for _, block := range blocks {
+		b.Endpoint.Deliver(block)
+	}
+	require.Eventually(t, func() bool {
+		return sameHeadAtHeight(nodes, 3)
+	}, 5*time.Second, time.Millisecond)
+
+	hash, err := blocks[1].Transactions[0].Hash()
+	require.NoError(t, err)
+	txs, err := producer.Endpoint.GetTransactions(ctx, b.Endpoint.ID(), []common.Hash{hash})
+	require.NoError(t, err)
+	require.Equal(t, "second", txs[0].Data)
+}
+
+func TestForkResolvedByFetching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two producers build on the same genesis while they can't reach each other
+	network := simnet.NewNetwork(1)
+	nodes := startNodes(t, ctx, network, "producer", "a")
+	other := startProducer(t, ctx, network, "other")
+	network.Partition([]string{"producer", "a"}, []string{"other"})
+
+	nodes[1].SubmitTransaction("short fork")
+	require.Eventually(t, func() bool {
+		network.Advance(10 * time.Millisecond)
+		return sameHeadAtHeight(nodes, 1)
+	}, 5*time.Second, time.Millisecond)
+	shortHead, err := nodes[1].Head()
+	require.NoError(t, err)
+
+	for i, message := range []string{"long fork", "long fork again"} {
+		other.SubmitTransaction(message)
+		require.Eventually(t, func() bool {
+			network.Advance(10 * time.Millisecond)
+			return sameHeadAtHeight([]*simnet.Node{other}, int64(i+1))
+		}, 5*time.Second, time.Millisecond)
+	}
+	longHead, err := other.Head()
+	require.NoError(t, err)
+
+	// a finds where the chains split from the headers and switches to the longer one
+	network.Heal()
+	a := nodes[1]
+	headers, err := a.Endpoint.GetHeaders(ctx, other.Endpoint.ID(), 0, 64)
+	require.NoError(t, err)
+	require.Len(t, headers, 3)
+	split := int64(0)
+	for _, header := range headers {
+		local, err := a.Database.GetCanonicalHash(header.Height)
+		if err != nil || local != (&types.Block{Header: header}).BlockHash() {
+			break
+		}
+		split = header.Height
+	}
+	require.Equal(t, int64(0), split)
+
+	_, err = a.Endpoint.GetBlockByHash(ctx, other.Endpoint.ID(), shortHead.BlockHash())
+	require.ErrorIs(t, err, p2p.ErrorNotFound)
+	blocks, err := a.Endpoint.GetBlocksByRange(ctx, other.Endpoint.ID(), split+1, 64)
+	require.NoError(t, err)
+	for _, block := range blocks {
+		a.Endpoint.Deliver(block)
+	}
+	require.Eventually(t, func() bool {
+		head, err := a.Head()
+		return err == nil && head.BlockHash() == longHead.BlockHash()
+	}, 5*time.Second, time.Millisecond)
+
+	// The abandoned fork stays stored, only the canonical indexes moved
+	_, err = a.Database.GetBlockByHash(shortHead.BlockHash())
+	require.NoError(t, err)
+	canonical, err := a.Database.GetCanonicalHash(1)
+	require.NoError(t, err)
+	require.Equal(t, blocks[0].BlockHash(), canonical)
+}
+
+// startNodes starts a node per name, the first one produces blocks
+func startNodes(t *testing.T, ctx context.Context, network *simnet.Network, names ...string) []*simnet.Node {
+	nodes := make([]*simnet.Node, 0, len(names))
+	for i, name := range names {
+		// Block time is virtual, it passes as the tests advance the network
+		config := lib.Config{IsBlockProducer: i == 0, BlockTime: 100 * time.Millisecond, NodeSigning: true}
+		node, err := network.StartNode(ctx, name, config, genesis.Default())
+		require.NoError(t, err)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// startProducer starts one more block producer
+func startProducer(t *testing.T, ctx context.Context, network *simnet.Network, name string) *simnet.Node {
+	config := lib.Config{IsBlockProducer: true, BlockTime: 100 * time.Millisecond, NodeSigning: true}
+	node, err := network.StartNode(ctx, name, config, genesis.Default())
+	require.NoError(t, err)
+	return node
+}
+
+func sameHeadAtHeight(nodes []*simnet.Node, height int64) bool {
+	first, err := nodes[0].Head()
+	if err != nil || first.Header.Height != height {
+		return false
+	}
+	for _, node := range nodes[1:] {
+		head, err := node.Head()
+		if err != nil || head.BlockHash() != first.BlockHash() {
+			return false
+		}
+	}
+	return true
+}
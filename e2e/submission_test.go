@@ -0,0 +1,82 @@
+package test
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"minchain/app"
+	"minchain/core"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/genesis"
+	"minchain/lib"
+	"minchain/p2p"
+	"minchain/validator"
+	"testing"
+	"time"
+)
+
+func TestSignedSubmission(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := database.NewMemoryDatabase()
+	events := core.NewEventBus()
+	mempool := core.NewMempool(events, db)
+	nodeKey, _ := crypto.GenerateKey()
+	// Node signing is off by default
+	config := lib.Config{PrivateKey: nodeKey, BlockTime: 5 * time.Second}
+	clock := lib.NewManualClock(time.Now())
+	publisher := TestPublisher{}
+	input := TestTransactionsInput{input: make(chan *lib.Submission)}
+
+	app.NewApp(
+		mempool,
+		db,
+		validator.NewBlockValidator(db, config.BlockTime, clock),
+		core.NewWallet(nodeKey),
+		config,
+		&publisher,
+		&TestConsumer{make(chan *types.Block), make(chan *types.Tx)},
+		p2p.NopReporter{},
+		[]lib.TransactionsInput{&input},
+		genesis.Default(),
+		clock,
+		events,
+	).Start(ctx)
+
+	userKey, _ := crypto.GenerateKey()
+	tx, err := core.NewWallet(userKey).SignedTransaction("signed by the user")
+	require.NoError(t, err)
+	hash, _ := tx.Hash()
+
+	result := submitAndWait(t, &input, lib.NewSignedSubmission(tx, nil))
+	require.True(t, result.Accepted)
+	require.Equal(t, hash, result.Hash)
+	require.Len(t, mempool.ListPendingTransactions(), 1)
+	require.Equal(t, crypto.PubkeyToAddress(userKey.PublicKey).String(), publisher.Transactions()[0].From)
+
+	// Claiming to be someone else invalidates the signature
+	forged := *tx
+	forged.From = crypto.PubkeyToAddress(nodeKey.PublicKey).String()
+	result = submitAndWait(t, &input, lib.NewSignedSubmission(&forged, nil))
+	require.False(t, result.Accepted)
+	require.Equal(t, core.ErrorInvalidTransaction.Error(), result.Reason)
+
+	result = submitAndWait(t, &input, lib.NewSubmission("sign this for me", nil))
+	require.ErrorIs(t, result.Err, lib.ErrorNodeSigningDisabled)
+
+	require.Len(t, publisher.Transactions(), 1)
+	require.Len(t, mempool.ListPendingTransactions(), 1)
+}
+
+func submitAndWait(t *testing.T, input *TestTransactionsInput, submission *lib.Submission) lib.SubmitResult {
+	input.input <- submission
+	select {
+	case result := <-submission.Result():
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("no result for the submission")
+		return lib.SubmitResult{}
+	}
+}
@@ -0,0 +1,175 @@
+package genesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"minchain/core/types"
+	"os"
+	"sort"
+	"time"
+)
+
+// Genesis describes a network: its chain parameters and initial state.
+// Every field is committed to by the genesis block hash, so two networks with different files never share a genesis.
+type Genesis struct {
+	ChainID    uint64           `json:"chainId"`
+	Timestamp  int64            `json:"timestamp"`
+	BlockTime  Duration         `json:"blockTime"`
+	Validators []common.Address `json:"validators"`
+	// Alloc holds initial balances. There is no account state yet, so they are only part of the commitment.
+	Alloc     map[common.Address]uint64 `json:"alloc,omitempty"`
+	ExtraData hexutil.Bytes             `json:"extraData,omitempty"`
+}
+
+// Duration is a time.Duration written as a string, e.g. "5s", in the genesis file
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Default is the genesis of a local development network, used when no genesis file is configured.
+func Default() *Genesis {
+	return &Genesis{
+		ChainID:    1337,
+		Timestamp:  0,
+		BlockTime:  Duration(5 * time.Second),
+		Validators: make([]common.Address, 0),
+	}
+}
+
+func Load(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var g Genesis
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %w", path, err)
+	}
+
+	if g.Validators == nil {
+		g.Validators = make([]common.Address, 0)
+	}
+
+	if err := g.validate(); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+func (g *Genesis) validate() error {
+	if g.ChainID == 0 {
+		return errors.New("chainId must be set")
+	}
+	if g.BlockTime <= 0 {
+		return errors.New("blockTime must be positive")
+	}
+	if time.Duration(g.BlockTime)%time.Millisecond != 0 {
+		return errors.New("blockTime must be a whole number of milliseconds")
+	}
+	if g.Timestamp < 0 {
+		return errors.New("timestamp must not be negative")
+	}
+	return nil
+}
+
+// The genesis spec is committed to by keccak256 of its RLP encoding, so the hash doesn't depend on how a JSON
+// encoder orders or escapes fields:
+//
+// RLP list [chainId, timestamp, blockTime, validators, alloc, extraData]
+//   - chainId: unsigned integer
+//   - timestamp: Unix seconds, unsigned integer
+//   - blockTime: milliseconds, unsigned integer
+//   - validators: list of 20 byte addresses, in the order of the genesis file
+//   - alloc: list of [address, balance] pairs, sorted by address
+//   - extraData: byte string, empty when unset
+//
+// Test vectors are in core/types/testdata/hash_vectors.json.
+type rlpGenesis struct {
+	ChainID    uint64
+	Timestamp  uint64
+	BlockTime  uint64
+	Validators []common.Address
+	Alloc      []rlpAlloc
+	ExtraData  []byte
+}
+
+type rlpAlloc struct {
+	Address common.Address
+	Balance uint64
+}
+
+// CanonicalBytes is the serialization of the spec the genesis block commits to
+func (g *Genesis) CanonicalBytes() ([]byte, error) {
+	if g.Timestamp < 0 || g.BlockTime < 0 {
+		return nil, errors.New("timestamp and blockTime must not be negative")
+	}
+
+	alloc := make([]rlpAlloc, 0, len(g.Alloc))
+	for address, balance := range g.Alloc {
+		alloc = append(alloc, rlpAlloc{Address: address, Balance: balance})
+	}
+	sort.Slice(alloc, func(i, j int) bool {
+		return bytes.Compare(alloc[i].Address[:], alloc[j].Address[:]) < 0
+	})
+
+	validators := g.Validators
+	if validators == nil {
+		validators = make([]common.Address, 0)
+	}
+
+	return rlp.EncodeToBytes(rlpGenesis{
+		ChainID:    g.ChainID,
+		Timestamp:  uint64(g.Timestamp),
+		BlockTime:  uint64(time.Duration(g.BlockTime).Milliseconds()),
+		Validators: validators,
+		Alloc:      alloc,
+		ExtraData:  g.ExtraData,
+	})
+}
+
+// Block builds the genesis block. The header's Extra field holds the hash of the whole genesis spec.
+func (g *Genesis) Block() *types.Block {
+	spec, err := g.CanonicalBytes()
+	if err != nil {
+		// Load and Default only produce valid specs
+		panic(err)
+	}
+
+	return &types.Block{
+		Header: types.BlockHeader{
+			ParentHash:      common.Hash{},
+			TransactionHash: common.Hash{},
+			Height:          0,
+			// The genesis file has seconds, headers milliseconds
+			Timestamp: g.Timestamp * 1000,
+			Extra:     crypto.Keccak256(spec),
+		},
+		Transactions: make([]types.Tx, 0),
+	}
+}
+
+func (g *Genesis) Hash() common.Hash {
+	return g.Block().BlockHash()
+}
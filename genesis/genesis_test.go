@@ -0,0 +1,54 @@
+package genesis
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+type genesisVectors struct {
+	Genesis []struct {
+		Name      string          `json:"name"`
+		Spec      json.RawMessage `json:"spec"`
+		Canonical hexutil.Bytes   `json:"canonical"`
+		SpecHash  common.Hash     `json:"specHash"`
+		Hash      common.Hash     `json:"hash"`
+	} `json:"genesis"`
+}
+
+func TestGenesisHashVectors(t *testing.T) {
+	data, err := os.ReadFile("../core/types/testdata/hash_vectors.json")
+	require.NoError(t, err)
+	var vectors genesisVectors
+	require.NoError(t, json.Unmarshal(data, &vectors))
+	require.NotEmpty(t, vectors.Genesis)
+
+	for _, v := range vectors.Genesis {
+		t.Run(v.Name, func(t *testing.T) {
+			var g Genesis
+			require.NoError(t, json.Unmarshal(v.Spec, &g))
+
+			canonical, err := g.CanonicalBytes()
+			require.NoError(t, err)
+			require.Equal(t, []byte(v.Canonical), canonical)
+			require.Equal(t, v.SpecHash, common.BytesToHash(crypto.Keccak256(canonical)))
+			require.Equal(t, v.Hash, g.Hash())
+		})
+	}
+}
+
+func TestGenesisHashIgnoresJsonLayout(t *testing.T) {
+	a := `{"chainId":1,"timestamp":0,"blockTime":"5s","validators":[],"alloc":{"0x0000000000000000000000000000000000000001":1,"0x0000000000000000000000000000000000000002":2}}`
+	b := `{"alloc":{"0x0000000000000000000000000000000000000002":2,"0x0000000000000000000000000000000000000001":1},"blockTime":"5000ms","validators":[],"timestamp":0,"chainId":1}`
+
+	var ga, gb Genesis
+	require.NoError(t, json.Unmarshal([]byte(a), &ga))
+	require.NoError(t, json.Unmarshal([]byte(b), &gb))
+	require.Equal(t, ga.Hash(), gb.Hash())
+	require.Equal(t, Default().Hash(), (&Genesis{ChainID: 1337, BlockTime: Duration(5 * time.Second)}).Hash())
+}
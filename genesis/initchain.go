@@ -1,36 +1,66 @@
 package genesis
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"minchain/core"
 	"minchain/database"
+	"minchain/logging"
 )
 
-func InitializeGenesisState(db database.Database) error {
-	blockchainHashes, err := core.PrintBlockHashes(db)
-	log.Println("InitializeGenesisState. Current blockchain:", blockchainHashes)
+var logger = logging.Logger(logging.Chain)
+
+var ErrorGenesisMismatch = errors.New("database was initialized with a different genesis")
+
+func InitializeGenesisState(db database.Database, genesis *Genesis) error {
+	genesisBlock := genesis.Block()
+	genesisHash := genesisBlock.BlockHash()
+	logger.Info("Genesis", "hash", genesisHash, "chainId", genesis.ChainID)
+
+	storedGenesis, err := db.GetGenesis()
+	genesisStored := err == nil
+	if genesisStored && storedGenesis != genesisHash {
+		return fmt.Errorf("%w: stored %s, configured %s", ErrorGenesisMismatch, storedGenesis.Hex(), genesisHash.Hex())
+	}
+	if err != nil && !errors.Is(err, database.ErrorGenesisNotSet) {
+		return err
+	}
+
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		blockchainHashes, _ := core.PrintBlockHashes(db)
+		logger.Debug("Stored chain", "hashes", blockchainHashes)
+	}
 
 	head, err := db.GetHead()
 	if err == nil {
-		log.Println("Head exists, no need to initialise genesis. ", head.Hex())
-		return nil
+		logger.Info("Chain already initialized", "head", head)
+		if genesisStored {
+			return nil
+		}
+
+		// Databases created before the genesis hash was stored only have the genesis block itself to compare with
+		if _, err := db.GetBlockByHash(genesisHash); err != nil {
+			return fmt.Errorf("%w: genesis block %s not found", ErrorGenesisMismatch, genesisHash.Hex())
+		}
+		return db.SetGenesis(genesisHash)
 	}
 
 	if err != nil && !errors.Is(err, database.ErrorHeadBlockNotSet) {
 		return err
 	}
 
-	log.Println("Initializing genesis")
+	logger.Info("Initializing genesis")
 
-	err = db.PutBlock(&core.GenesisBlock)
+	err = db.PutBlock(genesisBlock)
 	if err != nil {
 		return err
 	}
-	err = db.SetHead(core.GenesisBlock.BlockHash())
+	err = db.SetHead(genesisHash)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return db.SetGenesis(genesisHash)
 }
@@ -0,0 +1,34 @@
+package genesis
+
+import (
+	"github.com/stretchr/testify/require"
+	"minchain/database"
+	"testing"
+)
+
+func TestInitializeGenesisState(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	g := Default()
+
+	require.NoError(t, InitializeGenesisState(db, g))
+	head, _ := db.GetHead()
+	stored, _ := db.GetGenesis()
+	require.Equal(t, g.Hash(), head)
+	require.Equal(t, g.Hash(), stored)
+
+	// Restarting with the same genesis is fine
+	require.NoError(t, InitializeGenesisState(db, g))
+
+	other := Default()
+	other.ChainID = 7
+	require.NotEqual(t, g.Hash(), other.Hash())
+	require.ErrorIs(t, InitializeGenesisState(db, other), ErrorGenesisMismatch)
+}
+
+func TestLoad(t *testing.T) {
+	g, err := Load("../genesis.json")
+	require.NoError(t, err)
+	require.Equal(t, uint64(7001), g.ChainID)
+	require.Len(t, g.Validators, 1)
+	require.NotEqual(t, Default().Hash(), g.Hash())
+}
@@ -0,0 +1,26 @@
+// Package httpjson writes the JSON responses of the node's HTTP endpoints, so they all look the same to clients
+package httpjson
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// ErrorResponse is the body of every error answer
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func Write(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// The default logger is the node's once logging is configured, the logging package itself uses this one
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Warn("Error encoding the response", "err", err)
+	}
+}
+
+func WriteError(w http.ResponseWriter, status int, message string) {
+	Write(w, status, ErrorResponse{Error: message})
+}
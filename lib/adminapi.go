@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"context"
+	"minchain/httpjson"
+	"net/http"
+)
+
+// AdminApi serves operator endpoints. It's separate from HttpApi so it can stay bound to a private interface.
+type AdminApi struct {
+	server *http.Server
+	mux    *http.ServeMux
+}
+
+func NewAdminApi(addr string) *AdminApi {
+	apiLogger.Info("Admin API will listen", "addr", addr)
+	mux := http.NewServeMux()
+	return &AdminApi{
+		mux:    mux,
+		server: &http.Server{Addr: addr, Handler: mux},
+	}
+}
+
+func (api *AdminApi) Handle(pattern string, handler http.Handler) {
+	api.mux.Handle(pattern, handler)
+}
+
+// HandleJSON serves the value returned by fn as JSON on GET requests
+func (api *AdminApi) HandleJSON(pattern string, fn func() interface{}) {
+	api.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		httpjson.Write(w, http.StatusOK, fn())
+	})
+}
+
+func (api *AdminApi) Start() error {
+	return api.server.ListenAndServe()
+}
+
+func (api *AdminApi) Stop(ctx context.Context) error {
+	return api.server.Shutdown(ctx)
+}
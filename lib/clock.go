@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is where everything time dependent gets the time from, so tests can replace it with a ManualClock
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+// NewSystemClock returns the wall clock
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{ticker: time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// ManualClock only moves when Advance is called. Timers and tickers fire during Advance and, like the time
+// package, a ticker drops ticks its reader isn't ready for.
+type ManualClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*manualTimer
+}
+
+type manualTimer struct {
+	clock  *ManualClock
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	return c.schedule(d, 0).c
+}
+
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return c.schedule(d, d)
+}
+
+func (c *ManualClock) schedule(d time.Duration, period time.Duration) *manualTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	timer := &manualTimer{clock: c, at: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, timer)
+	return timer
+}
+
+// Advance moves the clock forward and fires every timer and ticker which became due
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, timer := range c.waiters {
+		if !timer.at.After(c.now) {
+			select {
+			case timer.c <- timer.at:
+			default:
+			}
+			if timer.period == 0 {
+				continue
+			}
+			// Catch up like time.Ticker does: one tick delivered, the missed ones dropped
+			for !timer.at.After(c.now) {
+				timer.at = timer.at.Add(timer.period)
+			}
+		}
+		waiting = append(waiting, timer)
+	}
+	c.waiters = waiting
+}
+
+// Waiters is the number of pending timers and tickers, tests use it to wait until a goroutine is waiting on the clock
+func (c *ManualClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	for i, timer := range t.clock.waiters {
+		if timer == t {
+			t.clock.waiters = append(t.clock.waiters[:i], t.clock.waiters[i+1:]...)
+			return
+		}
+	}
+}
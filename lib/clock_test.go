@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+
+	ticker := clock.NewTicker(time.Second)
+	timer := clock.After(3 * time.Second)
+
+	clock.Advance(500 * time.Millisecond)
+	require.Len(t, ticker.C(), 0)
+
+	clock.Advance(500 * time.Millisecond)
+	require.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// Like time.Ticker, ticks nobody read in time are dropped
+	clock.Advance(5 * time.Second)
+	require.Len(t, ticker.C(), 1)
+	require.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	require.Equal(t, start.Add(3*time.Second), <-timer)
+	require.Equal(t, 6*time.Second, clock.Since(start))
+
+	ticker.Stop()
+	require.Zero(t, clock.Waiters())
+	clock.Advance(time.Second)
+	require.Len(t, ticker.C(), 0)
+}
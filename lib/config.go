@@ -2,20 +2,66 @@ package lib
 
 import (
 	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/common"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
-	"log"
+	"minchain/logging"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var configLogger = logging.Logger(logging.Node)
+
 type Config struct {
+	DataDir         string
 	ListeningPort   int
 	PrivateKey      *ecdsa.PrivateKey
 	IsBlockProducer bool
 	BlockTime       time.Duration
 	Inputs          []string
+	ChainCheck      string
+	GenesisFile     string
+	BootstrapPeers  []string
+	EnableDHT       bool
+	EnableMDNS      bool
+	AdminAddr       string
+	// ProbeAddr serves the liveness and readiness probes. Unlike the admin API it's reachable by an orchestrator.
+	ProbeAddr string
+	// WireVersions are the gossip wire versions to subscribe and publish to, only the newest by default and two of them
+	// during an upgrade
+	WireVersions []int
+	// CompactBlocks announces produced blocks as header and short transaction IDs instead of in full
+	CompactBlocks bool
+	// NodeSigning lets inputs submit plain messages which the node signs with its own key. Off by default, clients
+	// submit transactions they signed themselves.
+	NodeSigning bool
+	// Health holds the thresholds of the readiness check
+	Health HealthThresholds
+	// LogFormat is text or json, LogLevel the initial level of every subsystem, e.g. debug or info
+	LogFormat string
+	LogLevel  string
+	// TraceExporter is where spans go, off, stdout or file, in which case they're appended to TraceFile as OTLP JSON
+	TraceExporter string
+	TraceFile     string
+	// ChainID and GenesisHash come from the genesis, they are set once the genesis is loaded
+	ChainID     uint64
+	GenesisHash common.Hash
+}
+
+// HealthThresholds decide when a node is ready to serve traffic. Ages are in block times, so they scale with the chain.
+type HealthThresholds struct {
+	// MinPeers is how many peers a ready node is connected to
+	MinPeers int
+	// MaxHeadAge is how many block times old the head may be. 0, the default, turns the check off: blocks are only
+	// produced when there are transactions, so the head of an idle chain, or a fresh one's genesis, gets old without
+	// anything being wrong. Worth turning on for chains with steady traffic.
+	MaxHeadAge int
+	// MaxBlocksBehind is how far behind the highest peer the node may be before it counts as syncing
+	MaxBlocksBehind int64
+	// MaxProducerStall is how many block times the block producer may go without waking up
+	MaxProducerStall int
 }
 
 const (
@@ -23,12 +69,42 @@ const (
 	INPUT_API   = "api"
 )
 
-func InitConfig() Config {
+const (
+	CHAIN_CHECK_OFF    = "off"
+	CHAIN_CHECK_VERIFY = "verify"
+	CHAIN_CHECK_REPAIR = "repair"
+)
+
+// DefaultWireVersion is the gossip wire version nodes speak unless WIRE_VERSIONS says otherwise, the newest one
+// (p2p.CurrentWireVersion)
+const DefaultWireVersion = 3
+
+// DataDir holds the chain database and the node's p2p identity
+func DataDir() string {
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "/tmp/minchain"
+	}
+	return dataDir
+}
+
+// ListeningPort is the p2p port, false when P2P_PORT is not set
+func ListeningPort() (int, bool) {
 	portStr := os.Getenv("P2P_PORT")
 	if portStr == "" {
-		log.Fatal("unknown p2p port")
+		return 0, false
 	}
 	port, _ := strconv.Atoi(portStr)
+	return port, true
+}
+
+func InitConfig() Config {
+	dataDir := DataDir()
+
+	port, ok := ListeningPort()
+	if !ok {
+		logging.Fatal(configLogger, "P2P_PORT is not set")
+	}
 
 	isBlockProducerStr := os.Getenv("IS_BLOCK_PRODUCER")
 	isBlockProducer := false
@@ -43,16 +119,128 @@ func InitConfig() Config {
 		inputs = strings.Split(inputsStr, ",")
 	}
 
+	// verify (default) refuses to start on a corrupted chain, repair rolls the head back to the last good block
+	chainCheck := os.Getenv("CHAIN_CHECK")
+	switch chainCheck {
+	case "":
+		chainCheck = CHAIN_CHECK_VERIFY
+	case CHAIN_CHECK_OFF, CHAIN_CHECK_VERIFY, CHAIN_CHECK_REPAIR:
+	default:
+		logging.Fatal(configLogger, "Invalid chain check, expected off, verify or repair", "value", chainCheck)
+	}
+
+	// Expects comma-separated multiaddrs including the peer ID, e.g. /ip4/10.0.0.1/tcp/8000/p2p/12D3KooW...
+	var bootstrapPeers []string
+	bootstrapPeersStr := os.Getenv("BOOTSTRAP_PEERS")
+	if bootstrapPeersStr != "" {
+		bootstrapPeers = strings.Split(bootstrapPeersStr, ",")
+	}
+
+	enableDHT := os.Getenv("ENABLE_DHT") == "true"
+	// mDNS is on unless explicitly disabled
+	enableMDNS := os.Getenv("ENABLE_MDNS") != "false"
+
+	// Admin endpoints expose peer details, so they only listen locally unless configured otherwise
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr == "" {
+		adminAddr = "127.0.0.1:6060"
+	}
+
+	// Probes only tell whether the node is healthy, so they can listen on every interface
+	probeAddr := os.Getenv("PROBE_ADDR")
+	if probeAddr == "" {
+		probeAddr = "0.0.0.0:6061"
+	}
+
+	// Expects comma-separated versions. Every message is published and validated once per version, so nodes only
+	// speak one by default. Networks with nodes which don't know version 3 yet set WIRE_VERSIONS=2,3 until they've
+	// upgraded, add 1 if some nodes still only speak JSON. Trace context only travels on version 3.
+	wireVersions := []int{DefaultWireVersion}
+	wireVersionsStr := os.Getenv("WIRE_VERSIONS")
+	if wireVersionsStr != "" {
+		wireVersions = wireVersions[:0]
+		for _, v := range strings.Split(wireVersionsStr, ",") {
+			version, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				logging.Fatal(configLogger, "Invalid wire version", "version", v)
+			}
+			wireVersions = append(wireVersions, version)
+		}
+	}
+
+	// Every node receives compact blocks, only publishing them is opt-in until the whole network has upgraded
+	compactBlocks := os.Getenv("COMPACT_BLOCKS") == "true"
+
+	// Signing messages makes the node operator the sender of every transaction, so it has to be asked for
+	nodeSigning := os.Getenv("NODE_SIGNING") == "true"
+
+	health := HealthThresholds{
+		MinPeers:         intEnv("READY_MIN_PEERS", 1),
+		MaxHeadAge:       intEnv("READY_MAX_HEAD_AGE", 0),
+		MaxBlocksBehind:  int64(intEnv("READY_MAX_BLOCKS_BEHIND", 2)),
+		MaxProducerStall: intEnv("READY_MAX_PRODUCER_STALL", 3),
+	}
+
+	logFormat := os.Getenv("LOG_FORMAT")
+	if logFormat == "" {
+		logFormat = "text"
+	}
+	logLevel := os.Getenv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+
+	traceExporter := os.Getenv("TRACE_EXPORTER")
+	if traceExporter == "" {
+		traceExporter = "off"
+	}
+	traceFile := os.Getenv("TRACE_FILE")
+	if traceFile == "" {
+		traceFile = filepath.Join(dataDir, "traces.jsonl")
+	}
+
+	// Empty means the default development genesis
+	genesisFile := os.Getenv("GENESIS_FILE")
+
 	privateKey, err := ethcrypto.LoadECDSA(".pk")
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal(configLogger, "Error loading the private key", "err", err)
 	}
 
 	return Config{
+		DataDir:         dataDir,
 		ListeningPort:   port,
 		IsBlockProducer: isBlockProducer,
 		PrivateKey:      privateKey,
-		BlockTime:       5 * time.Second,
+		BlockTime:       5 * time.Second, // overridden by the genesis
 		Inputs:          inputs,
+		ChainCheck:      chainCheck,
+		GenesisFile:     genesisFile,
+		BootstrapPeers:  bootstrapPeers,
+		EnableDHT:       enableDHT,
+		EnableMDNS:      enableMDNS,
+		AdminAddr:       adminAddr,
+		ProbeAddr:       probeAddr,
+		WireVersions:    wireVersions,
+		CompactBlocks:   compactBlocks,
+		NodeSigning:     nodeSigning,
+		Health:          health,
+		LogFormat:       logFormat,
+		LogLevel:        logLevel,
+		TraceExporter:   traceExporter,
+		TraceFile:       traceFile,
+	}
+}
+
+// intEnv reads a non-negative integer, falling back to defaultValue when the variable isn't set
+func intEnv(name string, defaultValue int) int {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil || value < 0 {
+		logging.Fatal(configLogger, "Invalid value", "name", name, "value", str)
 	}
+	return value
 }
@@ -2,45 +2,172 @@ package lib
 
 import (
 	"context"
-	"io"
-	"log"
+	"encoding/json"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"minchain/core/types"
+	"minchain/httpjson"
+	"minchain/logging"
+	"minchain/tracing"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	submissionQueueSize = 100
+	submitTimeout       = 5 * time.Second
+	maxSubmissionSize   = 64 * 1024
+)
+
+var (
+	ErrorInvalidSubmission  = errors.New("exactly one of transaction and message must be set")
+	ErrorNotAccepting       = errors.New("node is not accepting transactions yet")
+	ErrorTooManySubmissions = errors.New("too many pending submissions")
+	ErrorSubmitTimeout      = errors.New("timed out waiting for the node")
+)
+
+var (
+	apiLogger = logging.Logger(logging.Api)
+	apiTracer = tracing.Tracer(logging.Api)
 )
 
 type HttpApi struct {
-	server   *http.Server
-	mux      *http.ServeMux
-	messages chan string
+	server      *http.Server
+	mux         *http.ServeMux
+	submissions chan *Submission
+	consuming   atomic.Bool
+	clock       Clock
+}
+
+// SubmitRequest is the body of a transaction submission, either a signed transaction or a message for the node to
+// sign when node signing is on. Metadata is echoed back and logged, it's not part of the transaction.
+type SubmitRequest struct {
+	Transaction *types.Tx         `json:"transaction,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type SubmitResponse struct {
+	SubmitResult
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
-func NewHttpApi(addr string) *HttpApi {
-	log.Println("HTTP will listen on", addr)
+// SubmitPath is where transactions are submitted
+const SubmitPath = "/tx"
+
+func NewHttpApi(addr string, clock Clock) *HttpApi {
+	apiLogger.Info("HTTP API will listen", "addr", addr)
 	mux := http.NewServeMux()
 	api := &HttpApi{
-		mux:      mux,
-		messages: make(chan string, 100),
-		server:   &http.Server{Addr: addr, Handler: mux},
+		mux:         mux,
+		submissions: make(chan *Submission, submissionQueueSize),
+		server:      &http.Server{Addr: addr, Handler: mux},
+		clock:       clock,
 	}
 
-	mux.HandleFunc("/", api.handleRequest)
+	mux.HandleFunc(SubmitPath, api.handleSubmit)
 	return api
 }
 
-func (api *HttpApi) handleRequest(w http.ResponseWriter, r *http.Request) {
-	log.Println("received HTTP request")
+// Handle registers more routes next to the transaction submission one
+func (api *HttpApi) Handle(pattern string, handler http.Handler) {
+	api.mux.Handle(pattern, handler)
+}
 
+// handleSubmit queues the message and waits for the node to sign it and try adding it to the mempool. A full queue
+// gets a 429 rather than blocking the client.
+func (api *HttpApi) handleSubmit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		httpjson.WriteError(w, http.StatusMethodNotAllowed, "only POST method is allowed")
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	var request SubmitRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubmissionSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpjson.WriteError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		httpjson.WriteError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	submission, err := request.Submission()
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		httpjson.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	api.messages <- string(body)
+	ctx, span := apiTracer.Start(r.Context(), "http.submit", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	result, err := api.Submit(ctx, submission)
+	span.SetAttributes(attribute.String("tx.hash", result.Hash.Hex()), attribute.Bool("tx.accepted", result.Accepted))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	} else if result.Err != nil {
+		span.SetStatus(codes.Error, result.Err.Error())
+	}
+	switch {
+	case errors.Is(err, ErrorTooManySubmissions):
+		w.Header().Set("Retry-After", "1")
+		httpjson.WriteError(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, ErrorNotAccepting), errors.Is(err, ErrorSubmitTimeout):
+		httpjson.WriteError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		// The client went away
+	case errors.Is(result.Err, ErrorNodeSigningDisabled):
+		httpjson.WriteError(w, http.StatusForbidden, result.Err.Error())
+	case result.Err != nil:
+		apiLogger.Error("Submission error", "err", result.Err)
+		httpjson.WriteError(w, http.StatusInternalServerError, result.Err.Error())
+	case result.Accepted:
+		apiLogger.Info("Transaction submitted", "hash", result.Hash, "metadata", request.Metadata)
+		httpjson.Write(w, http.StatusAccepted, SubmitResponse{SubmitResult: result, Metadata: request.Metadata})
+	default:
+		httpjson.Write(w, http.StatusUnprocessableEntity, SubmitResponse{SubmitResult: result, Metadata: request.Metadata})
+	}
+}
+
+// Submission checks exactly one of the transaction and the message is set
+func (request SubmitRequest) Submission() (*Submission, error) {
+	if (request.Transaction == nil) == (strings.TrimSpace(request.Message) == "") {
+		return nil, ErrorInvalidSubmission
+	}
+	if request.Transaction != nil {
+		return NewSignedSubmission(request.Transaction, request.Metadata), nil
+	}
+	return NewSubmission(request.Message, request.Metadata), nil
+}
+
+// Submit queues the submission and waits for its result. It doesn't block when the queue is full, so other APIs can
+// use it to accept transactions too.
+func (api *HttpApi) Submit(ctx context.Context, submission *Submission) (SubmitResult, error) {
+	if !api.consuming.Load() {
+		return SubmitResult{}, ErrorNotAccepting
+	}
+	submission.spanContext = trace.SpanContextFromContext(ctx)
+
+	select {
+	case api.submissions <- submission:
+	default:
+		return SubmitResult{}, ErrorTooManySubmissions
+	}
+
+	select {
+	case result := <-submission.Result():
+		return result, nil
+	case <-api.clock.After(submitTimeout):
+		// The submission stays queued, it may still be sent
+		return SubmitResult{}, ErrorSubmitTimeout
+	case <-ctx.Done():
+		return SubmitResult{}, ctx.Err()
+	}
 }
 
 func (api *HttpApi) Start() error {
@@ -51,6 +178,7 @@ func (api *HttpApi) Stop(ctx context.Context) error {
 	return api.server.Shutdown(ctx)
 }
 
-func (api *HttpApi) InputChannel(ctx context.Context) <-chan string {
-	return api.messages
+func (api *HttpApi) InputChannel(ctx context.Context) <-chan *Submission {
+	api.consuming.Store(true)
+	return api.submissions
 }
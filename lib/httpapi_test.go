@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpApiSubmit(t *testing.T) {
+	api := NewHttpApi("127.0.0.1:0", NewSystemClock())
+
+	// Nothing reads submissions until the node starts
+	require.Equal(t, http.StatusServiceUnavailable, submit(api, `{"message":"hello"}`).Code)
+
+	submissions := api.InputChannel(context.Background())
+	go func() {
+		for submission := range submissions {
+			if submission.Message == "rejected" {
+				submission.Resolve(SubmitResult{Hash: common.Hash{2}, Reason: "invalid transaction"})
+				continue
+			}
+			submission.Resolve(SubmitResult{Hash: common.Hash{1}, Accepted: true})
+		}
+	}()
+
+	response := submit(api, `{"message":"hello","metadata":{"client":"test"}}`)
+	require.Equal(t, http.StatusAccepted, response.Code)
+	var result SubmitResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+	require.Equal(t, common.Hash{1}, result.Hash)
+	require.True(t, result.Accepted)
+	require.Equal(t, "test", result.Metadata["client"])
+
+	response = submit(api, `{"message":"rejected"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+	require.False(t, result.Accepted)
+	require.Equal(t, "invalid transaction", result.Reason)
+
+	require.Equal(t, http.StatusBadRequest, submit(api, `hello`).Code)
+	require.Equal(t, http.StatusBadRequest, submit(api, `{"message":" "}`).Code)
+	require.Equal(t, http.StatusBadRequest, submit(api, `{"message":"hello","unknown":1}`).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, submit(api, `{"message":"`+strings.Repeat("a", maxSubmissionSize)+`"}`).Code)
+}
+
+func TestHttpApiBackpressure(t *testing.T) {
+	api := NewHttpApi("127.0.0.1:0", NewSystemClock())
+	// The node consumes submissions but is stuck, so the queue fills up
+	api.InputChannel(context.Background())
+	for i := 0; i < submissionQueueSize; i++ {
+		api.submissions <- NewSubmission("queued", nil)
+	}
+
+	response := submit(api, `{"message":"hello"}`)
+	require.Equal(t, http.StatusTooManyRequests, response.Code)
+	require.Equal(t, "1", response.Header().Get("Retry-After"))
+}
+
+func TestHttpApiSubmitTimeout(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	api := NewHttpApi("127.0.0.1:0", clock)
+	// The node takes submissions but never answers
+	api.InputChannel(context.Background())
+
+	responses := make(chan *httptest.ResponseRecorder)
+	go func() { responses <- submit(api, `{"message":"hello"}`) }()
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(submitTimeout)
+
+	response := <-responses
+	require.Equal(t, http.StatusServiceUnavailable, response.Code)
+	require.Contains(t, response.Body.String(), ErrorSubmitTimeout.Error())
+}
+
+func TestHttpApiSubmitPath(t *testing.T) {
+	api := NewHttpApi("127.0.0.1:0", NewSystemClock())
+	api.InputChannel(context.Background())
+
+	recorder := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"message":"hello"}`)))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHttpApiSignedSubmission(t *testing.T) {
+	api := NewHttpApi("127.0.0.1:0", NewSystemClock())
+	submissions := api.InputChannel(context.Background())
+	go func() {
+		for submission := range submissions {
+			if submission.Tx == nil {
+				submission.Resolve(SubmitResult{Err: ErrorNodeSigningDisabled})
+				continue
+			}
+			submission.Resolve(SubmitResult{Hash: common.Hash{1}, Accepted: submission.Tx.Data == "hello"})
+		}
+	}()
+
+	require.Equal(t, http.StatusAccepted, submit(api, `{"transaction":{"from":"0x01","data":"hello","sig":"AAE="}}`).Code)
+	require.Equal(t, http.StatusForbidden, submit(api, `{"message":"hello"}`).Code)
+	require.Equal(t, http.StatusBadRequest, submit(api, `{"transaction":{"data":"hello"},"message":"hello"}`).Code)
+	require.Equal(t, http.StatusBadRequest, submit(api, `{}`).Code)
+}
+
+func submit(api *HttpApi, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, SubmitPath, strings.NewReader(body)))
+	return recorder
+}
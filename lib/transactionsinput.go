@@ -3,14 +3,75 @@ package lib
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"minchain/core/types"
 	"os"
 	"strings"
 )
 
 type TransactionsInput interface {
-	InputChannel(ctx context.Context) <-chan string
+	InputChannel(ctx context.Context) <-chan *Submission
+}
+
+var ErrorNodeSigningDisabled = errors.New("node signing is disabled, submit a signed transaction")
+
+// Submission is either a transaction the client signed or a message for the node to sign. Inputs which report the
+// outcome back wait on Result.
+type Submission struct {
+	Tx       *types.Tx
+	Message  string
+	Metadata map[string]string
+	result   chan SubmitResult
+	// spanContext is the span of whoever submitted it, e.g. the HTTP request
+	spanContext trace.SpanContext
+}
+
+// SubmitResult tells whether the transaction made it into the local mempool. Err is set when it couldn't even be built.
+type SubmitResult struct {
+	Hash     common.Hash `json:"hash"`
+	Accepted bool        `json:"accepted"`
+	Reason   string      `json:"reason,omitempty"`
+	Err      error       `json:"-"`
+}
+
+func NewSubmission(message string, metadata map[string]string) *Submission {
+	return &Submission{
+		Message:  message,
+		Metadata: metadata,
+		result:   make(chan SubmitResult, 1),
+	}
+}
+
+func NewSignedSubmission(tx *types.Tx, metadata map[string]string) *Submission {
+	return &Submission{
+		Tx:       tx,
+		Metadata: metadata,
+		result:   make(chan SubmitResult, 1),
+	}
+}
+
+// Resolve never blocks, inputs are free to ignore the result
+func (s *Submission) Resolve(result SubmitResult) {
+	select {
+	case s.result <- result:
+	default:
+	}
+}
+
+func (s *Submission) Result() <-chan SubmitResult {
+	return s.result
+}
+
+// WithTrace returns ctx carrying the submitter's span, so processing the submission continues its trace
+func (s *Submission) WithTrace(ctx context.Context) context.Context {
+	if !s.spanContext.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithSpanContext(ctx, s.spanContext)
 }
 
 type UserInput struct {
@@ -23,8 +84,8 @@ func NewUserInput() TransactionsInput {
 	}
 }
 
-func (ui *UserInput) InputChannel(ctx context.Context) <-chan string {
-	messages := make(chan string)
+func (ui *UserInput) InputChannel(ctx context.Context) <-chan *Submission {
+	messages := make(chan *Submission)
 
 	go func() {
 		defer close(messages)
@@ -32,22 +93,69 @@ func (ui *UserInput) InputChannel(ctx context.Context) <-chan string {
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("context cancelled")
+				return
 			default:
 				fmt.Print("> ")
 				message, err := ui.reader.ReadString('\n')
-				if err != nil {
+				if err != nil && !errors.Is(err, io.EOF) {
 					fmt.Println("Error reading the message from stdin:", err)
-					break
+					return
 				}
-				message = strings.TrimSuffix(message, "\n")
-				if message == "" {
-					continue
+				// Stdin is closed after the last line, e.g. when it's not a terminal
+				if !submitLine(ctx, messages, strings.TrimSuffix(message, "\n")) || err != nil {
+					return
 				}
-				messages <- message
 			}
 		}
 	}()
 
 	return messages
 }
+
+// submitLine hands a line to the node and prints the outcome. It's false when ctx is done first.
+func submitLine(ctx context.Context, messages chan<- *Submission, line string) bool {
+	if line == "" {
+		return true
+	}
+	submission, err := parseUserInput(line)
+	if err != nil {
+		fmt.Println("Error parsing the transaction:", err)
+		return true
+	}
+
+	select {
+	case messages <- submission:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case result := <-submission.Result():
+		printResult(result)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseUserInput reads a line starting with { as a signed transaction in JSON, anything else is a message to sign
+func parseUserInput(line string) (*Submission, error) {
+	if !strings.HasPrefix(line, "{") {
+		return NewSubmission(line, nil), nil
+	}
+	tx, err := types.TransactionFromJSON([]byte(line))
+	if err != nil {
+		return nil, err
+	}
+	return NewSignedSubmission(tx, nil), nil
+}
+
+func printResult(result SubmitResult) {
+	switch {
+	case result.Err != nil:
+		fmt.Println("Error sending the transaction:", result.Err)
+	case result.Accepted:
+		fmt.Println("Transaction", result.Hash.Hex(), "accepted")
+	default:
+		fmt.Println("Transaction", result.Hash.Hex(), "rejected:", result.Reason)
+	}
+}
@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserInputStopsAtEOF(t *testing.T) {
+	input := &UserInput{reader: bufio.NewReader(strings.NewReader("hello\n\nworld"))}
+	messages := input.InputChannel(context.Background())
+
+	for _, expected := range []string{"hello", "world"} {
+		submission := <-messages
+		require.Equal(t, expected, submission.Message)
+		submission.Resolve(SubmitResult{Accepted: true})
+	}
+	_, ok := <-messages
+	require.False(t, ok)
+}
+
+func TestUserInputStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	input := &UserInput{reader: bufio.NewReader(strings.NewReader("hello\n"))}
+	messages := input.InputChannel(ctx)
+
+	// Nobody takes the submission or resolves it
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-messages:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+}
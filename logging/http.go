@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"minchain/httpjson"
+	"net/http"
+)
+
+const maxLevelRequestSize = 1024
+
+// LevelRequest changes the level of one subsystem, or of all of them without a subsystem
+type LevelRequest struct {
+	Subsystem string `json:"subsystem,omitempty"`
+	Level     string `json:"level"`
+}
+
+// Handler lists the level of every subsystem on GET and changes them on PUT, answering with the new levels
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var request LevelRequest
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLevelRequestSize))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&request); err != nil {
+				httpjson.WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			level, err := ParseLevel(request.Level)
+			if err != nil {
+				httpjson.WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if request.Subsystem != "" && !hasLogger(request.Subsystem) {
+				httpjson.WriteError(w, http.StatusNotFound, fmt.Sprintf("unknown subsystem %q", request.Subsystem))
+				return
+			}
+			SetLevel(request.Subsystem, level)
+			Logger(Node).Info("Log level changed", "subsystem", request.Subsystem, "level", level)
+		default:
+			httpjson.WriteError(w, http.StatusMethodNotAllowed, "only GET and PUT methods are allowed")
+			return
+		}
+		httpjson.Write(w, http.StatusOK, Levels())
+	})
+}
@@ -0,0 +1,199 @@
+// Package logging hands out a structured logger per subsystem. Every subsystem has its own level, which can be
+// changed while the node runs.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Subsystems, they end up in the subsystem attribute of every record
+const (
+	Node      = "node"
+	Chain     = "chain"
+	P2p       = "p2p"
+	Mempool   = "mempool"
+	Producer  = "producer"
+	Validator = "validator"
+	Db        = "db"
+	Api       = "api"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	lock   sync.Mutex
+	levels = make(map[string]*slog.LevelVar)
+	// defaultLevel is the level of subsystems which haven't been set on their own
+	defaultLevel slog.Level = slog.LevelInfo
+
+	// output formats and writes records, levels are checked before they get there
+	output atomic.Pointer[slog.Handler]
+)
+
+func init() {
+	setOutput(os.Stderr, FormatText)
+}
+
+// Logger returns the logger of a subsystem. It can be created before Configure, e.g. in a package variable, and
+// follows later changes of the format and the level.
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&handler{
+		level: levelVar(subsystem),
+		attrs: []slog.Attr{slog.String("subsystem", subsystem)},
+	})
+}
+
+// Configure sets the format, text or json, and the level of every subsystem. The standard library's log package is
+// sent to the node logger, so nothing bypasses the format.
+func Configure(w io.Writer, format string, level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if err := setOutput(w, format); err != nil {
+		return err
+	}
+	SetLevel("", parsed)
+	slog.SetDefault(Logger(Node))
+	return nil
+}
+
+func setOutput(w io.Writer, format string) error {
+	// Subsystem handlers do the filtering
+	options := &slog.HandlerOptions{Level: slog.Level(math.MinInt)}
+
+	var h slog.Handler
+	switch format {
+	case FormatText, "":
+		h = slog.NewTextHandler(w, options)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+	output.Store(&h)
+	return nil
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+	return parsed, nil
+}
+
+// SetLevel changes the level of one subsystem, or of all of them when subsystem is empty
+func SetLevel(subsystem string, level slog.Level) {
+	if subsystem != "" {
+		levelVar(subsystem).Set(level)
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	defaultLevel = level
+	for _, v := range levels {
+		v.Set(level)
+	}
+}
+
+// Levels returns the level of every subsystem which has a logger
+func Levels() map[string]string {
+	lock.Lock()
+	defer lock.Unlock()
+	result := make(map[string]string, len(levels))
+	for subsystem, v := range levels {
+		result[subsystem] = v.Level().String()
+	}
+	return result
+}
+
+func hasLogger(subsystem string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	_, ok := levels[strings.ToLower(subsystem)]
+	return ok
+}
+
+func levelVar(subsystem string) *slog.LevelVar {
+	subsystem = strings.ToLower(subsystem)
+	lock.Lock()
+	defer lock.Unlock()
+	v, ok := levels[subsystem]
+	if !ok {
+		v = new(slog.LevelVar)
+		v.Set(defaultLevel)
+		levels[subsystem] = v
+	}
+	return v
+}
+
+// handler checks the subsystem's level and passes records on to the current output. Attributes and groups are
+// replayed on the output for every record, so they survive a change of format.
+type handler struct {
+	level *slog.LevelVar
+	attrs []slog.Attr
+	// groups are opened after attrs, with the attributes added in each of them
+	groups []group
+}
+
+type group struct {
+	name  string
+	attrs []slog.Attr
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	out := (*output.Load()).WithAttrs(h.attrs)
+	for _, g := range h.groups {
+		out = out.WithGroup(g.name)
+		if len(g.attrs) > 0 {
+			out = out.WithAttrs(g.attrs)
+		}
+	}
+	return out.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := &handler{level: h.level, attrs: h.attrs, groups: h.groups}
+	if len(clone.groups) == 0 {
+		clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+		return clone
+	}
+	clone.groups = append([]group{}, h.groups...)
+	last := &clone.groups[len(clone.groups)-1]
+	last.attrs = append(append([]slog.Attr{}, last.attrs...), attrs...)
+	return clone
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &handler{
+		level:  h.level,
+		attrs:  h.attrs,
+		groups: append(append([]group{}, h.groups...), group{name: name}),
+	}
+}
+
+// Fatal logs at error level and exits, for the errors the node can't start or continue without
+func Fatal(logger *slog.Logger, msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func configure(t *testing.T, format string, level string) *bytes.Buffer {
+	var buffer bytes.Buffer
+	require.NoError(t, Configure(&buffer, format, level))
+	t.Cleanup(func() { require.NoError(t, Configure(os.Stderr, FormatText, "info")) })
+	return &buffer
+}
+
+func lines(buffer *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestLogger(t *testing.T) {
+	// Created before the output is configured, like package level loggers
+	logger := Logger(P2p).With("peer", "a").WithGroup("block")
+	buffer := configure(t, FormatJSON, "info")
+
+	logger.Debug("Not logged")
+	logger.Info("Received", "height", 2)
+	records := lines(buffer)
+	require.Len(t, records, 1)
+	require.Equal(t, "Received", records[0]["msg"])
+	require.Equal(t, P2p, records[0]["subsystem"])
+	require.Equal(t, "a", records[0]["peer"])
+	require.Equal(t, map[string]interface{}{"height": float64(2)}, records[0]["block"])
+
+	// Levels are per subsystem
+	SetLevel(P2p, slog.LevelDebug)
+	logger.Debug("Logged")
+	Logger(Db).Debug("Not logged")
+	require.Len(t, lines(buffer), 2)
+
+	// The standard library logger ends up in the same output
+	log.Println("From log")
+	records = lines(buffer)
+	require.Len(t, records, 3)
+	require.Equal(t, Node, records[2]["subsystem"])
+
+	require.Error(t, Configure(buffer, "xml", "info"))
+	require.Error(t, Configure(buffer, FormatText, "loud"))
+}
+
+func TestHandler(t *testing.T) {
+	Logger(Mempool)
+	configure(t, FormatText, "info")
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	put := func(body string) *http.Response {
+		request, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	response := put(`{"subsystem":"mempool","level":"debug"}`)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var levels map[string]string
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&levels))
+	require.Equal(t, "DEBUG", levels[Mempool])
+	require.Equal(t, "INFO", levels[Node])
+
+	require.Equal(t, http.StatusBadRequest, put(`{"level":"loud"}`).StatusCode)
+	require.Equal(t, http.StatusNotFound, put(`{"subsystem":"nope","level":"debug"}`).StatusCode)
+
+	// Without a subsystem every level changes
+	require.Equal(t, http.StatusOK, put(`{"level":"warn"}`).StatusCode)
+	response, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&levels))
+	require.Equal(t, "WARN", levels[Mempool])
+	require.Equal(t, "WARN", levels[Node])
+}
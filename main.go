@@ -2,45 +2,113 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/api"
 	"minchain/app"
 	"minchain/core"
 	"minchain/database"
+	"minchain/genesis"
 	"minchain/lib"
+	"minchain/logging"
+	"minchain/metrics"
 	"minchain/monitor"
 	"minchain/p2p"
+	"minchain/rpc"
+	"minchain/tracing"
 	"minchain/validator"
+	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 )
 
+var logger = logging.Logger(logging.Node)
+
 func main() {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// `minchain peer-id` prints the node's identity without starting it, e.g. to build BOOTSTRAP_PEERS. It only needs
+	// the data dir, not the rest of the configuration.
+	if len(os.Args) > 1 && os.Args[1] == "peer-id" {
+		printPeerId(lib.DataDir())
+		return
+	}
+
+	config := lib.InitConfig()
+	if err := logging.Configure(os.Stderr, config.LogFormat, config.LogLevel); err != nil {
+		logging.Fatal(logger, "Invalid logging configuration", "err", err)
+	}
+
 	var db database.Database
-	db, err := database.NewDiskDatabase()
+	db, err := database.NewDiskDatabase(filepath.Join(config.DataDir, "chaindata"))
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal(logger, "Error opening the database", "err", err)
 	}
 
 	defer func(db database.Database) {
 		err := db.Close()
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal(logger, "Error closing the database", "err", err)
 		}
 	}(db)
 
-	config := lib.InitConfig()
-	node, err := p2p.InitNode(ctx, config)
+	chainGenesis := genesis.Default()
+	if config.GenesisFile != "" {
+		chainGenesis, err = genesis.Load(config.GenesisFile)
+		if err != nil {
+			logging.Fatal(logger, "Error loading the genesis", "file", config.GenesisFile, "err", err)
+		}
+	}
+	config.ChainID = chainGenesis.ChainID
+	config.GenesisHash = chainGenesis.Hash()
+	config.BlockTime = time.Duration(chainGenesis.BlockTime)
+
+	events := core.NewEventBus()
+	mempool := core.NewMempool(events, db)
+	clock := lib.NewSystemClock()
+
+	node, err := p2p.InitNode(ctx, config, db, mempool, clock, p2p.MessageValidators{
+		Transaction: core.IsValid,
+		Block:       validator.ValidateStateless,
+	})
+	if err != nil {
+		logging.Fatal(logger, "Error starting the p2p node", "err", err)
+	}
+
+	logger.Info("Initialized p2p node", "id", node.String())
+
+	shutdownTracing, err := tracing.Setup(ctx, config.TraceExporter, config.TraceFile, node.String())
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal(logger, "Error setting up tracing", "err", err)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Error flushing traces", "err", err)
+		}
+	}()
 
-	log.Println("Initalized node: ", node.String())
+	adminApi := lib.NewAdminApi(config.AdminAddr)
+	adminApi.HandleJSON("/admin/peers", func() interface{} {
+		return node.PeerReport()
+	})
+	adminApi.HandleJSON("/admin/relay", func() interface{} {
+		return node.RelayStats()
+	})
+	adminApi.Handle("/metrics", metrics.Handler())
+	adminApi.Handle("/admin/loglevel", logging.Handler())
+	go func() {
+		if err := adminApi.Start(); err != nil {
+			logging.Fatal(logger, "Error starting the admin API", "err", err)
+		}
+	}()
 
-	mempool := core.NewMempool()
-	go monitor.Monitor(ctx, mempool, 1*time.Second)
+	node.Peers.OnAccepted(func(id peer.ID, status p2p.Status) {
+		events.PeerConnected.Publish(core.PeerConnected{ID: id, Status: status})
+	})
+	go monitor.Monitor(ctx, mempool, events)
 
 	var inputs []lib.TransactionsInput
 	for _, i := range config.Inputs {
@@ -48,34 +116,81 @@ func main() {
 		case lib.INPUT_STDIN:
 			inputs = append(inputs, lib.NewUserInput())
 		case lib.INPUT_API:
-			httpApi := lib.NewHttpApi("0.0.0.0:8080")
+			httpApi := lib.NewHttpApi("0.0.0.0:8080", clock)
+			chainApi := api.NewChainApi(db, mempool)
+			chainApi.Register(httpApi)
+			rpcServer := rpc.NewServer()
+			if err := api.RegisterRpc(rpcServer, chainApi, httpApi, node.Peers); err != nil {
+				logging.Fatal(logger, "Error registering RPC methods", "err", err)
+			}
+			if err := api.RegisterSubscriptions(rpcServer, chainApi, events); err != nil {
+				logging.Fatal(logger, "Error registering RPC subscriptions", "err", err)
+			}
+			httpApi.Handle("/rpc", rpcServer)
 			// TODO move into app.start
-			log.Println("before start")
 
 			go func() {
 				err := httpApi.Start()
 				if err != nil {
-					log.Fatal("error starting http: ", err)
+					logging.Fatal(logger, "Error starting the HTTP API", "err", err)
 				}
 			}()
 
 			inputs = append(inputs, httpApi)
 		default:
-			log.Fatalf("Unknown input type: %s", i)
+			logging.Fatal(logger, "Unknown input type", "input", i)
 		}
 	}
 
 	application := app.NewApp(
 		mempool,
 		db,
-		validator.NewBlockValidator(db),
+		validator.NewBlockValidator(db, config.BlockTime, clock),
 		core.NewWallet(config.PrivateKey),
 		config,
 		node.Publisher,
 		node.Consumer,
+		node.Reporter,
 		inputs,
+		chainGenesis,
+		clock,
+		events,
 	)
 	application.Start(ctx)
 
+	health := api.NewHealth(db, node.Peers, clock, config)
+	if producer := application.BlockProducer(); producer != nil {
+		health.WatchProducer(producer)
+	}
+	probes := http.NewServeMux()
+	health.Register(probes)
+	go func() {
+		logger.Info("Probes will listen", "addr", config.ProbeAddr)
+		if err := http.ListenAndServe(config.ProbeAddr, probes); err != nil {
+			logging.Fatal(logger, "Error starting the probes", "err", err)
+		}
+	}()
+
 	select {}
 }
+
+// printPeerId prints the peer ID, followed by the node's addresses when P2P_PORT is set
+func printPeerId(dataDir string) {
+	id, err := p2p.PeerID(dataDir)
+	if err != nil {
+		logging.Fatal(logger, "Error loading the node identity", "err", err)
+	}
+	fmt.Println(id.String())
+
+	port, ok := lib.ListeningPort()
+	if !ok {
+		return
+	}
+	addrs, err := p2p.PeerAddrs(id, port)
+	if err != nil {
+		logging.Fatal(logger, "Error listing the node addresses", "err", err)
+	}
+	for _, addr := range addrs {
+		fmt.Println(addr.String())
+	}
+}
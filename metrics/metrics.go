@@ -0,0 +1,97 @@
+// Package metrics holds the node's Prometheus collectors. They are registered on the default registry, which also
+// exports the Go runtime and process metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "minchain"
+
+// Gossip message directions
+const (
+	In  = "in"
+	Out = "out"
+)
+
+var (
+	HeadHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "head_height",
+		Help:      "Height of the current head block.",
+	})
+	BlocksImported = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blocks_imported_total",
+		Help:      "Blocks received from the network which were validated and stored.",
+	})
+	BlocksRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blocks_rejected_total",
+		Help:      "Blocks received from the network which failed validation, by reason.",
+	}, []string{"reason"})
+	BlockImportDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "block_import_duration_seconds",
+		Help:      "Time from receiving a block to it becoming the head.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	})
+	BlocksProduced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blocks_produced_total",
+		Help:      "Blocks built and published by this node.",
+	})
+
+	MempoolSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mempool_size",
+		Help:      "Pending transactions in the mempool.",
+	})
+	MempoolAdmitted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mempool_admitted_total",
+		Help:      "Transactions added to the mempool.",
+	})
+	MempoolRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mempool_rejected_total",
+		Help:      "Transactions refused by the mempool, by reason.",
+	}, []string{"reason"})
+
+	PeersConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "peers_connected",
+		Help:      "Peers which passed the handshake.",
+	})
+	GossipMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gossip_messages_total",
+		Help:      "Gossip messages delivered from or published to the network, by topic and direction.",
+	}, []string{"topic", "direction"})
+
+	DatabaseSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_size_bytes",
+		Help:      "On-disk size of the database, by part.",
+	}, []string{"part"})
+	DatabaseOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "database_operation_duration_seconds",
+		Help:      "Latency of database operations, by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 16),
+	}, []string{"operation"})
+)
+
+// ObserveSince records the time elapsed since start, meant to be deferred: defer ObserveSince(histogram, time.Now())
+func ObserveSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// Handler serves all registered metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -2,31 +2,52 @@ package monitor
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"minchain/core"
-	"time"
+	"minchain/logging"
 )
 
-// Monitor checks every interval period whether mempool size changed and if so, it prints it.
-func Monitor(ctx context.Context, mpool core.Mempool, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+const eventsBuffer = 256
+
+var (
+	mempoolLogger = logging.Logger(logging.Mempool)
+	p2pLogger     = logging.Logger(logging.P2p)
+)
+
+// Monitor logs transactions entering and leaving the mempool at debug level, and the peers as they connect
+func Monitor(ctx context.Context, mpool core.Mempool, events *core.EventBus) {
+	added := events.TxAdded.Subscribe(ctx, eventsBuffer)
+	dropped := events.TxDropped.Subscribe(ctx, eventsBuffer)
+	peers := events.PeerConnected.Subscribe(ctx, eventsBuffer)
 
-	var previousMpoolSize = 0
 	for {
 		select {
-		case <-ticker.C:
-			pendingTransactions := mpool.ListPendingTransactions()
-			if len(pendingTransactions) != previousMpoolSize {
-				log.Printf("Pending transactions (%d)\n", len(pendingTransactions))
-				for _, tx := range mpool.ListPendingTransactions() {
-					log.Println(tx.PrettyPrint())
-				}
-				previousMpoolSize = len(pendingTransactions)
+		case event, ok := <-added.C():
+			if !ok {
+				return
+			}
+			logMempool(ctx, mpool, "Transaction added", "hash", event.Hash)
+		case event, ok := <-dropped.C():
+			if !ok {
+				return
 			}
+			logMempool(ctx, mpool, "Transaction dropped", "hash", event.Hash, "reason", event.Reason)
+		case event, ok := <-peers.C():
+			if !ok {
+				return
+			}
+			p2pLogger.Info("Peer connected", "peer", event.ID, "height", event.Status.HeadHeight)
 		case <-ctx.Done():
-			log.Println("parent context closed")
 			return
 		}
 	}
 }
+
+// logMempool adds the number of pending transactions, which is only counted when debug logs are on
+func logMempool(ctx context.Context, mpool core.Mempool, msg string, args ...interface{}) {
+	if !mempoolLogger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	args = append(args, "pending", len(mpool.ListPendingTransactions()))
+	mempoolLogger.Debug(msg, args...)
+}
@@ -0,0 +1,136 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"io/fs"
+	"minchain/lib"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const bansFile = "bans.json"
+
+type Ban struct {
+	Peer   peer.ID   `json:"peer"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// BanList holds time-limited peer bans, persisted in the data directory so they survive restarts
+type BanList struct {
+	lock  sync.RWMutex
+	path  string
+	bans  map[peer.ID]Ban
+	clock lib.Clock
+}
+
+func LoadBanList(dataDir string, clock lib.Clock) (*BanList, error) {
+	bl := &BanList{
+		path:  filepath.Join(dataDir, bansFile),
+		bans:  make(map[peer.ID]Ban),
+		clock: clock,
+	}
+
+	data, err := os.ReadFile(bl.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return bl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, err
+	}
+	for _, ban := range bans {
+		if bl.clock.Now().Before(ban.Until) {
+			bl.bans[ban.Peer] = ban
+		}
+	}
+	return bl, nil
+}
+
+func (bl *BanList) Ban(id peer.ID, duration time.Duration, reason string) error {
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+
+	bl.bans[id] = Ban{Peer: id, Until: bl.clock.Now().Add(duration), Reason: reason}
+	return bl.save()
+}
+
+func (bl *BanList) IsBanned(id peer.ID) bool {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+
+	ban, ok := bl.bans[id]
+	return ok && bl.clock.Now().Before(ban.Until)
+}
+
+// All returns the bans which haven't expired yet
+func (bl *BanList) All() []Ban {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+
+	bans := make([]Ban, 0, len(bl.bans))
+	for _, ban := range bl.bans {
+		if bl.clock.Now().Before(ban.Until) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans
+}
+
+// save writes the active bans, must be called with the lock held
+func (bl *BanList) save() error {
+	bans := make([]Ban, 0, len(bl.bans))
+	for id, ban := range bl.bans {
+		if bl.clock.Now().After(ban.Until) {
+			delete(bl.bans, id)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+
+	data, err := json.Marshal(bans)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(bl.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(bl.path, data, 0600)
+}
+
+// banGater refuses connections to and from banned peers
+type banGater struct {
+	bans *BanList
+}
+
+func (g *banGater) InterceptPeerDial(id peer.ID) bool {
+	return !g.bans.IsBanned(id)
+}
+
+func (g *banGater) InterceptAddrDial(id peer.ID, _ multiaddr.Multiaddr) bool {
+	return !g.bans.IsBanned(id)
+}
+
+func (g *banGater) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g *banGater) InterceptSecured(_ network.Direction, id peer.ID, _ network.ConnMultiaddrs) bool {
+	return !g.bans.IsBanned(id)
+}
+
+func (g *banGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
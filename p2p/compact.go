@@ -0,0 +1,365 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"minchain/core/types"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BlockTxsProtocolID serves the transactions of a block which a compact block receiver is missing
+	BlockTxsProtocolID protocol.ID = "/minchain/blocktxs/2.0.0"
+
+	fetchTimeout = 5 * time.Second
+	// recentBlocksLimit is how many relayed blocks are kept to answer transaction requests before they're stored
+	recentBlocksLimit = 64
+	// maxRebuilds caps the compact blocks whose transactions are fetched at the same time
+	maxRebuilds = 16
+	// maxRebuildPeers is how many other peers are asked for the transactions when the relaying peer can't serve them
+	maxRebuildPeers = 3
+)
+
+var ErrorCompactBlockMismatch = errors.New("compact block transactions don't match the header")
+
+// TransactionPool is where compact blocks are rebuilt from, core.Mempool satisfies it
+type TransactionPool interface {
+	ListPendingTransactions() []types.Tx
+}
+
+// RelayStats measures the bandwidth compact relay saved on received blocks
+type RelayStats struct {
+	CompactBlocks int64 `json:"compactBlocks"`
+	// CompactBytes is the size of the received compact blocks and FetchedBytes of the transactions requested for them
+	CompactBytes int64 `json:"compactBytes"`
+	FetchedTxs   int64 `json:"fetchedTxs"`
+	FetchedBytes int64 `json:"fetchedBytes"`
+	// FullBytes is what the same blocks would have cost if gossiped in full
+	FullBytes int64 `json:"fullBytes"`
+}
+
+func (s RelayStats) SavedBytes() int64 {
+	return s.FullBytes - s.CompactBytes - s.FetchedBytes
+}
+
+type relayCounters struct {
+	compactBlocks atomic.Int64
+	compactBytes  atomic.Int64
+	fetchedTxs    atomic.Int64
+	fetchedBytes  atomic.Int64
+	fullBytes     atomic.Int64
+}
+
+func (n *Node) RelayStats() RelayStats {
+	return RelayStats{
+		CompactBlocks: n.relay.compactBlocks.Load(),
+		CompactBytes:  n.relay.compactBytes.Load(),
+		FetchedTxs:    n.relay.fetchedTxs.Load(),
+		FetchedBytes:  n.relay.fetchedBytes.Load(),
+		FullBytes:     n.relay.fullBytes.Load(),
+	}
+}
+
+// recentBlocks remembers the blocks we published or relayed, peers ask for their transactions
+// before the block processing has stored them
+type recentBlocks struct {
+	lock   sync.Mutex
+	blocks map[common.Hash]*types.Block
+	order  []common.Hash
+}
+
+func newRecentBlocks() *recentBlocks {
+	return &recentBlocks{blocks: make(map[common.Hash]*types.Block)}
+}
+
+func (r *recentBlocks) add(block *types.Block) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hash := block.BlockHash()
+	if _, ok := r.blocks[hash]; ok {
+		return
+	}
+	r.blocks[hash] = block
+	r.order = append(r.order, hash)
+	if len(r.order) > recentBlocksLimit {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *recentBlocks) all() []*types.Block {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	blocks := make([]*types.Block, 0, len(r.order))
+	for _, hash := range r.order {
+		blocks = append(blocks, r.blocks[hash])
+	}
+	return blocks
+}
+
+func (r *recentBlocks) get(hash common.Hash) (*types.Block, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	block, ok := r.blocks[hash]
+	return block, ok
+}
+
+// rebuilds tracks the compact blocks being completed in the background. Once rebuilt, a block is published again on
+// the topic it came from, which delivers it to our consumer and relays it to our mesh.
+type rebuilds struct {
+	ctx      context.Context
+	lock     sync.Mutex
+	inFlight map[common.Hash]struct{}
+	topics   map[int]*versionedTopic
+}
+
+func newRebuilds(ctx context.Context) *rebuilds {
+	return &rebuilds{ctx: ctx, inFlight: make(map[common.Hash]struct{}), topics: make(map[int]*versionedTopic)}
+}
+
+// start returns false if the block is already being rebuilt or too many are
+func (r *rebuilds) start(hash common.Hash) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.inFlight[hash]; ok || len(r.inFlight) >= maxRebuilds {
+		return false
+	}
+	r.inFlight[hash] = struct{}{}
+	return true
+}
+
+func (r *rebuilds) done(hash common.Hash) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.inFlight, hash)
+}
+
+func (r *rebuilds) setTopic(version int, topic *versionedTopic) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.topics[version] = topic
+}
+
+func (r *rebuilds) topic(version int) *versionedTopic {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.topics[version]
+}
+
+// validateCompactBlock accepts compact blocks which the mempool completes. The others are ignored, so they aren't
+// relayed before we can serve their transactions, and rebuilt in the background. The validator never waits on the
+// network.
+func (n *Node) validateCompactBlock(encoding wireEncoding, version int, validate func(block *types.Block) error) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if result, ok := n.checkSender(from); !ok {
+			return result
+		}
+
+		if len(msg.Data) > maxBlockSize {
+			logger.Warn("Rejecting oversized compact block", "peer", from, "size", len(msg.Data))
+			n.penalise(from, invalidBlockPenalty, "oversized compact block")
+			return pubsub.ValidationReject
+		}
+
+		compact, err := encoding.DecodeCompactBlock(msg.Data)
+		if err != nil {
+			logger.Warn("Rejecting undecodable compact block", "peer", from, "err", err)
+			n.penalise(from, invalidBlockPenalty, "undecodable compact block")
+			return pubsub.ValidationReject
+		}
+
+		hash := compact.BlockHash()
+		if block, ok := n.recent.get(hash); ok {
+			if from != n.p2pHost.ID() {
+				// Another copy of a block we already received
+				return pubsub.ValidationIgnore
+			}
+			// Published or rebuilt by us
+			msg.ValidatorData = block
+			return pubsub.ValidationAccept
+		}
+
+		txs, missing := n.fromPool(compact)
+		if len(missing) == 0 {
+			if txHash, err := types.CombinedHash(txs); err == nil && txHash == compact.Header.TransactionHash {
+				block := &types.Block{Header: compact.Header, Transactions: txs}
+				return n.acceptCompactBlock(from, msg, encoding, block, validate)
+			}
+		}
+
+		if from == n.p2pHost.ID() {
+			logger.Warn("Missing transactions of our own compact block", "hash", hash)
+			return pubsub.ValidationIgnore
+		}
+		if n.rebuilds.start(hash) {
+			go n.rebuildBlock(from, version, msg, encoding, compact, txs, missing, validate)
+		}
+		return pubsub.ValidationIgnore
+	}
+}
+
+// acceptCompactBlock validates a rebuilt block and keeps it to serve its transactions
+func (n *Node) acceptCompactBlock(from peer.ID, msg *pubsub.Message, encoding wireEncoding, block *types.Block, validate func(block *types.Block) error) pubsub.ValidationResult {
+	if validate != nil {
+		if err := validate(block); err != nil {
+			logger.Warn("Rejecting invalid block", "hash", block.BlockHash(), "peer", from, "err", err)
+			n.penalise(from, invalidBlockPenalty, "invalid block "+block.BlockHash().Hex())
+			return pubsub.ValidationReject
+		}
+	}
+
+	if from != n.p2pHost.ID() {
+		n.relay.compactBlocks.Add(1)
+		n.relay.compactBytes.Add(int64(len(msg.Data)))
+		if full, err := encoding.EncodeBlock(block); err == nil {
+			n.relay.fullBytes.Add(int64(len(full)))
+		}
+	}
+
+	n.recent.add(block)
+	n.recordSource(block.BlockHash(), from)
+	n.updateHead(from, block)
+	msg.ValidatorData = block
+	return pubsub.ValidationAccept
+}
+
+// rebuildBlock fetches what the mempool is missing from the peer which relayed the block and publishes the result.
+// The relaying peer has accepted the full block, so it can serve the transactions unless it just disconnected. The
+// copies other peers relayed were dropped as duplicates of the ignored message, so they're asked instead.
+func (n *Node) rebuildBlock(from peer.ID, version int, msg *pubsub.Message, encoding wireEncoding, compact *types.CompactBlock, txs []types.Tx, missing []int, validate func(block *types.Block) error) {
+	hash := compact.BlockHash()
+	defer n.rebuilds.done(hash)
+
+	ctx := n.rebuilds.ctx
+	block, err := n.completeBlock(ctx, from, compact, txs, missing)
+	if errors.Is(err, ErrorCompactBlockMismatch) {
+		logger.Warn("Rejecting compact block", "hash", hash, "peer", from, "err", err)
+		n.penalise(from, invalidBlockPenalty, "mismatching compact block "+hash.Hex())
+		return
+	}
+	for _, id := range n.rebuildPeers(from) {
+		if err == nil {
+			break
+		}
+		logger.Debug("Fetching compact block transactions from another peer", "hash", hash, "peer", id, "err", err)
+		block, err = n.completeBlock(ctx, id, compact, txs, missing)
+	}
+	if err != nil {
+		logger.Info("Can't rebuild compact block", "hash", hash, "peer", from, "err", err)
+		return
+	}
+
+	if n.acceptCompactBlock(from, msg, encoding, block, validate) != pubsub.ValidationAccept {
+		return
+	}
+	topic := n.rebuilds.topic(version)
+	if topic == nil {
+		return
+	}
+	if err := publish(ctx, topic, msg.Data); err != nil {
+		logger.Warn("Error publishing rebuilt block", "hash", hash, "err", err)
+	}
+}
+
+// rebuildPeers are the peers other than the relay to fetch a block's transactions from, the ones with the highest
+// heads first as they're the most likely to have it
+func (n *Node) rebuildPeers(relay peer.ID) []peer.ID {
+	statuses := n.Peers.All()
+	ids := make([]peer.ID, 0, len(statuses))
+	for id := range statuses {
+		if id != relay {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return statuses[ids[i]].HeadHeight > statuses[ids[j]].HeadHeight })
+	return ids[:min(len(ids), maxRebuildPeers)]
+}
+
+// fromPool fills in the transactions of a compact block which are in the mempool and returns the indexes of the
+// missing ones
+func (n *Node) fromPool(compact *types.CompactBlock) ([]types.Tx, []int) {
+	pending := make(map[types.ShortTxID]types.Tx)
+	if n.pool != nil {
+		for _, tx := range n.pool.ListPendingTransactions() {
+			id, err := tx.ShortID()
+			if err != nil {
+				continue
+			}
+			pending[id] = tx
+		}
+	}
+
+	txs := make([]types.Tx, len(compact.ShortIDs))
+	var missing []int
+	for i, id := range compact.ShortIDs {
+		tx, ok := pending[id]
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		txs[i] = tx
+	}
+	return txs, missing
+}
+
+// completeBlock fetches the missing transactions of a compact block
+func (n *Node) completeBlock(ctx context.Context, from peer.ID, compact *types.CompactBlock, txs []types.Tx, missing []int) (*types.Block, error) {
+	if err := n.fetchMissing(ctx, from, compact, txs, missing); err != nil {
+		return nil, err
+	}
+
+	if txHash, err := types.CombinedHash(txs); err != nil || txHash != compact.Header.TransactionHash {
+		// A short ID collision picked the wrong mempool transaction, fetch the whole block body instead
+		all := make([]int, len(txs))
+		for i := range all {
+			all[i] = i
+		}
+		if err := n.fetchMissing(ctx, from, compact, txs, all); err != nil {
+			return nil, err
+		}
+		if txHash, err := types.CombinedHash(txs); err != nil || txHash != compact.Header.TransactionHash {
+			return nil, ErrorCompactBlockMismatch
+		}
+	}
+
+	return &types.Block{Header: compact.Header, Transactions: txs}, nil
+}
+
+func (n *Node) fetchMissing(ctx context.Context, from peer.ID, compact *types.CompactBlock, txs []types.Tx, indexes []int) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	if from == n.p2pHost.ID() {
+		return fmt.Errorf("missing %d transactions of our own block", len(indexes))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	fetched, size, err := n.fetcher.blockTxs(ctx, from, compact.BlockHash(), indexes)
+	if errors.Is(err, ErrorInvalidResponse) {
+		return fmt.Errorf("%w: %v", ErrorCompactBlockMismatch, err)
+	}
+	if err != nil {
+		return err
+	}
+	n.relay.fetchedTxs.Add(int64(len(fetched)))
+	n.relay.fetchedBytes.Add(size)
+
+	for i, index := range indexes {
+		id, err := fetched[i].ShortID()
+		if err != nil || id != compact.ShortIDs[index] {
+			return fmt.Errorf("%w: transaction %d", ErrorCompactBlockMismatch, index)
+		}
+		txs[index] = fetched[i]
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/lib"
+	"testing"
+	"time"
+)
+
+type testPool struct {
+	txs []types.Tx
+}
+
+func (p *testPool) ListPendingTransactions() []types.Tx {
+	return p.txs
+}
+
+func TestCompactBlockRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	txs := make([]types.Tx, 50)
+	for i := range txs {
+		txs[i] = types.Tx{From: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", Data: fmt.Sprintf("transaction %d", i), Signature: make([]byte, 65)}
+	}
+	txHash, err := types.CombinedHash(txs)
+	require.NoError(t, err)
+	block := &types.Block{
+		Header:       types.BlockHeader{ParentHash: common.Hash{1}, TransactionHash: txHash, Height: 1},
+		Transactions: txs,
+	}
+
+	// The producer relays through b to c, which is missing the last two transactions. c rebuilds the block and
+	// relays it on to d.
+	producer := compactTestNode(t, ctx, &testPool{txs: txs})
+	b := compactTestNode(t, ctx, &testPool{txs: txs})
+	c := compactTestNode(t, ctx, &testPool{txs: txs[:len(txs)-2]})
+	d := compactTestNode(t, ctx, &testPool{txs: txs})
+	connectNodes(t, ctx, producer, b)
+	connectNodes(t, ctx, b, c)
+	connectNodes(t, ctx, c, d)
+
+	// Blocks are only relayed along the mesh, which forms on the next gossipsub heartbeats
+	topic := topicName(common.Hash{1}, compactBlocksTopic, CurrentWireVersion)
+	require.Eventually(t, func() bool {
+		return producer.mesh.inMesh(topic, b.p2pHost.ID()) && b.mesh.inMesh(topic, c.p2pHost.ID()) &&
+			c.mesh.inMesh(topic, d.p2pHost.ID())
+	}, 10*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, producer.Publisher.PublishBlock(ctx, block))
+
+	for _, receiver := range []*Node{b, c, d} {
+		consumeCtx, cancelConsume := context.WithTimeout(ctx, 10*time.Second)
+		_, received, err := receiver.Consumer.ConsumeBlock(consumeCtx)
+		cancelConsume()
+		require.NoError(t, err)
+		require.Equal(t, block.BlockHash(), received.BlockHash())
+		require.Equal(t, block.Transactions, received.Transactions)
+	}
+
+	require.Equal(t, int64(0), b.RelayStats().FetchedTxs)
+	require.Equal(t, int64(2), c.RelayStats().FetchedTxs)
+	require.Equal(t, int64(0), d.RelayStats().FetchedTxs)
+
+	for name, node := range map[string]*Node{"b": b, "c": c} {
+		stats := node.RelayStats()
+		require.Positive(t, stats.SavedBytes())
+		t.Logf("%s received %d bytes instead of %d (compact %d, fetched %d), saved %.0f%%", name,
+			stats.CompactBytes+stats.FetchedBytes, stats.FullBytes, stats.CompactBytes, stats.FetchedBytes,
+			100*float64(stats.SavedBytes())/float64(stats.FullBytes))
+	}
+}
+
+func TestCompactBlockValidatorDoesNotFetch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	txs := []types.Tx{{From: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", Data: "missing", Signature: make([]byte, 65)}}
+	txHash, err := types.CombinedHash(txs)
+	require.NoError(t, err)
+	block := &types.Block{
+		Header:       types.BlockHeader{ParentHash: common.Hash{1}, TransactionHash: txHash, Height: 1},
+		Transactions: txs,
+	}
+	compact, err := types.NewCompactBlock(block)
+	require.NoError(t, err)
+	encoding := wireEncodings[CurrentWireVersion]
+	data, err := encoding.EncodeCompactBlock(compact)
+	require.NoError(t, err)
+
+	// The relay never stored the block, so fetching its transactions fails
+	relay := compactTestNode(t, ctx, &testPool{})
+	receiver := compactTestNode(t, ctx, &testPool{})
+	connectNodes(t, ctx, relay, receiver)
+
+	validator := receiver.validateCompactBlock(encoding, CurrentWireVersion, nil)
+	msg := &pubsub.Message{Message: &pb.Message{Data: data}}
+	require.Equal(t, pubsub.ValidationIgnore, validator(ctx, relay.p2pHost.ID(), msg))
+	require.Nil(t, msg.ValidatorData)
+
+	// The rebuild gives up in the background without penalising the relay
+	require.Eventually(t, func() bool {
+		return receiver.rebuilds.start(block.BlockHash())
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Zero(t, receiver.misbehaviour.Penalty(relay.p2pHost.ID()))
+}
+
+func TestCompactBlockFetchedFromAnotherPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	txs := []types.Tx{{From: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", Data: "missing", Signature: make([]byte, 65)}}
+	txHash, err := types.CombinedHash(txs)
+	require.NoError(t, err)
+	block := &types.Block{
+		Header:       types.BlockHeader{ParentHash: common.Hash{1}, TransactionHash: txHash, Height: 1},
+		Transactions: txs,
+	}
+	compact, err := types.NewCompactBlock(block)
+	require.NoError(t, err)
+	encoding := wireEncodings[CurrentWireVersion]
+	data, err := encoding.EncodeCompactBlock(compact)
+	require.NoError(t, err)
+
+	// The relay can't serve the transactions, e.g. it restarted, but another peer received the block too
+	relay := compactTestNode(t, ctx, &testPool{})
+	holder := compactTestNode(t, ctx, &testPool{})
+	holder.recent.add(block)
+	receiver := compactTestNode(t, ctx, &testPool{})
+	connectNodes(t, ctx, relay, receiver)
+	connectNodes(t, ctx, holder, receiver)
+
+	validator := receiver.validateCompactBlock(encoding, CurrentWireVersion, nil)
+	msg := &pubsub.Message{Message: &pb.Message{Data: data}}
+	require.Equal(t, pubsub.ValidationIgnore, validator(ctx, relay.p2pHost.ID(), msg))
+
+	consumeCtx, cancelConsume := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelConsume()
+	_, received, err := receiver.Consumer.ConsumeBlock(consumeCtx)
+	require.NoError(t, err)
+	require.Equal(t, block.BlockHash(), received.BlockHash())
+	require.Equal(t, int64(1), receiver.RelayStats().FetchedTxs)
+	require.Zero(t, receiver.misbehaviour.Penalty(relay.p2pHost.ID()))
+}
+
+func compactTestNode(t *testing.T, ctx context.Context, pool TransactionPool) *Node {
+	config := lib.Config{
+		DataDir:       t.TempDir(),
+		ChainID:       1,
+		GenesisHash:   common.Hash{1},
+		WireVersions:  []int{CurrentWireVersion},
+		CompactBlocks: true,
+	}
+	node, err := InitNode(ctx, config, database.NewMemoryDatabase(), pool, lib.NewSystemClock(), MessageValidators{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = node.p2pHost.Close() })
+	return node
+}
+
+func connectNodes(t *testing.T, ctx context.Context, a *Node, b *Node) {
+	require.NoError(t, a.p2pHost.Connect(ctx, peer.AddrInfo{ID: b.p2pHost.ID(), Addrs: b.p2pHost.Addrs()}))
+	require.Eventually(t, func() bool {
+		return a.Peers.IsCompatible(b.p2pHost.ID(), "") && b.Peers.IsCompatible(a.p2pHost.ID(), "")
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -3,59 +3,128 @@ package p2p
 import (
 	"context"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	"log"
 	"minchain/core/types"
+	"minchain/metrics"
+	"minchain/tracing"
 )
 
+// Consumer delivers gossiped messages. The returned context carries the sender's trace context, if the message had
+// one, so the receiving side continues the trace.
 type Consumer interface {
-	ConsumeTransaction(ctx context.Context) (*types.Tx, error)
-	ConsumeBlock(ctx context.Context) (*types.Block, error)
+	ConsumeTransaction(ctx context.Context) (context.Context, *types.Tx, error)
+	ConsumeBlock(ctx context.Context) (context.Context, *types.Block, error)
 }
 
+// P2pConsumer merges the messages of all subscribed wire versions
 type P2pConsumer struct {
-	txSubscription     *pubsub.Subscription
-	blocksSubscription *pubsub.Subscription
+	transactions chan received
+	blocks       chan received
 }
 
-func NewP2pConsumer(txSubscription *pubsub.Subscription, blocksSubscription *pubsub.Subscription) Consumer {
-	return &P2pConsumer{
-		txSubscription:     txSubscription,
-		blocksSubscription: blocksSubscription,
-	}
+type received struct {
+	msg      *pubsub.Message
+	encoding wireEncoding
+	// compact blocks can only be rebuilt by the topic validator
+	compact bool
 }
 
-func (c *P2pConsumer) ConsumeTransaction(ctx context.Context) (*types.Tx, error) {
-	msg, err := c.txSubscription.Next(ctx)
-	if err != nil {
-		return nil, err
+// context continues the trace the message came with, if any
+func (r received) context(ctx context.Context) context.Context {
+	metadata := readMetadata(r.encoding, r.msg.Data)
+	if metadata == nil {
+		return ctx
 	}
+	return tracing.Extract(ctx, metadata)
+}
 
-	tx, err := types.TransactionFromJSON(msg.Data)
+func NewP2pConsumer(ctx context.Context, txTopics []*versionedTopic, blocksTopics []*versionedTopic, compactTopics []*versionedTopic) Consumer {
+	c := &P2pConsumer{
+		transactions: make(chan received),
+		blocks:       make(chan received),
+	}
+	for _, topic := range txTopics {
+		go c.pump(ctx, topic, c.transactions, false)
+	}
+	for _, topic := range blocksTopics {
+		go c.pump(ctx, topic, c.blocks, false)
+	}
+	for _, topic := range compactTopics {
+		go c.pump(ctx, topic, c.blocks, true)
+	}
+	return c
+}
 
-	hash, _ := tx.Hash()
-	log.Println("Consumer.ConsumeTransaction:", hash.Hex())
+func (c *P2pConsumer) pump(ctx context.Context, topic *versionedTopic, out chan<- received, compact bool) {
+	for {
+		msg, err := topic.subscription.Next(ctx)
+		if err != nil {
+			logger.Info("Subscription closed", "topic", topic.topic.String(), "err", err)
+			return
+		}
+		metrics.GossipMessages.WithLabelValues(topic.label(), metrics.In).Inc()
 
-	if err != nil {
-		log.Println("Error deserializing transaction:", err)
-		return nil, err
+		select {
+		case out <- received{msg: msg, encoding: topic.encoding, compact: compact}:
+		case <-ctx.Done():
+			return
+		}
 	}
-	return tx, nil
 }
 
-func (c *P2pConsumer) ConsumeBlock(ctx context.Context) (*types.Block, error) {
-	msg, err := c.blocksSubscription.Next(ctx)
-	if err != nil {
-		return nil, err
+// ConsumeTransaction blocks until the next transaction arrives. Messages which can't be decoded are skipped,
+// only context errors are returned.
+func (c *P2pConsumer) ConsumeTransaction(ctx context.Context) (context.Context, *types.Tx, error) {
+	for {
+		var next received
+		select {
+		case next = <-c.transactions:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+
+		// Topic validator has already decoded it
+		tx, ok := next.msg.ValidatorData.(*types.Tx)
+		if !ok {
+			var err error
+			tx, err = next.encoding.DecodeTransaction(next.msg.Data)
+			if err != nil {
+				logger.Warn("Error deserializing transaction", "err", err)
+				continue
+			}
+		}
+
+		hash, _ := tx.Hash()
+		logger.Debug("Received transaction", "hash", hash)
+		return next.context(ctx), tx, nil
 	}
+}
 
-	block, err := types.BlockFromJson(msg.Data)
+// ConsumeBlock blocks until the next block arrives. Messages which can't be decoded are skipped,
+// only context errors are returned.
+func (c *P2pConsumer) ConsumeBlock(ctx context.Context) (context.Context, *types.Block, error) {
+	for {
+		var next received
+		select {
+		case next = <-c.blocks:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
 
-	log.Println("Consumer.ConsumeBlock:", block.BlockHash().Hex())
+		block, ok := next.msg.ValidatorData.(*types.Block)
+		if !ok && next.compact {
+			logger.Debug("Skipping compact block which wasn't rebuilt")
+			continue
+		}
+		if !ok {
+			var err error
+			block, err = next.encoding.DecodeBlock(next.msg.Data)
+			if err != nil {
+				logger.Warn("Error deserializing block", "err", err)
+				continue
+			}
+		}
 
-	if err != nil {
-		log.Println("Error deserializing block:", err)
-		return nil, err
+		logger.Debug("Received block", "hash", block.BlockHash())
+		return next.context(ctx), block, nil
 	}
-
-	return block, nil
 }
@@ -0,0 +1,136 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	"minchain/lib"
+	"time"
+)
+
+const (
+	bootstrapReconnectInterval = 30 * time.Second
+	dhtDiscoveryInterval       = 1 * time.Minute
+	// dhtProtocolPrefix keeps minchain nodes in their own DHT instead of the public IPFS one
+	dhtProtocolPrefix protocol.ID = "/minchain"
+)
+
+func parseBootstrapPeers(addrs []string) ([]peer.AddrInfo, error) {
+	peers := make([]peer.AddrInfo, 0, len(addrs))
+	for _, addr := range addrs {
+		info, err := peer.AddrInfoFromString(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %s: %w", addr, err)
+		}
+		peers = append(peers, *info)
+	}
+	return peers, nil
+}
+
+// keepBootstrapPeersConnected dials the bootstrap peers on startup and redials any of them which dropped
+func (n *Node) keepBootstrapPeersConnected(ctx context.Context, clock lib.Clock, bootstrapPeers []peer.AddrInfo) {
+	for _, info := range bootstrapPeers {
+		n.p2pHost.ConnManager().Protect(info.ID, "bootstrap")
+	}
+
+	connect := func() {
+		for _, info := range bootstrapPeers {
+			if n.p2pHost.Network().Connectedness(info.ID) == network.Connected {
+				continue
+			}
+			// A bootstrap peer on another chain would only be rejected again
+			if n.Peers.recentlyRejected(info.ID) {
+				continue
+			}
+			if err := n.p2pHost.Connect(ctx, info); err != nil {
+				logger.Warn("Error connecting to bootstrap peer", "peer", info.ID, "err", err)
+			}
+		}
+	}
+
+	go func() {
+		connect()
+
+		ticker := clock.NewTicker(bootstrapReconnectInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				connect()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// startDHTDiscovery advertises this node under the chain's rendezvous namespace and periodically connects
+// to other nodes found there. Advertising fails until the routing table has peers, so it's retried on every round
+// until it succeeds and renewed before the advertisement expires.
+func (n *Node) startDHTDiscovery(ctx context.Context, config lib.Config, clock lib.Clock, bootstrapPeers []peer.AddrInfo, notifee *discoveryNotifee) error {
+	kademlia, err := dht.New(ctx, n.p2pHost,
+		dht.Mode(dht.ModeAutoServer),
+		dht.ProtocolPrefix(dhtProtocolPrefix),
+		dht.BootstrapPeers(bootstrapPeers...),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := kademlia.Bootstrap(ctx); err != nil {
+		return err
+	}
+	n.dht = kademlia
+
+	namespace := rendezvousNamespace(config)
+	logger.Info("DHT discovery started", "namespace", namespace)
+
+	routingDiscovery := drouting.NewRoutingDiscovery(kademlia)
+
+	go func() {
+		ticker := clock.NewTicker(dhtDiscoveryInterval)
+		defer ticker.Stop()
+		var advertiseAt time.Time
+		for {
+			if !clock.Now().Before(advertiseAt) {
+				ttl, err := routingDiscovery.Advertise(ctx, namespace)
+				if err != nil {
+					logger.Debug("DHT advertisement failed", "err", err)
+				} else {
+					advertiseAt = clock.Now().Add(7 * ttl / 8)
+				}
+			}
+
+			found, err := routingDiscovery.FindPeers(ctx, namespace)
+			if err != nil {
+				logger.Warn("DHT peer search failed", "err", err)
+			} else {
+				for info := range found {
+					if info.ID == n.p2pHost.ID() || len(info.Addrs) == 0 {
+						continue
+					}
+					if n.p2pHost.Network().Connectedness(info.ID) == network.Connected {
+						continue
+					}
+					notifee.HandlePeerFound(info)
+				}
+			}
+
+			select {
+			case <-ticker.C():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func rendezvousNamespace(config lib.Config) string {
+	return fmt.Sprintf("minchain/%d/%s", config.ChainID, config.GenesisHash.Hex())
+}
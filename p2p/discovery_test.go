@@ -0,0 +1,175 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+	"github.com/stretchr/testify/require"
+	"minchain/database"
+	"minchain/lib"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func discoveryTestNode(t *testing.T, ctx context.Context, config lib.Config, clock lib.Clock) *Node {
+	config.DataDir = t.TempDir()
+	config.ChainID = 1
+	config.GenesisHash = common.Hash{1}
+	config.WireVersions = []int{CurrentWireVersion}
+	node, err := InitNode(ctx, config, database.NewMemoryDatabase(), nil, clock, MessageValidators{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = node.p2pHost.Close() })
+	return node
+}
+
+// bootstrapAddr is the node's loopback address, as it would be given in BOOTSTRAP_PEERS
+func bootstrapAddr(t *testing.T, node *Node) string {
+	for _, addr := range node.p2pHost.Addrs() {
+		if strings.HasPrefix(addr.String(), "/ip4/127.0.0.1/") {
+			return fmt.Sprintf("%s/p2p/%s", addr, node.p2pHost.ID())
+		}
+	}
+	t.Fatal("no loopback address")
+	return ""
+}
+
+func TestBootstrapPeerReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bootstrap := discoveryTestNode(t, ctx, lib.Config{}, lib.NewSystemClock())
+	clock := lib.NewManualClock(time.Now())
+	node := discoveryTestNode(t, ctx, lib.Config{BootstrapPeers: []string{bootstrapAddr(t, bootstrap)}}, clock)
+
+	connected := func() bool {
+		return node.p2pHost.Network().Connectedness(bootstrap.p2pHost.ID()) == network.Connected
+	}
+	// Both ends have to know the connection before the bootstrap peer can close it
+	require.Eventually(t, func() bool {
+		return connected() && bootstrap.p2pHost.Network().Connectedness(node.p2pHost.ID()) == network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The bootstrap peer drops us, e.g. on a restart
+	require.NoError(t, bootstrap.p2pHost.Network().ClosePeer(node.p2pHost.ID()))
+	require.Eventually(t, func() bool { return !connected() }, 5*time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		clock.Advance(bootstrapReconnectInterval)
+		return connected()
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestBootstrapPeerCooldown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The bootstrap peer is on another chain, so the handshake rejects it
+	otherChain := discoveryTestNode(t, ctx, lib.Config{}, lib.NewSystemClock())
+	var dials atomic.Int32
+	otherChain.p2pHost.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(network.Network, network.Conn) { dials.Add(1) },
+	})
+	clock := lib.NewManualClock(time.Now())
+	config := lib.Config{BootstrapPeers: []string{bootstrapAddr(t, otherChain)}}
+	config.DataDir = t.TempDir()
+	config.ChainID = 1
+	config.GenesisHash = common.Hash{2}
+	config.WireVersions = []int{CurrentWireVersion}
+	node, err := InitNode(ctx, config, database.NewMemoryDatabase(), nil, clock, MessageValidators{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = node.p2pHost.Close() })
+
+	require.Eventually(t, func() bool {
+		return node.Peers.recentlyRejected(otherChain.p2pHost.ID()) &&
+			node.p2pHost.Network().Connectedness(otherChain.p2pHost.ID()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(1), dials.Load())
+
+	// No redial during the cooldown
+	for i := 0; i < 3; i++ {
+		clock.Advance(bootstrapReconnectInterval)
+	}
+	require.Never(t, func() bool { return dials.Load() > 1 }, 500*time.Millisecond, 10*time.Millisecond)
+
+	// The peer may have switched chains since
+	require.Eventually(t, func() bool {
+		clock.Advance(bootstrapReconnectInterval)
+		return dials.Load() > 1
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestDiscoveryOff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := discoveryTestNode(t, ctx, lib.Config{EnableDHT: false, EnableMDNS: false}, lib.NewSystemClock())
+	require.Nil(t, node.dht)
+	require.Nil(t, node.mdns)
+	for _, id := range node.p2pHost.Mux().Protocols() {
+		require.False(t, strings.HasPrefix(string(id), string(dhtProtocolPrefix)+"/kad"), "serves %s", id)
+	}
+
+	// Without discovery a node only knows the peers it's told about
+	other := discoveryTestNode(t, ctx, lib.Config{}, lib.NewSystemClock())
+	require.Empty(t, node.p2pHost.Network().Peers())
+	connectNodes(t, ctx, node, other)
+	require.Equal(t, []string{other.p2pHost.ID().String()}, peerIDs(node))
+}
+
+func TestDHTDiscoveryOn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bootstrap := discoveryTestNode(t, ctx, lib.Config{EnableDHT: true}, lib.NewSystemClock())
+	node := discoveryTestNode(t, ctx, lib.Config{EnableDHT: true, BootstrapPeers: []string{bootstrapAddr(t, bootstrap)}}, lib.NewSystemClock())
+	require.NotNil(t, node.dht)
+	require.Nil(t, node.mdns)
+
+	// The bootstrap peer ends up in the routing table, which later lookups start from
+	require.Eventually(t, func() bool {
+		return node.dht.RoutingTable().Find(bootstrap.p2pHost.ID()) != ""
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRendezvousDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Both nodes only know the bootstrap peer, they find each other under the chain's rendezvous namespace
+	bootstrap := discoveryTestNode(t, ctx, lib.Config{EnableDHT: true}, lib.NewSystemClock())
+	clock := lib.NewManualClock(time.Now())
+	config := lib.Config{EnableDHT: true, BootstrapPeers: []string{bootstrapAddr(t, bootstrap)}}
+	a := discoveryTestNode(t, ctx, config, clock)
+	b := discoveryTestNode(t, ctx, config, clock)
+	namespace := rendezvousNamespace(lib.Config{ChainID: 1, GenesisHash: common.Hash{1}})
+	require.Equal(t, "minchain/1/"+common.Hash{1}.Hex(), namespace)
+
+	// Each round advertises and searches the namespace
+	advertised := func(searcher *Node, advertiser *Node) bool {
+		found, err := dutil.FindPeers(ctx, drouting.NewRoutingDiscovery(searcher.dht), namespace)
+		require.NoError(t, err)
+		return slices.ContainsFunc(found, func(info peer.AddrInfo) bool { return info.ID == advertiser.p2pHost.ID() })
+	}
+	require.Eventually(t, func() bool {
+		clock.Advance(dhtDiscoveryInterval)
+		return advertised(a, b) && advertised(b, a)
+	}, 20*time.Second, 100*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return a.Peers.IsCompatible(b.p2pHost.ID(), "") && b.Peers.IsCompatible(a.p2pHost.ID(), "")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func peerIDs(node *Node) []string {
+	var ids []string
+	for _, id := range node.p2pHost.Network().Peers() {
+		ids = append(ids, id.String())
+	}
+	return ids
+}
@@ -0,0 +1,115 @@
+package p2p
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/rlp"
+	"minchain/core/types"
+	"sort"
+)
+
+const maxMetadataEntries = 16
+
+var ErrorTooMuchMetadata = errors.New("too many metadata entries")
+
+type metadataEntry struct {
+	Key   string
+	Value string
+}
+
+type rlpEnvelope struct {
+	Metadata []metadataEntry
+	Payload  []byte
+}
+
+// envelopeEncoding puts the payload encoding's bytes in an envelope next to metadata, e.g. the sender's trace
+// context. Decoding ignores the metadata, readMetadata gets it.
+type envelopeEncoding struct {
+	payload wireEncoding
+}
+
+func sealEnvelope(metadata map[string]string, payload []byte) ([]byte, error) {
+	if len(metadata) > maxMetadataEntries {
+		return nil, ErrorTooMuchMetadata
+	}
+	envelope := rlpEnvelope{Metadata: make([]metadataEntry, 0, len(metadata)), Payload: payload}
+	for key, value := range metadata {
+		envelope.Metadata = append(envelope.Metadata, metadataEntry{Key: key, Value: value})
+	}
+	sort.Slice(envelope.Metadata, func(i, j int) bool { return envelope.Metadata[i].Key < envelope.Metadata[j].Key })
+	return rlp.EncodeToBytes(&envelope)
+}
+
+func openEnvelope(data []byte) (map[string]string, []byte, error) {
+	var envelope rlpEnvelope
+	if err := rlp.DecodeBytes(data, &envelope); err != nil {
+		return nil, nil, err
+	}
+	if len(envelope.Metadata) > maxMetadataEntries {
+		return nil, nil, ErrorTooMuchMetadata
+	}
+	metadata := make(map[string]string, len(envelope.Metadata))
+	for _, entry := range envelope.Metadata {
+		metadata[entry.Key] = entry.Value
+	}
+	return metadata, envelope.Payload, nil
+}
+
+// readMetadata returns the metadata of a message, nil on wire versions without it
+func readMetadata(encoding wireEncoding, data []byte) map[string]string {
+	if _, ok := encoding.(envelopeEncoding); !ok {
+		return nil
+	}
+	metadata, _, err := openEnvelope(data)
+	if err != nil {
+		return nil
+	}
+	return metadata
+}
+
+func (e envelopeEncoding) seal(payload []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return sealEnvelope(nil, payload)
+}
+
+func (e envelopeEncoding) open(data []byte) ([]byte, error) {
+	_, payload, err := openEnvelope(data)
+	return payload, err
+}
+
+func (e envelopeEncoding) EncodeTransaction(tx *types.Tx) ([]byte, error) {
+	return e.seal(e.payload.EncodeTransaction(tx))
+}
+
+func (e envelopeEncoding) DecodeTransaction(data []byte) (*types.Tx, error) {
+	payload, err := e.open(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.payload.DecodeTransaction(payload)
+}
+
+func (e envelopeEncoding) EncodeBlock(block *types.Block) ([]byte, error) {
+	return e.seal(e.payload.EncodeBlock(block))
+}
+
+func (e envelopeEncoding) DecodeBlock(data []byte) (*types.Block, error) {
+	payload, err := e.open(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.payload.DecodeBlock(payload)
+}
+
+func (e envelopeEncoding) EncodeCompactBlock(block *types.CompactBlock) ([]byte, error) {
+	return e.seal(e.payload.EncodeCompactBlock(block))
+}
+
+func (e envelopeEncoding) DecodeCompactBlock(data []byte) (*types.CompactBlock, error) {
+	payload, err := e.open(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.payload.DecodeCompactBlock(payload)
+}
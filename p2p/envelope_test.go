@@ -0,0 +1,64 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"minchain/core/types"
+	"minchain/tracing"
+	"testing"
+)
+
+func TestEnvelopeCarriesTraceContext(t *testing.T) {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+	tx := &types.Tx{From: "0x01", Data: "hello", Signature: make([]byte, 65)}
+	encodeTx := func(encoding wireEncoding) ([]byte, error) { return encoding.EncodeTransaction(tx) }
+
+	topic := &versionedTopic{kind: transactionsTopic, version: CurrentWireVersion, encoding: wireEncodings[CurrentWireVersion]}
+	data, err := topic.encode(ctx, encodeTx)
+	require.NoError(t, err)
+
+	decoded, err := topic.encoding.DecodeTransaction(data)
+	require.NoError(t, err)
+	require.Equal(t, tx.Data, decoded.Data)
+
+	metadata := readMetadata(topic.encoding, data)
+	remote := trace.SpanContextFromContext(tracing.Extract(context.Background(), metadata))
+	require.Equal(t, spanContext.TraceID(), remote.TraceID())
+	require.Equal(t, spanContext.SpanID(), remote.SpanID())
+
+	// Older versions have no room for metadata, the message is the bare encoding
+	old := &versionedTopic{kind: transactionsTopic, version: 2, encoding: wireEncodings[2]}
+	data, err = old.encode(ctx, encodeTx)
+	require.NoError(t, err)
+	plain, err := binaryEncoding{}.EncodeTransaction(tx)
+	require.NoError(t, err)
+	require.Equal(t, plain, data)
+	require.Nil(t, readMetadata(old.encoding, data))
+}
+
+func TestEnvelopeLimitsMetadata(t *testing.T) {
+	metadata := make(map[string]string)
+	for i := 0; i <= maxMetadataEntries; i++ {
+		metadata[fmt.Sprintf("key%d", i)] = "value"
+	}
+	_, err := sealEnvelope(metadata, []byte("payload"))
+	require.ErrorIs(t, err, ErrorTooMuchMetadata)
+
+	delete(metadata, "key0")
+	data, err := sealEnvelope(metadata, []byte("payload"))
+	require.NoError(t, err)
+	opened, payload, err := openEnvelope(data)
+	require.NoError(t, err)
+	require.Equal(t, metadata, opened)
+	require.Equal(t, []byte("payload"), payload)
+
+	_, err = envelopeEncoding{binaryEncoding{}}.DecodeTransaction([]byte("garbage"))
+	require.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package p2p
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/core/types"
+)
+
+// Fetcher asks one peer for chain data, unlike Publisher and Consumer which broadcast to everyone
+type Fetcher interface {
+	GetBlockByHash(ctx context.Context, id peer.ID, hash common.Hash) (*types.Block, error)
+	// GetBlocksByRange returns up to count canonical blocks starting at height from. It may return fewer than the peer
+	// has, the rest are asked for again from the height after the last block.
+	GetBlocksByRange(ctx context.Context, id peer.ID, from int64, count int) ([]*types.Block, error)
+	// GetHeaders returns up to count canonical headers starting at height from
+	GetHeaders(ctx context.Context, id peer.ID, from int64, count int) ([]types.BlockHeader, error)
+	// GetTransactions returns the requested transactions the peer knows, possibly fewer than asked for
+	GetTransactions(ctx context.Context, id peer.ID, hashes []common.Hash) ([]types.Tx, error)
+	// GetBlockTransactions returns the transactions of a block at the given indexes, all of them or an error
+	GetBlockTransactions(ctx context.Context, id peer.ID, blockHash common.Hash, indexes []int) ([]types.Tx, error)
+}
@@ -0,0 +1,287 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"io"
+	"minchain/database"
+	"minchain/lib"
+	"minchain/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	StatusProtocolID protocol.ID = "/minchain/status/1.0.0"
+	ProtocolVersion  uint32      = 1
+
+	handshakeTimeout = 10 * time.Second
+	maxStatusSize    = 1024
+	// rejectionCooldown is how long discovery ignores a peer which failed the handshake
+	rejectionCooldown = 10 * time.Minute
+)
+
+// Status is exchanged by both sides right after a connection is established. PeerStatuses keeps the head of a peer
+// current afterwards: it moves to the highest block the peer relayed or served us since.
+type Status struct {
+	ProtocolVersion uint32      `json:"protocolVersion"`
+	ChainID         uint64      `json:"chainId"`
+	GenesisHash     common.Hash `json:"genesisHash"`
+	HeadHash        common.Hash `json:"headHash"`
+	HeadHeight      int64       `json:"headHeight"`
+}
+
+// PeerStatuses keeps the handshake result of every connected peer
+type PeerStatuses struct {
+	lock     sync.RWMutex
+	statuses map[peer.ID]Status
+	rejected map[peer.ID]rejection
+	accepted []func(id peer.ID, status Status)
+	clock    lib.Clock
+}
+
+type rejection struct {
+	reason string
+	at     time.Time
+}
+
+func NewPeerStatuses(clock lib.Clock) *PeerStatuses {
+	return &PeerStatuses{
+		statuses: make(map[peer.ID]Status),
+		rejected: make(map[peer.ID]rejection),
+		clock:    clock,
+	}
+}
+
+// Get returns the status of a peer which passed the handshake
+func (ps *PeerStatuses) Get(id peer.ID) (Status, bool) {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	status, ok := ps.statuses[id]
+	return status, ok
+}
+
+// All returns the statuses of all compatible peers
+func (ps *PeerStatuses) All() map[peer.ID]Status {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	all := make(map[peer.ID]Status, len(ps.statuses))
+	for id, status := range ps.statuses {
+		all[id] = status
+	}
+	return all
+}
+
+// IsCompatible reports whether the peer passed the handshake. Used as the gossipsub peer filter,
+// so nothing is gossiped to a peer before we know it's on our chain.
+func (ps *PeerStatuses) IsCompatible(id peer.ID, _ string) bool {
+	_, ok := ps.Get(id)
+	return ok
+}
+
+// RejectionReason returns why a peer failed the handshake, if it did
+func (ps *PeerStatuses) RejectionReason(id peer.ID) (string, bool) {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	rejected, ok := ps.rejected[id]
+	return rejected.reason, ok
+}
+
+// UpdateHead records that a peer has the block at height. Only a higher head than the known one is kept, blocks of
+// a shorter fork don't move it back.
+func (ps *PeerStatuses) UpdateHead(id peer.ID, hash common.Hash, height int64) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	status, ok := ps.statuses[id]
+	if !ok || height <= status.HeadHeight {
+		return
+	}
+	status.HeadHash = hash
+	status.HeadHeight = height
+	ps.statuses[id] = status
+}
+
+func (ps *PeerStatuses) recentlyRejected(id peer.ID) bool {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	rejected, ok := ps.rejected[id]
+	return ok && ps.clock.Since(rejected.at) < rejectionCooldown
+}
+
+// OnAccepted registers fn to be called whenever a new peer passes the handshake
+func (ps *PeerStatuses) OnAccepted(fn func(id peer.ID, status Status)) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	ps.accepted = append(ps.accepted, fn)
+}
+
+func (ps *PeerStatuses) accept(id peer.ID, status Status) {
+	ps.lock.Lock()
+	_, known := ps.statuses[id]
+	ps.statuses[id] = status
+	delete(ps.rejected, id)
+	metrics.PeersConnected.Set(float64(len(ps.statuses)))
+	callbacks := ps.accepted
+	ps.lock.Unlock()
+
+	if known {
+		return
+	}
+	for _, fn := range callbacks {
+		fn(id, status)
+	}
+}
+
+func (ps *PeerStatuses) reject(id peer.ID, reason string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	delete(ps.statuses, id)
+	ps.rejected[id] = rejection{reason: reason, at: ps.clock.Now()}
+	metrics.PeersConnected.Set(float64(len(ps.statuses)))
+}
+
+func (ps *PeerStatuses) remove(id peer.ID) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	delete(ps.statuses, id)
+	metrics.PeersConnected.Set(float64(len(ps.statuses)))
+}
+
+// handshake runs the status exchange on every new connection and disconnects peers from other chains
+type handshake struct {
+	ctx    context.Context
+	host   host.Host
+	config lib.Config
+	db     database.Database
+	peers  *PeerStatuses
+}
+
+func newHandshake(ctx context.Context, h host.Host, config lib.Config, db database.Database, peers *PeerStatuses) *handshake {
+	hs := &handshake{
+		ctx:    ctx,
+		host:   h,
+		config: config,
+		db:     db,
+		peers:  peers,
+	}
+	h.SetStreamHandler(StatusProtocolID, hs.handleStream)
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF:    hs.connected,
+		DisconnectedF: hs.disconnected,
+	})
+	return hs
+}
+
+func (hs *handshake) localStatus() Status {
+	status := Status{
+		ProtocolVersion: ProtocolVersion,
+		ChainID:         hs.config.ChainID,
+		GenesisHash:     hs.config.GenesisHash,
+		HeadHeight:      -1,
+	}
+
+	head, err := hs.db.GetHead()
+	if err != nil {
+		return status
+	}
+	status.HeadHash = head
+
+	headBlock, err := hs.db.GetBlockByHash(head)
+	if err == nil {
+		status.HeadHeight = headBlock.Header.Height
+	}
+	return status
+}
+
+// connected starts the handshake for connections we dialed, the remote side answers through handleStream
+func (hs *handshake) connected(_ network.Network, conn network.Conn) {
+	if conn.Stat().Direction != network.DirOutbound {
+		return
+	}
+
+	go func() {
+		remote := conn.RemotePeer()
+		ctx, cancel := context.WithTimeout(hs.ctx, handshakeTimeout)
+		defer cancel()
+
+		stream, err := hs.host.NewStream(ctx, remote, StatusProtocolID)
+		if err != nil {
+			hs.rejectPeer(remote, fmt.Sprintf("can't open status stream: %v", err))
+			return
+		}
+		defer stream.Close()
+		_ = stream.SetDeadline(time.Now().Add(handshakeTimeout))
+
+		if err := json.NewEncoder(stream).Encode(hs.localStatus()); err != nil {
+			hs.rejectPeer(remote, fmt.Sprintf("sending status: %v", err))
+			return
+		}
+
+		status, err := readStatus(stream)
+		if err != nil {
+			hs.rejectPeer(remote, fmt.Sprintf("reading status: %v", err))
+			return
+		}
+		hs.checkPeer(remote, status)
+	}()
+}
+
+func (hs *handshake) handleStream(stream network.Stream) {
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(handshakeTimeout))
+	remote := stream.Conn().RemotePeer()
+
+	status, err := readStatus(stream)
+	if err != nil {
+		hs.rejectPeer(remote, fmt.Sprintf("reading status: %v", err))
+		return
+	}
+
+	if err := json.NewEncoder(stream).Encode(hs.localStatus()); err != nil {
+		hs.rejectPeer(remote, fmt.Sprintf("sending status: %v", err))
+		return
+	}
+	hs.checkPeer(remote, status)
+}
+
+func (hs *handshake) disconnected(_ network.Network, conn network.Conn) {
+	remote := conn.RemotePeer()
+	if hs.host.Network().Connectedness(remote) != network.Connected {
+		hs.peers.remove(remote)
+	}
+}
+
+func (hs *handshake) checkPeer(id peer.ID, status Status) {
+	local := hs.localStatus()
+	switch {
+	case status.ProtocolVersion != local.ProtocolVersion:
+		hs.rejectPeer(id, fmt.Sprintf("protocol version %d, ours %d", status.ProtocolVersion, local.ProtocolVersion))
+	case status.ChainID != local.ChainID:
+		hs.rejectPeer(id, fmt.Sprintf("chain ID %d, ours %d", status.ChainID, local.ChainID))
+	case status.GenesisHash != local.GenesisHash:
+		hs.rejectPeer(id, fmt.Sprintf("genesis %s, ours %s", status.GenesisHash.Hex(), local.GenesisHash.Hex()))
+	default:
+		logger.Info("Handshake done", "peer", id, "head", status.HeadHash, "height", status.HeadHeight)
+		hs.peers.accept(id, status)
+	}
+}
+
+func (hs *handshake) rejectPeer(id peer.ID, reason string) {
+	logger.Info("Disconnecting incompatible peer", "peer", id, "reason", reason)
+	hs.peers.reject(id, reason)
+	if err := hs.host.Network().ClosePeer(id); err != nil {
+		logger.Warn("Error disconnecting peer", "peer", id, "err", err)
+	}
+}
+
+func readStatus(r io.Reader) (Status, error) {
+	var status Status
+	err := json.NewDecoder(io.LimitReader(r, maxStatusSize)).Decode(&status)
+	return status, err
+}
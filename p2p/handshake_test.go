@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"minchain/database"
+	"minchain/lib"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := lib.Config{ChainID: 1, GenesisHash: common.Hash{1}}
+	a, aPeers := handshakeHost(t, ctx, config)
+	b, bPeers := handshakeHost(t, ctx, config)
+
+	require.NoError(t, a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}))
+	require.Eventually(t, func() bool {
+		_, aKnowsB := aPeers.Get(b.ID())
+		_, bKnowsA := bPeers.Get(a.ID())
+		return aKnowsB && bKnowsA
+	}, 5*time.Second, 10*time.Millisecond)
+
+	otherChain := lib.Config{ChainID: 2, GenesisHash: common.Hash{1}}
+	c, cPeers := handshakeHost(t, ctx, otherChain)
+
+	require.NoError(t, c.Connect(ctx, peer.AddrInfo{ID: a.ID(), Addrs: a.Addrs()}))
+	require.Eventually(t, func() bool {
+		_, rejected := cPeers.RejectionReason(a.ID())
+		return rejected && len(c.Network().ConnsToPeer(a.ID())) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, aPeers.IsCompatible(c.ID(), ""))
+}
+
+func TestUpdateHead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := lib.Config{ChainID: 1, GenesisHash: common.Hash{1}}
+	a, aPeers := handshakeHost(t, ctx, config)
+	b, _ := handshakeHost(t, ctx, config)
+	require.NoError(t, a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}))
+	require.Eventually(t, func() bool {
+		_, ok := aPeers.Get(b.ID())
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The peer moves ahead of what it reported in the handshake
+	aPeers.UpdateHead(b.ID(), common.Hash{5}, 5)
+	status, _ := aPeers.Get(b.ID())
+	require.Equal(t, int64(5), status.HeadHeight)
+	require.Equal(t, common.Hash{5}, status.HeadHash)
+
+	// A block of a shorter fork doesn't move it back
+	aPeers.UpdateHead(b.ID(), common.Hash{3}, 3)
+	status, _ = aPeers.Get(b.ID())
+	require.Equal(t, int64(5), status.HeadHeight)
+
+	// Peers without a handshake aren't tracked
+	aPeers.UpdateHead(peer.ID("unknown"), common.Hash{7}, 7)
+	_, ok := aPeers.Get(peer.ID("unknown"))
+	require.False(t, ok)
+}
+
+func TestRejectionCooldown(t *testing.T) {
+	clock := lib.NewManualClock(time.Now())
+	peers := NewPeerStatuses(clock)
+	id := peer.ID("other chain")
+
+	peers.reject(id, "genesis mismatch")
+	require.True(t, peers.recentlyRejected(id))
+
+	clock.Advance(rejectionCooldown)
+	require.False(t, peers.recentlyRejected(id))
+	reason, ok := peers.RejectionReason(id)
+	require.True(t, ok)
+	require.Equal(t, "genesis mismatch", reason)
+}
+
+func handshakeHost(t *testing.T, ctx context.Context, config lib.Config) (host.Host, *PeerStatuses) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = h.Close() })
+
+	peers := NewPeerStatuses(lib.NewSystemClock())
+	newHandshake(ctx, h, config, database.NewMemoryDatabase(), peers)
+	return h, peers
+}
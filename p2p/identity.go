@@ -0,0 +1,88 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const nodeKeyFile = "node.key"
+
+// LoadOrCreateIdentity returns the node's libp2p key from the data directory, generating it on first run,
+// so the peer ID survives restarts.
+func LoadOrCreateIdentity(dataDir string) (crypto.PrivKey, error) {
+	path := filepath.Join(dataDir, nodeKeyFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return crypto.UnmarshalPrivateKey(data)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	privateKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = crypto.MarshalPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Generated new node identity", "path", path)
+	return privateKey, nil
+}
+
+// PeerID returns the peer ID of the node's identity in dataDir, without starting the node
+func PeerID(dataDir string) (peer.ID, error) {
+	privateKey, err := LoadOrCreateIdentity(dataDir)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(privateKey)
+}
+
+// PeerAddrs returns the multiaddrs other nodes can dial the node with, when it listens on port
+func PeerAddrs(id peer.ID, port int) ([]multiaddr.Multiaddr, error) {
+	listenAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf(addressTemplate, port))
+	if err != nil {
+		return nil, err
+	}
+
+	interfaceAddrs, err := manet.InterfaceMultiaddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := manet.ResolveUnspecifiedAddress(listenAddr, interfaceAddrs)
+	if err != nil {
+		return nil, err
+	}
+
+	p2pAddr, err := multiaddr.NewMultiaddr("/p2p/" + id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	full := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		full = append(full, addr.Encapsulate(p2pAddr))
+	}
+	return full, nil
+}
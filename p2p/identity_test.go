@@ -0,0 +1,39 @@
+package p2p
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	dataDir := t.TempDir()
+
+	first, err := LoadOrCreateIdentity(dataDir)
+	require.NoError(t, err)
+	second, err := LoadOrCreateIdentity(dataDir)
+	require.NoError(t, err)
+
+	firstId, _ := peer.IDFromPrivateKey(first)
+	secondId, _ := peer.IDFromPrivateKey(second)
+	require.Equal(t, firstId, secondId)
+}
+
+func TestPeerID(t *testing.T) {
+	dataDir := t.TempDir()
+
+	// Only the identity in the data dir is needed, the node isn't configured
+	id, err := PeerID(dataDir)
+	require.NoError(t, err)
+	privateKey, err := LoadOrCreateIdentity(dataDir)
+	require.NoError(t, err)
+	expected, _ := peer.IDFromPrivateKey(privateKey)
+	require.Equal(t, expected, id)
+
+	addrs, err := PeerAddrs(id, 9000)
+	require.NoError(t, err)
+	require.NotEmpty(t, addrs)
+	for _, addr := range addrs {
+		require.Contains(t, addr.String(), "/tcp/9000/p2p/"+id.String())
+	}
+}
@@ -0,0 +1,83 @@
+package p2p
+
+import (
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"sync"
+)
+
+// meshTracer follows which peers gossipsub grafted into our mesh of each topic. Messages are only forwarded
+// along the mesh, so a connected peer outside of it doesn't receive what we relay.
+type meshTracer struct {
+	lock sync.Mutex
+	mesh map[string]map[peer.ID]struct{}
+}
+
+var _ pubsub.RawTracer = (*meshTracer)(nil)
+
+func newMeshTracer() *meshTracer {
+	return &meshTracer{mesh: make(map[string]map[peer.ID]struct{})}
+}
+
+// peers returns the mesh peers of every topic we're in
+func (t *meshTracer) peers() map[string][]peer.ID {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	mesh := make(map[string][]peer.ID, len(t.mesh))
+	for topic, peers := range t.mesh {
+		for id := range peers {
+			mesh[topic] = append(mesh[topic], id)
+		}
+	}
+	return mesh
+}
+
+func (t *meshTracer) inMesh(topic string, id peer.ID) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.mesh[topic][id]
+	return ok
+}
+
+func (t *meshTracer) Graft(p peer.ID, topic string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.mesh[topic] == nil {
+		t.mesh[topic] = make(map[peer.ID]struct{})
+	}
+	t.mesh[topic][p] = struct{}{}
+}
+
+func (t *meshTracer) Prune(p peer.ID, topic string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.mesh[topic], p)
+}
+
+func (t *meshTracer) RemovePeer(p peer.ID) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, peers := range t.mesh {
+		delete(peers, p)
+	}
+}
+
+func (t *meshTracer) Leave(topic string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.mesh, topic)
+}
+
+func (t *meshTracer) AddPeer(peer.ID, protocol.ID)          {}
+func (t *meshTracer) Join(string)                           {}
+func (t *meshTracer) ValidateMessage(*pubsub.Message)       {}
+func (t *meshTracer) DeliverMessage(*pubsub.Message)        {}
+func (t *meshTracer) RejectMessage(*pubsub.Message, string) {}
+func (t *meshTracer) DuplicateMessage(*pubsub.Message)      {}
+func (t *meshTracer) ThrottlePeer(peer.ID)                  {}
+func (t *meshTracer) RecvRPC(*pubsub.RPC)                   {}
+func (t *meshTracer) SendRPC(*pubsub.RPC, peer.ID)          {}
+func (t *meshTracer) DropRPC(*pubsub.RPC, peer.ID)          {}
+func (t *meshTracer) UndeliverableMessage(*pubsub.Message)  {}
@@ -0,0 +1,162 @@
+package p2p
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"math"
+	"minchain/lib"
+	"sync"
+	"time"
+)
+
+const (
+	invalidBlockPenalty       = 60
+	invalidTransactionPenalty = 10
+	banThreshold              = 100
+	banDuration               = 24 * time.Hour
+	// penaltyHalfLife lets occasional mistakes fade away, only repeated misbehaviour leads to a ban
+	penaltyHalfLife = 30 * time.Minute
+	// maxTrackedSources bounds how many message hashes we remember the sender of
+	maxTrackedSources = 10000
+)
+
+// Reporter lets services report messages which failed validation, so the peer which sent them is penalised
+type Reporter interface {
+	ReportInvalidBlock(hash common.Hash, err error)
+	ReportInvalidTransaction(hash common.Hash, err error)
+}
+
+// NopReporter is a Reporter which ignores all reports
+type NopReporter struct{}
+
+func (NopReporter) ReportInvalidBlock(common.Hash, error) {}
+
+func (NopReporter) ReportInvalidTransaction(common.Hash, error) {}
+
+// Misbehaviour keeps penalty points per peer and bans peers which cross banThreshold.
+// Penalties also feed the gossipsub application specific score.
+type Misbehaviour struct {
+	lock      sync.Mutex
+	host      host.Host
+	bans      *BanList
+	clock     lib.Clock
+	penalties map[peer.ID]*penalty
+	// sources remembers which peer delivered a message, so later validation failures can be attributed
+	sources     map[common.Hash]peer.ID
+	sourceOrder []common.Hash
+}
+
+type penalty struct {
+	points  float64
+	updated time.Time
+}
+
+func NewMisbehaviour(h host.Host, bans *BanList, clock lib.Clock) *Misbehaviour {
+	return &Misbehaviour{
+		host:      h,
+		bans:      bans,
+		clock:     clock,
+		penalties: make(map[peer.ID]*penalty),
+		sources:   make(map[common.Hash]peer.ID),
+	}
+}
+
+func (m *Misbehaviour) recordSource(hash common.Hash, from peer.ID) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.sources[hash]; ok {
+		return
+	}
+	m.sources[hash] = from
+	m.sourceOrder = append(m.sourceOrder, hash)
+	if len(m.sourceOrder) > maxTrackedSources {
+		delete(m.sources, m.sourceOrder[0])
+		m.sourceOrder = m.sourceOrder[1:]
+	}
+}
+
+func (m *Misbehaviour) ReportInvalidBlock(hash common.Hash, err error) {
+	m.reportMessage(hash, invalidBlockPenalty, fmt.Sprintf("invalid block %s: %v", hash.Hex(), err))
+}
+
+func (m *Misbehaviour) ReportInvalidTransaction(hash common.Hash, err error) {
+	m.reportMessage(hash, invalidTransactionPenalty, fmt.Sprintf("invalid transaction %s: %v", hash.Hex(), err))
+}
+
+func (m *Misbehaviour) reportMessage(hash common.Hash, points float64, reason string) {
+	m.lock.Lock()
+	from, ok := m.sources[hash]
+	m.lock.Unlock()
+
+	// Our own messages and ones we never received over gossip have nobody to blame
+	if !ok || from == m.host.ID() {
+		return
+	}
+	m.Penalise(from, points, reason)
+}
+
+// Penalise adds penalty points to the peer, banning and disconnecting it once it crosses banThreshold
+func (m *Misbehaviour) Penalise(id peer.ID, points float64, reason string) {
+	m.lock.Lock()
+	p, ok := m.penalties[id]
+	if !ok {
+		p = &penalty{}
+		m.penalties[id] = p
+	}
+	now := m.clock.Now()
+	p.points = decayed(p, now) + points
+	p.updated = now
+	total := p.points
+	if total >= banThreshold {
+		delete(m.penalties, id)
+	}
+	m.lock.Unlock()
+
+	logger.Warn("Penalising peer", "peer", id, "points", total, "reason", reason)
+	if total < banThreshold {
+		return
+	}
+
+	logger.Warn("Banning peer", "peer", id, "duration", banDuration)
+	if err := m.bans.Ban(id, banDuration, reason); err != nil {
+		logger.Error("Error saving the ban list", "err", err)
+	}
+	if err := m.host.Network().ClosePeer(id); err != nil {
+		logger.Warn("Error disconnecting peer", "peer", id, "err", err)
+	}
+}
+
+// Penalty returns the peer's current penalty points
+func (m *Misbehaviour) Penalty(id peer.ID) float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p, ok := m.penalties[id]
+	if !ok {
+		return 0
+	}
+	return decayed(p, m.clock.Now())
+}
+
+// Penalties returns the current penalty points of all penalised peers
+func (m *Misbehaviour) Penalties() map[peer.ID]float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	penalties := make(map[peer.ID]float64, len(m.penalties))
+	for id, p := range m.penalties {
+		penalties[id] = decayed(p, m.clock.Now())
+	}
+	return penalties
+}
+
+func decayed(p *penalty, now time.Time) float64 {
+	if p.updated.IsZero() {
+		return p.points
+	}
+	halfLives := now.Sub(p.updated).Seconds() / penaltyHalfLife.Seconds()
+	return p.points * math.Pow(0.5, halfLives)
+}
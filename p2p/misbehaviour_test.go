@@ -0,0 +1,69 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+	"minchain/lib"
+	"testing"
+	"time"
+)
+
+func TestMisbehaviourBan(t *testing.T) {
+	dataDir := t.TempDir()
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+
+	clock := lib.NewManualClock(time.Now())
+	bans, err := LoadBanList(dataDir, clock)
+	require.NoError(t, err)
+	misbehaviour := NewMisbehaviour(h, bans, clock)
+
+	sender, err := test.RandPeerID()
+	require.NoError(t, err)
+	misbehaviour.recordSource(common.Hash{1}, sender)
+	misbehaviour.recordSource(common.Hash{2}, sender)
+	misbehaviour.recordSource(common.Hash{3}, sender)
+
+	// Unknown messages can't be attributed to anyone
+	misbehaviour.ReportInvalidBlock(common.Hash{4}, errors.New("bad"))
+	require.Zero(t, misbehaviour.Penalty(sender))
+
+	misbehaviour.ReportInvalidBlock(common.Hash{1}, errors.New("bad"))
+	require.Equal(t, float64(invalidBlockPenalty), misbehaviour.Penalty(sender))
+
+	// Penalties decay, so two invalid blocks a few hours apart don't get a peer banned
+	clock.Advance(penaltyHalfLife)
+	require.Equal(t, float64(invalidBlockPenalty)/2, misbehaviour.Penalty(sender))
+	clock.Advance(4 * time.Hour)
+	misbehaviour.ReportInvalidBlock(common.Hash{2}, errors.New("bad"))
+	require.False(t, bans.IsBanned(sender))
+
+	misbehaviour.ReportInvalidBlock(common.Hash{3}, errors.New("bad"))
+	require.True(t, bans.IsBanned(sender))
+	require.False(t, (&banGater{bans: bans}).InterceptPeerDial(sender))
+
+	reloaded, err := LoadBanList(dataDir, clock)
+	require.NoError(t, err)
+	require.True(t, reloaded.IsBanned(sender))
+
+	clock.Advance(banDuration)
+	require.False(t, bans.IsBanned(sender))
+}
+
+func TestPeerScoreParams(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+
+	clock := lib.NewSystemClock()
+	bans, _ := LoadBanList(t.TempDir(), clock)
+	_, err = pubsub.NewGossipSub(context.Background(), h,
+		pubsub.WithPeerScore(peerScoreParams(lib.Config{WireVersions: []int{1}}, NewMisbehaviour(h, bans, clock)), peerScoreThresholds()))
+	require.NoError(t, err)
+}
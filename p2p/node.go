@@ -3,54 +3,132 @@ package p2p
 import (
 	"context"
 	"fmt"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
-	"log"
+	"minchain/database"
 	"minchain/lib"
+	"minchain/logging"
 	"strings"
+	"sync"
 )
 
+var logger = logging.Logger(logging.P2p)
+
 var addressTemplate = "/ip4/0.0.0.0/tcp/%d"
-var transactionsTopic = "transactions"
-var blocksTopic = "blocks"
 
 const DiscoveryServiceTag = "p2p-service"
 
 type Node struct {
 	Publisher Publisher
 	Consumer  Consumer
-
-	p2pHost   host.Host
-	gossipSub *pubsub.PubSub
+	// Fetcher requests blocks and transactions from a single peer
+	Fetcher Fetcher
+	// Peers holds the handshake result of every connected peer
+	Peers *PeerStatuses
+	// Reporter penalises peers which sent messages that later failed validation
+	Reporter Reporter
+
+	p2pHost      host.Host
+	gossipSub    *pubsub.PubSub
+	misbehaviour *Misbehaviour
+	bans         *BanList
+	db           database.Database
+	// pool and recent feed compact block reconstruction, missing transactions are fetched with fetcher
+	fetcher  *P2pFetcher
+	pool     TransactionPool
+	recent   *recentBlocks
+	rebuilds *rebuilds
+	relay    relayCounters
+	mesh     *meshTracer
+	// dht and mdns are nil when that discovery is turned off
+	dht  *dht.IpfsDHT
+	mdns mdns.Service
+
+	scoresLock sync.RWMutex
+	scores     map[peer.ID]float64
 }
 
-func InitNode(ctx context.Context, config lib.Config) (*Node, error) {
-	options := libp2p.ListenAddrStrings(fmt.Sprintf(addressTemplate, config.ListeningPort))
-	p2pHost, err := libp2p.New(options)
+func InitNode(ctx context.Context, config lib.Config, db database.Database, pool TransactionPool, clock lib.Clock, validators MessageValidators) (*Node, error) {
+	if err := checkWireVersions(config.WireVersions); err != nil {
+		return nil, err
+	}
+
+	identity, err := LoadOrCreateIdentity(config.DataDir)
 	if err != nil {
 		return nil, err
 	}
 
-	gossipSub, err := pubsub.NewGossipSub(ctx, p2pHost)
+	bans, err := LoadBanList(config.DataDir, clock)
 	if err != nil {
 		return nil, err
 	}
 
+	p2pHost, err := libp2p.New(
+		libp2p.Identity(identity),
+		libp2p.ListenAddrStrings(fmt.Sprintf(addressTemplate, config.ListeningPort)),
+		libp2p.ConnectionGater(&banGater{bans: bans}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := NewPeerStatuses(clock)
+	newHandshake(ctx, p2pHost, config, db, peers)
+
+	misbehaviour := NewMisbehaviour(p2pHost, bans, clock)
 	node := &Node{
-		p2pHost:   p2pHost,
-		gossipSub: gossipSub,
+		Peers:        peers,
+		Reporter:     misbehaviour,
+		p2pHost:      p2pHost,
+		misbehaviour: misbehaviour,
+		bans:         bans,
+		db:           db,
+		pool:         pool,
+		recent:       newRecentBlocks(),
+		rebuilds:     newRebuilds(ctx),
+		mesh:         newMeshTracer(),
+	}
+	node.fetcher = NewP2pFetcher(p2pHost, db, pool, node.recent, peers)
+	node.Fetcher = node.fetcher
+
+	node.gossipSub, err = pubsub.NewGossipSub(ctx, p2pHost,
+		pubsub.WithPeerFilter(peers.IsCompatible),
+		pubsub.WithPeerScore(peerScoreParams(config, misbehaviour), peerScoreThresholds()),
+		pubsub.WithPeerScoreInspect(node.updateScores, scoreInspectInterval),
+		pubsub.WithRawTracer(node.mesh),
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	s := mdns.NewMdnsService(node.p2pHost, DiscoveryServiceTag, &discoveryNotifee{ctx: ctx, h: p2pHost})
+	notifee := &discoveryNotifee{ctx: ctx, h: p2pHost, peers: peers}
 
-	if err := s.Start(); err != nil {
+	bootstrapPeers, err := parseBootstrapPeers(config.BootstrapPeers)
+	if err != nil {
 		return nil, err
 	}
+	node.keepBootstrapPeersConnected(ctx, clock, bootstrapPeers)
 
-	if err := node.initPublisher(); err != nil {
+	if config.EnableDHT {
+		if err := node.startDHTDiscovery(ctx, config, clock, bootstrapPeers, notifee); err != nil {
+			return nil, err
+		}
+	}
+
+	// mDNS only finds peers on the local network, production deployments rely on bootstrap peers and the DHT
+	if config.EnableMDNS {
+		node.mdns = mdns.NewMdnsService(node.p2pHost, DiscoveryServiceTag, notifee)
+		if err := node.mdns.Start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := node.initPublisher(ctx, config, validators); err != nil {
 		return nil, err
 	}
 
@@ -58,15 +136,20 @@ func InitNode(ctx context.Context, config lib.Config) (*Node, error) {
 }
 
 type discoveryNotifee struct {
-	ctx context.Context
-	h   host.Host
+	ctx   context.Context
+	h     host.Host
+	peers *PeerStatuses
 }
 
 func (n *discoveryNotifee) HandlePeerFound(pi peer.AddrInfo) {
-	log.Printf("Discovered new peer %s\n", pi.ID.String())
+	if n.peers.recentlyRejected(pi.ID) {
+		return
+	}
+
+	logger.Debug("Discovered peer", "peer", pi.ID)
 	err := n.h.Connect(n.ctx, pi)
 	if err != nil {
-		log.Printf("Error connecting to peer %s: %s\n", pi.ID.String(), err)
+		logger.Info("Error connecting to peer", "peer", pi.ID, "err", err)
 		return
 	}
 }
@@ -85,37 +168,75 @@ func (n *Node) Hostname() string {
 	return n.p2pHost.ID().String()
 }
 
-// Ensures subscription to transactions and blocks and returns a publisher
-func (n *Node) initPublisher() error {
+// Ensures subscription to transactions and blocks on every configured wire version and returns a publisher
+func (n *Node) initPublisher(ctx context.Context, config lib.Config, validators MessageValidators) error {
 	if n.Publisher != nil {
 		return nil
 	}
 
-	txSubscription, txTopic, err := n.subscribeToTopic(transactionsTopic)
-	if err != nil {
-		return err
+	txTopics := make([]*versionedTopic, 0, len(config.WireVersions))
+	blocksTopics := make([]*versionedTopic, 0, len(config.WireVersions))
+	compactTopics := make([]*versionedTopic, 0, len(config.WireVersions))
+	for _, version := range config.WireVersions {
+		encoding := wireEncodings[version]
+
+		txTopic, err := n.subscribeToTopic(config.GenesisHash, transactionsTopic, version,
+			n.validateTransaction(encoding, validators.Transaction))
+		if err != nil {
+			return err
+		}
+		txTopics = append(txTopics, txTopic)
+
+		blocksTopic, err := n.subscribeToTopic(config.GenesisHash, blocksTopic, version,
+			n.validateBlock(encoding, validators.Block))
+		if err != nil {
+			return err
+		}
+		blocksTopics = append(blocksTopics, blocksTopic)
+
+		// Compact blocks are always received, publishing them is opt-in
+		compactTopic, err := n.subscribeToTopic(config.GenesisHash, compactBlocksTopic, version,
+			n.validateCompactBlock(encoding, version, validators.Block))
+		if err != nil {
+			return err
+		}
+		n.rebuilds.setTopic(version, compactTopic)
+		compactTopics = append(compactTopics, compactTopic)
 	}
 
-	blocksSubscription, blocksTopic, err := n.subscribeToTopic(blocksTopic)
-	if err != nil {
-		return err
+	publisher := NewP2pPublisher(txTopics, blocksTopics)
+	if config.CompactBlocks {
+		publisher.compactTopics = compactTopics
+		publisher.recent = n.recent
 	}
-
-	n.Publisher = NewP2pPublisher(txTopic, blocksTopic)
-	n.Consumer = NewP2pConsumer(txSubscription, blocksSubscription)
+	n.Publisher = publisher
+	n.Consumer = NewP2pConsumer(ctx, txTopics, blocksTopics, compactTopics)
 	return nil
 }
 
-func (n *Node) subscribeToTopic(topic string) (*pubsub.Subscription, *pubsub.Topic, error) {
+// subscribeToTopic registers the topic validator before joining, so no message gets through unchecked
+func (n *Node) subscribeToTopic(genesisHash common.Hash, kind string, version int, validator pubsub.ValidatorEx) (*versionedTopic, error) {
+	topic := topicName(genesisHash, kind, version)
+	if err := n.gossipSub.RegisterTopicValidator(topic, validator); err != nil {
+		return nil, err
+	}
+
 	joinedTopic, err := n.gossipSub.Join(topic)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	subscription, err := joinedTopic.Subscribe()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return subscription, joinedTopic, nil
+	logger.Info("Subscribed to topic", "topic", topic)
+	return &versionedTopic{
+		kind:         kind,
+		version:      version,
+		encoding:     wireEncodings[version],
+		topic:        joinedTopic,
+		subscription: subscription,
+	}, nil
 }
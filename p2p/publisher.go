@@ -2,9 +2,9 @@ package p2p
 
 import (
 	"context"
-	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	"log"
+	"errors"
 	"minchain/core/types"
+	"minchain/metrics"
 )
 
 type Publisher interface {
@@ -12,36 +12,77 @@ type Publisher interface {
 	PublishTransaction(ctx context.Context, transaction *types.Tx) error
 }
 
+// P2pPublisher publishes on every subscribed wire version, so peers which haven't upgraded yet still receive it
 type P2pPublisher struct {
-	txTopic     *pubsub.Topic
-	blocksTopic *pubsub.Topic
+	txTopics     []*versionedTopic
+	blocksTopics []*versionedTopic
+	// compactTopics are set when blocks are announced as compact blocks instead of in full
+	compactTopics []*versionedTopic
+	recent        *recentBlocks
 }
 
-func NewP2pPublisher(txTopic *pubsub.Topic, blocksTopic *pubsub.Topic) Publisher {
+func NewP2pPublisher(txTopics []*versionedTopic, blocksTopics []*versionedTopic) *P2pPublisher {
 	return &P2pPublisher{
-		txTopic:     txTopic,
-		blocksTopic: blocksTopic,
+		txTopics:     txTopics,
+		blocksTopics: blocksTopics,
 	}
 }
 
 func (p *P2pPublisher) PublishBlock(ctx context.Context, block *types.Block) error {
-	log.Println("Publisher.PublishBlock:", block.BlockHash())
-	json, err := block.ToJson()
+	logger.Debug("Publishing block", "hash", block.BlockHash())
+	if len(p.compactTopics) > 0 {
+		return p.publishCompactBlock(ctx, block)
+	}
+
+	var errs []error
+	for _, topic := range p.blocksTopics {
+		data, err := topic.encode(ctx, func(encoding wireEncoding) ([]byte, error) { return encoding.EncodeBlock(block) })
+		if err != nil {
+			return err
+		}
+		errs = append(errs, publish(ctx, topic, data))
+	}
+	return errors.Join(errs...)
+}
+
+// publishCompactBlock keeps the full block around, so peers missing some of its transactions can fetch them from us
+func (p *P2pPublisher) publishCompactBlock(ctx context.Context, block *types.Block) error {
+	compact, err := types.NewCompactBlock(block)
 	if err != nil {
 		return err
 	}
+	p.recent.add(block)
 
-	return p.blocksTopic.Publish(ctx, json)
+	var errs []error
+	for _, topic := range p.compactTopics {
+		data, err := topic.encode(ctx, func(encoding wireEncoding) ([]byte, error) { return encoding.EncodeCompactBlock(compact) })
+		if err != nil {
+			return err
+		}
+		errs = append(errs, publish(ctx, topic, data))
+	}
+	return errors.Join(errs...)
 }
 
 func (p *P2pPublisher) PublishTransaction(ctx context.Context, transaction *types.Tx) error {
 	hash, _ := transaction.Hash()
-	log.Println("Publisher.PublishTransaction:", hash)
+	logger.Debug("Publishing transaction", "hash", hash)
 
-	json, err := transaction.ToJson()
-	if err != nil {
-		return err
+	var errs []error
+	for _, topic := range p.txTopics {
+		data, err := topic.encode(ctx, func(encoding wireEncoding) ([]byte, error) { return encoding.EncodeTransaction(transaction) })
+		if err != nil {
+			return err
+		}
+		errs = append(errs, publish(ctx, topic, data))
 	}
+	return errors.Join(errs...)
+}
 
-	return p.txTopic.Publish(ctx, json)
+func publish(ctx context.Context, topic *versionedTopic, data []byte) error {
+	if err := topic.topic.Publish(ctx, data); err != nil {
+		return err
+	}
+	metrics.GossipMessages.WithLabelValues(topic.label(), metrics.Out).Inc()
+	return nil
 }
@@ -0,0 +1,577 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"io"
+	"math"
+	"minchain/core/types"
+	"minchain/database"
+	"sync"
+	"time"
+)
+
+const (
+	GetBlockByHashProtocolID   protocol.ID = "/minchain/req/block_by_hash/2.0.0"
+	GetBlocksByRangeProtocolID protocol.ID = "/minchain/req/blocks_by_range/2.0.0"
+	GetHeadersProtocolID       protocol.ID = "/minchain/req/headers/2.0.0"
+	GetTransactionsProtocolID  protocol.ID = "/minchain/req/transactions/2.0.0"
+
+	requestTimeout  = 10 * time.Second
+	maxRequestSize  = 16 << 10
+	maxResponseSize = 16 << 20
+	// maxRangeBytes caps the blocks of a range response, it leaves room for the RLP headers around them
+	maxRangeBytes   = maxResponseSize - 1<<10
+	maxRangeBlocks  = 64
+	maxRangeHeaders = 512
+	maxTxHashes     = 256
+	// maxTxIndexes keeps a block transactions request under maxRequestSize
+	maxTxIndexes = 1024
+	// maxConcurrentRequests is how many requests may be in flight with one peer, in each direction
+	maxConcurrentRequests = 4
+)
+
+var (
+	ErrorNotFound        = errors.New("not found")
+	ErrorTooManyRequests = errors.New("too many concurrent requests")
+	ErrorInvalidRequest  = errors.New("invalid request")
+	ErrorInvalidResponse = errors.New("invalid response")
+)
+
+// Requests and responses are RLP encoded, like the binary wire encoding of gossip messages
+type hashRequest struct {
+	Hash common.Hash
+}
+
+type rangeRequest struct {
+	From  uint64
+	Count uint64
+}
+
+type transactionsRequest struct {
+	Hashes []common.Hash
+}
+
+type blockTxsRequest struct {
+	BlockHash common.Hash
+	Indexes   []uint64
+}
+
+// response is shared by all request protocols, only the list of the requested kind is set. Its items are the binary
+// encodings of blocks, headers or transactions.
+type response struct {
+	Error        string
+	Blocks       [][]byte
+	Headers      [][]byte
+	Transactions [][]byte
+	// size is how many bytes the response took on the wire
+	size int64
+}
+
+// P2pFetcher serves the request protocols and sends requests to other peers
+type P2pFetcher struct {
+	host   host.Host
+	db     database.Database
+	pool   TransactionPool
+	recent *recentBlocks
+	// peers learn the heads of the peers which answer us, it's nil when they aren't tracked
+	peers    *PeerStatuses
+	inbound  *peerLimiter
+	outbound *peerLimiter
+}
+
+func NewP2pFetcher(h host.Host, db database.Database, pool TransactionPool, recent *recentBlocks, peers *PeerStatuses) *P2pFetcher {
+	f := &P2pFetcher{
+		host:     h,
+		db:       db,
+		pool:     pool,
+		recent:   recent,
+		peers:    peers,
+		inbound:  newPeerLimiter(maxConcurrentRequests),
+		outbound: newPeerLimiter(maxConcurrentRequests),
+	}
+	h.SetStreamHandler(GetBlockByHashProtocolID, f.serve(f.blockByHash))
+	h.SetStreamHandler(GetBlocksByRangeProtocolID, f.serve(f.blocksByRange))
+	h.SetStreamHandler(GetHeadersProtocolID, f.serve(f.headers))
+	h.SetStreamHandler(GetTransactionsProtocolID, f.serve(f.transactions))
+	h.SetStreamHandler(BlockTxsProtocolID, f.serve(f.blockTransactions))
+	return f
+}
+
+func (f *P2pFetcher) GetBlockByHash(ctx context.Context, id peer.ID, hash common.Hash) (*types.Block, error) {
+	var resp response
+	if err := f.request(ctx, id, GetBlockByHashProtocolID, hashRequest{Hash: hash}, &resp); err != nil {
+		return nil, err
+	}
+	blocks, err := decodeBlocks(resp.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) != 1 || blocks[0].BlockHash() != hash {
+		return nil, fmt.Errorf("%w: expected block %s", ErrorInvalidResponse, hash.Hex())
+	}
+	if err := checkBody(blocks[0]); err != nil {
+		return nil, err
+	}
+	f.updateHead(id, blocks[0].Header)
+	return blocks[0], nil
+}
+
+// GetBlocksByRange may return fewer blocks than asked for, up to the head of the peer or as many as fit in a
+// response. The rest can be asked for again from the height after the last block.
+func (f *P2pFetcher) GetBlocksByRange(ctx context.Context, id peer.ID, from int64, count int) ([]*types.Block, error) {
+	if from < 0 || count <= 0 {
+		return nil, ErrorInvalidRequest
+	}
+	var resp response
+	if err := f.request(ctx, id, GetBlocksByRangeProtocolID, rangeRequest{From: uint64(from), Count: uint64(count)}, &resp); err != nil {
+		return nil, err
+	}
+	blocks, err := decodeBlocks(resp.Blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make([]types.BlockHeader, 0, len(blocks))
+	for _, block := range blocks {
+		if err := checkBody(block); err != nil {
+			return nil, err
+		}
+		headers = append(headers, block.Header)
+	}
+	if err := checkRange(headers, from, count); err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 {
+		f.updateHead(id, headers[len(headers)-1])
+	}
+	return blocks, nil
+}
+
+func (f *P2pFetcher) GetHeaders(ctx context.Context, id peer.ID, from int64, count int) ([]types.BlockHeader, error) {
+	if from < 0 || count <= 0 {
+		return nil, ErrorInvalidRequest
+	}
+	var resp response
+	if err := f.request(ctx, id, GetHeadersProtocolID, rangeRequest{From: uint64(from), Count: uint64(count)}, &resp); err != nil {
+		return nil, err
+	}
+	headers := make([]types.BlockHeader, 0, len(resp.Headers))
+	for _, data := range resp.Headers {
+		header, err := types.HeaderFromBinary(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrorInvalidResponse, err)
+		}
+		headers = append(headers, *header)
+	}
+	if err := checkRange(headers, from, count); err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 {
+		f.updateHead(id, headers[len(headers)-1])
+	}
+	return headers, nil
+}
+
+// updateHead notes that the peer has the block with the given header
+func (f *P2pFetcher) updateHead(id peer.ID, header types.BlockHeader) {
+	if f.peers != nil {
+		f.peers.UpdateHead(id, (&types.Block{Header: header}).BlockHash(), header.Height)
+	}
+}
+
+func (f *P2pFetcher) GetTransactions(ctx context.Context, id peer.ID, hashes []common.Hash) ([]types.Tx, error) {
+	var resp response
+	if err := f.request(ctx, id, GetTransactionsProtocolID, transactionsRequest{Hashes: hashes}, &resp); err != nil {
+		return nil, err
+	}
+
+	txs, err := decodeTransactions(resp.Transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[common.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		requested[hash] = true
+	}
+	for i := range txs {
+		hash, err := txs[i].Hash()
+		if err != nil || !requested[hash] {
+			return nil, fmt.Errorf("%w: unrequested transaction", ErrorInvalidResponse)
+		}
+	}
+	return txs, nil
+}
+
+// GetBlockTransactions returns the transactions of a block at the given indexes, in the same order. Compact block
+// receivers use it for the transactions missing from their mempool.
+func (f *P2pFetcher) GetBlockTransactions(ctx context.Context, id peer.ID, blockHash common.Hash, indexes []int) ([]types.Tx, error) {
+	txs, _, err := f.blockTxs(ctx, id, blockHash, indexes)
+	return txs, err
+}
+
+// blockTxs also returns the size of the response, for the compact relay stats
+func (f *P2pFetcher) blockTxs(ctx context.Context, id peer.ID, blockHash common.Hash, indexes []int) ([]types.Tx, int64, error) {
+	var txs []types.Tx
+	var size int64
+	for start := 0; start < len(indexes); start += maxTxIndexes {
+		req := blockTxsRequest{BlockHash: blockHash, Indexes: make([]uint64, 0, maxTxIndexes)}
+		for _, index := range indexes[start:min(start+maxTxIndexes, len(indexes))] {
+			if index < 0 {
+				return nil, size, ErrorInvalidRequest
+			}
+			req.Indexes = append(req.Indexes, uint64(index))
+		}
+		var resp response
+		if err := f.request(ctx, id, BlockTxsProtocolID, req, &resp); err != nil {
+			return nil, size, err
+		}
+		size += resp.size
+		chunk, err := decodeTransactions(resp.Transactions)
+		if err != nil {
+			return nil, size, err
+		}
+		if len(chunk) != len(req.Indexes) {
+			return nil, size, fmt.Errorf("%w: asked for %d transactions, got %d", ErrorInvalidResponse, len(req.Indexes), len(chunk))
+		}
+		txs = append(txs, chunk...)
+	}
+	return txs, size, nil
+}
+
+// checkBody makes sure a peer sent the transactions the block header commits to
+func checkBody(block *types.Block) error {
+	txHash, err := types.CombinedHash(block.Transactions)
+	if err != nil || txHash != block.Header.TransactionHash {
+		return fmt.Errorf("%w: transactions of block %s don't match its header", ErrorInvalidResponse, block.BlockHash().Hex())
+	}
+	return nil
+}
+
+// checkRange makes sure a peer returned consecutive linked headers from the requested range
+func checkRange(headers []types.BlockHeader, from int64, count int) error {
+	if len(headers) > count {
+		return fmt.Errorf("%w: asked for %d items, got %d", ErrorInvalidResponse, count, len(headers))
+	}
+	for i := range headers {
+		if headers[i].Height != from+int64(i) {
+			return fmt.Errorf("%w: expected height %d, got %d", ErrorInvalidResponse, from+int64(i), headers[i].Height)
+		}
+		if i > 0 {
+			parent := types.Block{Header: headers[i-1]}
+			if headers[i].ParentHash != parent.BlockHash() {
+				return fmt.Errorf("%w: height %d doesn't link to its parent", ErrorInvalidResponse, headers[i].Height)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *P2pFetcher) request(ctx context.Context, id peer.ID, protocolID protocol.ID, req interface{}, resp *response) error {
+	if !f.outbound.acquire(id) {
+		return ErrorTooManyRequests
+	}
+	defer f.outbound.release(id)
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	stream, err := f.host.NewStream(ctx, id, protocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(requestTimeout))
+
+	data, err := rlp.EncodeToBytes(req)
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Write(data); err != nil {
+		return err
+	}
+	if err := stream.CloseWrite(); err != nil {
+		return err
+	}
+
+	data, err = io.ReadAll(io.LimitReader(stream, maxResponseSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxResponseSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrorInvalidResponse, maxResponseSize)
+	}
+	if err := rlp.DecodeBytes(data, resp); err != nil {
+		return fmt.Errorf("%w: %s", ErrorInvalidResponse, err)
+	}
+	resp.size = int64(len(data))
+
+	switch resp.Error {
+	case "":
+		return nil
+	case ErrorNotFound.Error():
+		return ErrorNotFound
+	case ErrorTooManyRequests.Error():
+		return ErrorTooManyRequests
+	default:
+		return fmt.Errorf("peer %s: %s", id, resp.Error)
+	}
+}
+
+// serve decodes a request, runs the handler and writes its response or error
+func (f *P2pFetcher) serve(handler func(data []byte) (response, error)) network.StreamHandler {
+	return func(stream network.Stream) {
+		defer stream.Close()
+		_ = stream.SetDeadline(time.Now().Add(requestTimeout))
+		remote := stream.Conn().RemotePeer()
+
+		var resp response
+		if f.inbound.acquire(remote) {
+			defer f.inbound.release(remote)
+
+			data, err := io.ReadAll(io.LimitReader(stream, maxRequestSize+1))
+			switch {
+			case err != nil:
+				_ = stream.Reset()
+				return
+			case len(data) > maxRequestSize:
+				err = ErrorInvalidRequest
+			default:
+				resp, err = handler(data)
+			}
+			if err != nil {
+				resp = response{Error: err.Error()}
+			}
+		} else {
+			resp = response{Error: ErrorTooManyRequests.Error()}
+		}
+
+		data, err := rlp.EncodeToBytes(&resp)
+		if err == nil {
+			_, err = stream.Write(data)
+		}
+		if err != nil {
+			logger.Warn("Error answering request", "protocol", stream.Protocol(), "peer", remote, "err", err)
+		}
+	}
+}
+
+func (f *P2pFetcher) blockByHash(data []byte) (response, error) {
+	var req hashRequest
+	if err := rlp.DecodeBytes(data, &req); err != nil {
+		return response{}, ErrorInvalidRequest
+	}
+
+	block, err := f.findBlock(req.Hash)
+	if err != nil {
+		return response{}, err
+	}
+	encoded, err := block.ToBinary()
+	if err != nil {
+		return response{}, err
+	}
+	return response{Blocks: [][]byte{encoded}}, nil
+}
+
+// blocksByRange stops before the block which would take the response past maxRangeBytes, the client asks again
+// from there
+func (f *P2pFetcher) blocksByRange(data []byte) (response, error) {
+	req, err := decodeRange(data, maxRangeBlocks)
+	if err != nil {
+		return response{}, err
+	}
+
+	blocks, err := database.CanonicalRange(f.db, int64(req.From), int(req.Count))
+	if err != nil {
+		return response{}, err
+	}
+	resp := response{Blocks: make([][]byte, 0, len(blocks))}
+	size := 0
+	for _, block := range blocks {
+		encoded, err := block.ToBinary()
+		if err != nil {
+			return response{}, err
+		}
+		if size += len(encoded); size > maxRangeBytes {
+			break
+		}
+		resp.Blocks = append(resp.Blocks, encoded)
+	}
+	return resp, nil
+}
+
+func (f *P2pFetcher) headers(data []byte) (response, error) {
+	req, err := decodeRange(data, maxRangeHeaders)
+	if err != nil {
+		return response{}, err
+	}
+
+	blocks, err := database.CanonicalRange(f.db, int64(req.From), int(req.Count))
+	if err != nil {
+		return response{}, err
+	}
+	resp := response{Headers: make([][]byte, 0, len(blocks))}
+	for _, block := range blocks {
+		encoded, err := block.Header.ToBinary()
+		if err != nil {
+			return response{}, err
+		}
+		resp.Headers = append(resp.Headers, encoded)
+	}
+	return resp, nil
+}
+
+func decodeRange(data []byte, maxCount uint64) (rangeRequest, error) {
+	var req rangeRequest
+	if err := rlp.DecodeBytes(data, &req); err != nil || req.From > math.MaxInt64 || req.Count == 0 || req.Count > maxCount {
+		return rangeRequest{}, ErrorInvalidRequest
+	}
+	return req, nil
+}
+
+// transactions are served from the mempool, recently relayed blocks and the canonical chain
+func (f *P2pFetcher) transactions(data []byte) (response, error) {
+	var req transactionsRequest
+	if err := rlp.DecodeBytes(data, &req); err != nil || len(req.Hashes) > maxTxHashes {
+		return response{}, ErrorInvalidRequest
+	}
+
+	wanted := make(map[common.Hash]bool, len(req.Hashes))
+	for _, hash := range req.Hashes {
+		wanted[hash] = true
+	}
+
+	found := make([]types.Tx, 0, len(req.Hashes))
+	collect := func(txs []types.Tx) {
+		for _, tx := range txs {
+			hash, err := tx.Hash()
+			if err == nil && wanted[hash] {
+				found = append(found, tx)
+				delete(wanted, hash)
+			}
+		}
+	}
+	if f.pool != nil {
+		collect(f.pool.ListPendingTransactions())
+	}
+	for _, block := range f.recent.all() {
+		collect(block.Transactions)
+	}
+	for hash := range wanted {
+		blockHash, err := f.db.GetTransactionBlock(hash)
+		if err != nil {
+			continue
+		}
+		if block, err := f.db.GetBlockByHash(blockHash); err == nil {
+			collect(block.Transactions)
+		}
+	}
+	return encodeTransactions(found)
+}
+
+// blockTransactions serves the transactions a compact block receiver is missing. The block is usually one we just
+// relayed, before the block processing has stored it.
+func (f *P2pFetcher) blockTransactions(data []byte) (response, error) {
+	var req blockTxsRequest
+	if err := rlp.DecodeBytes(data, &req); err != nil || len(req.Indexes) > maxTxIndexes {
+		return response{}, ErrorInvalidRequest
+	}
+
+	block, err := f.findBlock(req.BlockHash)
+	if err != nil {
+		return response{}, err
+	}
+	txs := make([]types.Tx, 0, len(req.Indexes))
+	for _, index := range req.Indexes {
+		if index >= uint64(len(block.Transactions)) {
+			return response{}, ErrorInvalidRequest
+		}
+		txs = append(txs, block.Transactions[index])
+	}
+	return encodeTransactions(txs)
+}
+
+func (f *P2pFetcher) findBlock(hash common.Hash) (*types.Block, error) {
+	if block, ok := f.recent.get(hash); ok {
+		return block, nil
+	}
+	block, err := f.db.GetBlockByHash(hash)
+	if errors.Is(err, database.ErrorBlockNotFound) {
+		return nil, ErrorNotFound
+	}
+	return block, err
+}
+
+func encodeTransactions(txs []types.Tx) (response, error) {
+	resp := response{Transactions: make([][]byte, 0, len(txs))}
+	for i := range txs {
+		encoded, err := txs[i].ToBinary()
+		if err != nil {
+			return response{}, err
+		}
+		resp.Transactions = append(resp.Transactions, encoded)
+	}
+	return resp, nil
+}
+
+func decodeTransactions(encoded [][]byte) ([]types.Tx, error) {
+	txs := make([]types.Tx, 0, len(encoded))
+	for _, data := range encoded {
+		tx, err := types.TransactionFromBinary(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrorInvalidResponse, err)
+		}
+		txs = append(txs, *tx)
+	}
+	return txs, nil
+}
+
+func decodeBlocks(encoded [][]byte) ([]*types.Block, error) {
+	blocks := make([]*types.Block, 0, len(encoded))
+	for _, data := range encoded {
+		block, err := types.BlockFromBinary(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrorInvalidResponse, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// peerLimiter caps the number of requests in flight with each peer
+type peerLimiter struct {
+	lock   sync.Mutex
+	limit  int
+	active map[peer.ID]int
+}
+
+func newPeerLimiter(limit int) *peerLimiter {
+	return &peerLimiter{limit: limit, active: make(map[peer.ID]int)}
+}
+
+func (l *peerLimiter) acquire(id peer.ID) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.active[id] >= l.limit {
+		return false
+	}
+	l.active[id]++
+	return true
+}
+
+func (l *peerLimiter) release(id peer.ID) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.active[id]--
+	if l.active[id] <= 0 {
+		delete(l.active, id)
+	}
+}
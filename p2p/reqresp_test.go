@@ -0,0 +1,156 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"minchain/database"
+	"strings"
+	"testing"
+)
+
+func TestFetcher(t *testing.T) {
+	ctx := context.Background()
+
+	// Server has a chain of 10 blocks on top of genesis and one pending transaction
+	db := database.NewMemoryDatabase()
+	chain := []*types.Block{{Header: types.BlockHeader{Height: 0}}}
+	for height := int64(1); height <= 10; height++ {
+		txs := []types.Tx{{From: "0x01", Data: fmt.Sprintf("tx %d", height)}}
+		txHash, _ := types.CombinedHash(txs)
+		chain = append(chain, &types.Block{
+			Header:       types.BlockHeader{ParentHash: chain[height-1].BlockHash(), TransactionHash: txHash, Height: height},
+			Transactions: txs,
+		})
+	}
+	for _, block := range chain {
+		require.NoError(t, db.PutBlock(block))
+	}
+	require.NoError(t, db.SetHead(chain[10].BlockHash()))
+	pending := types.Tx{From: "0x02", Data: "pending"}
+
+	server := fetcherHost(t, db, &testPool{txs: []types.Tx{pending}})
+	client := fetcherHost(t, database.NewMemoryDatabase(), nil)
+	require.NoError(t, client.host.Connect(ctx, peer.AddrInfo{ID: server.host.ID(), Addrs: server.host.Addrs()}))
+	serverId := server.host.ID()
+
+	block, err := client.GetBlockByHash(ctx, serverId, chain[3].BlockHash())
+	require.NoError(t, err)
+	require.Equal(t, chain[3].BlockHash(), block.BlockHash())
+
+	_, err = client.GetBlockByHash(ctx, serverId, common.Hash{0xff})
+	require.ErrorIs(t, err, ErrorNotFound)
+
+	blocks, err := client.GetBlocksByRange(ctx, serverId, 4, 3)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	require.Equal(t, chain[6].BlockHash(), blocks[2].BlockHash())
+
+	// The range is cut at the head
+	headers, err := client.GetHeaders(ctx, serverId, 8, 100)
+	require.NoError(t, err)
+	require.Equal(t, []types.BlockHeader{chain[8].Header, chain[9].Header, chain[10].Header}, headers)
+
+	_, err = client.GetBlocksByRange(ctx, serverId, 0, maxRangeBlocks+1)
+	require.ErrorContains(t, err, ErrorInvalidRequest.Error())
+
+	// Pending transactions come from the mempool, included ones from the transaction index
+	pendingHash, _ := pending.Hash()
+	includedHash, _ := chain[2].Transactions[0].Hash()
+	txs, err := client.GetTransactions(ctx, serverId, []common.Hash{pendingHash, {0xff}, includedHash})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []types.Tx{pending, chain[2].Transactions[0]}, txs)
+
+	txs, err = client.GetBlockTransactions(ctx, serverId, chain[5].BlockHash(), []int{0})
+	require.NoError(t, err)
+	require.Equal(t, chain[5].Transactions, txs)
+	_, err = client.GetBlockTransactions(ctx, serverId, chain[5].BlockHash(), []int{1})
+	require.ErrorContains(t, err, ErrorInvalidRequest.Error())
+}
+
+func TestFetcherChecksBodies(t *testing.T) {
+	ctx := context.Background()
+
+	txs := []types.Tx{{From: "0x01", Data: "original"}}
+	txHash, _ := types.CombinedHash(txs)
+	genesis := &types.Block{Header: types.BlockHeader{Height: 0}}
+	block := &types.Block{
+		Header:       types.BlockHeader{ParentHash: genesis.BlockHash(), TransactionHash: txHash, Height: 1},
+		Transactions: []types.Tx{{From: "0x01", Data: "swapped"}},
+	}
+
+	// The header still hashes the same, only the body was swapped
+	db := database.NewMemoryDatabase()
+	require.NoError(t, db.PutBlock(genesis))
+	require.NoError(t, db.PutBlock(block))
+	require.NoError(t, db.SetHead(block.BlockHash()))
+
+	server := fetcherHost(t, db, nil)
+	client := fetcherHost(t, database.NewMemoryDatabase(), nil)
+	require.NoError(t, client.host.Connect(ctx, peer.AddrInfo{ID: server.host.ID(), Addrs: server.host.Addrs()}))
+
+	_, err := client.GetBlockByHash(ctx, server.host.ID(), block.BlockHash())
+	require.ErrorIs(t, err, ErrorInvalidResponse)
+	_, err = client.GetBlocksByRange(ctx, server.host.ID(), 0, 2)
+	require.ErrorIs(t, err, ErrorInvalidResponse)
+}
+
+func TestFetcherSplitsLargeRanges(t *testing.T) {
+	ctx := context.Background()
+
+	// 20 blocks of 1 MiB don't fit in one response
+	db := database.NewMemoryDatabase()
+	chain := []*types.Block{{Header: types.BlockHeader{Height: 0}}}
+	for height := int64(1); height <= 20; height++ {
+		txs := []types.Tx{{From: "0x01", Data: fmt.Sprintf("%d %s", height, strings.Repeat("x", 1<<20))}}
+		txHash, _ := types.CombinedHash(txs)
+		chain = append(chain, &types.Block{
+			Header:       types.BlockHeader{ParentHash: chain[height-1].BlockHash(), TransactionHash: txHash, Height: height},
+			Transactions: txs,
+		})
+	}
+	for _, block := range chain {
+		require.NoError(t, db.PutBlock(block))
+	}
+	require.NoError(t, db.SetHead(chain[20].BlockHash()))
+
+	server := fetcherHost(t, db, nil)
+	client := fetcherHost(t, database.NewMemoryDatabase(), nil)
+	require.NoError(t, client.host.Connect(ctx, peer.AddrInfo{ID: server.host.ID(), Addrs: server.host.Addrs()}))
+
+	first, err := client.GetBlocksByRange(ctx, server.host.ID(), 1, 20)
+	require.NoError(t, err)
+	require.NotEmpty(t, first)
+	require.Less(t, len(first), 20)
+
+	// The client asks again from the last block it received
+	next := first[len(first)-1].Header.Height + 1
+	rest, err := client.GetBlocksByRange(ctx, server.host.ID(), next, 21-int(next))
+	require.NoError(t, err)
+	require.Equal(t, 20, len(first)+len(rest))
+	require.Equal(t, chain[20].BlockHash(), rest[len(rest)-1].BlockHash())
+}
+
+func TestPeerLimiter(t *testing.T) {
+	limiter := newPeerLimiter(2)
+	id := peer.ID("peer")
+
+	require.True(t, limiter.acquire(id))
+	require.True(t, limiter.acquire(id))
+	require.False(t, limiter.acquire(id))
+	require.True(t, limiter.acquire(peer.ID("other")))
+
+	limiter.release(id)
+	require.True(t, limiter.acquire(id))
+}
+
+func fetcherHost(t *testing.T, db database.Database, pool TransactionPool) *P2pFetcher {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = h.Close() })
+	return NewP2pFetcher(h, db, pool, newRecentBlocks(), nil)
+}
@@ -0,0 +1,115 @@
+package p2p
+
+import (
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/lib"
+	"time"
+)
+
+const (
+	scoreInspectInterval = 10 * time.Second
+	// misbehaviourWeight turns a ban-worthy penalty into a score below the graylist threshold
+	misbehaviourWeight = 30
+)
+
+func peerScoreParams(config lib.Config, misbehaviour *Misbehaviour) *pubsub.PeerScoreParams {
+	topics := make(map[string]*pubsub.TopicScoreParams)
+	for _, topic := range topicNames(config.GenesisHash, transactionsTopic, config.WireVersions) {
+		topics[topic] = topicScoreParams(0.5)
+	}
+	for _, topic := range topicNames(config.GenesisHash, blocksTopic, config.WireVersions) {
+		topics[topic] = topicScoreParams(1)
+	}
+	for _, topic := range topicNames(config.GenesisHash, compactBlocksTopic, config.WireVersions) {
+		topics[topic] = topicScoreParams(1)
+	}
+
+	return &pubsub.PeerScoreParams{
+		Topics:        topics,
+		TopicScoreCap: 100,
+
+		AppSpecificScore: func(id peer.ID) float64 {
+			return -misbehaviour.Penalty(id)
+		},
+		AppSpecificWeight: misbehaviourWeight,
+
+		IPColocationFactorWeight:    -10,
+		IPColocationFactorThreshold: 10,
+
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(10 * time.Minute),
+
+		DecayInterval: pubsub.DefaultDecayInterval,
+		DecayToZero:   pubsub.DefaultDecayToZero,
+		RetainScore:   time.Hour,
+	}
+}
+
+func topicScoreParams(weight float64) *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight: weight,
+
+		TimeInMeshWeight:  0.01,
+		TimeInMeshQuantum: time.Second,
+		TimeInMeshCap:     300,
+
+		FirstMessageDeliveriesWeight: 1,
+		FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(10 * time.Minute),
+		FirstMessageDeliveriesCap:    50,
+
+		// Message rates follow user traffic, so a quiet mesh peer isn't penalised for under-delivering
+		MeshMessageDeliveriesWeight: 0,
+		MeshFailurePenaltyWeight:    0,
+
+		InvalidMessageDeliveriesWeight: -100,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+func peerScoreThresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -500,
+		PublishThreshold:            -1000,
+		GraylistThreshold:           -2500,
+		AcceptPXThreshold:           10,
+		OpportunisticGraftThreshold: 5,
+	}
+}
+
+func (n *Node) updateScores(scores map[peer.ID]float64) {
+	n.scoresLock.Lock()
+	defer n.scoresLock.Unlock()
+	n.scores = scores
+}
+
+// PeerScores returns the latest gossipsub scores
+func (n *Node) PeerScores() map[peer.ID]float64 {
+	n.scoresLock.RLock()
+	defer n.scoresLock.RUnlock()
+
+	scores := make(map[peer.ID]float64, len(n.scores))
+	for id, score := range n.scores {
+		scores[id] = score
+	}
+	return scores
+}
+
+// PeerReport is the admin view of peer behaviour
+type PeerReport struct {
+	Scores    map[peer.ID]float64 `json:"scores"`
+	Penalties map[peer.ID]float64 `json:"penalties"`
+	Bans      []Ban               `json:"bans"`
+	// Mesh lists the peers we forward gossip to, by topic
+	Mesh map[string][]peer.ID `json:"mesh"`
+}
+
+func (n *Node) PeerReport() PeerReport {
+	return PeerReport{
+		Scores:    n.PeerScores(),
+		Penalties: n.misbehaviour.Penalties(),
+		Bans:      n.bans.All(),
+		Mesh:      n.mesh.peers(),
+	}
+}
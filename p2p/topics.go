@@ -0,0 +1,145 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"minchain/core/types"
+	"minchain/tracing"
+)
+
+const (
+	transactionsTopic  = "transactions"
+	blocksTopic        = "blocks"
+	compactBlocksTopic = "compactblocks"
+
+	// CurrentWireVersion is the newest gossip wire format this node speaks
+	CurrentWireVersion = 3
+)
+
+// wireEncoding is how transactions and blocks are serialized on a given wire version
+type wireEncoding interface {
+	EncodeTransaction(tx *types.Tx) ([]byte, error)
+	DecodeTransaction(data []byte) (*types.Tx, error)
+	EncodeBlock(block *types.Block) ([]byte, error)
+	DecodeBlock(data []byte) (*types.Block, error)
+	EncodeCompactBlock(block *types.CompactBlock) ([]byte, error)
+	DecodeCompactBlock(data []byte) (*types.CompactBlock, error)
+}
+
+var wireEncodings = map[int]wireEncoding{
+	1: jsonEncoding{},
+	2: binaryEncoding{},
+	// Version 3 adds metadata, which carries the trace context between nodes
+	3: envelopeEncoding{payload: binaryEncoding{}},
+}
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) EncodeTransaction(tx *types.Tx) ([]byte, error) {
+	return tx.ToJson()
+}
+
+func (jsonEncoding) DecodeTransaction(data []byte) (*types.Tx, error) {
+	return types.TransactionFromJSON(data)
+}
+
+func (jsonEncoding) EncodeBlock(block *types.Block) ([]byte, error) {
+	return block.ToJson()
+}
+
+func (jsonEncoding) DecodeBlock(data []byte) (*types.Block, error) {
+	return types.BlockFromJson(data)
+}
+
+func (jsonEncoding) EncodeCompactBlock(block *types.CompactBlock) ([]byte, error) {
+	return block.ToJson()
+}
+
+func (jsonEncoding) DecodeCompactBlock(data []byte) (*types.CompactBlock, error) {
+	return types.CompactBlockFromJson(data)
+}
+
+type binaryEncoding struct{}
+
+func (binaryEncoding) EncodeTransaction(tx *types.Tx) ([]byte, error) {
+	return tx.ToBinary()
+}
+
+func (binaryEncoding) DecodeTransaction(data []byte) (*types.Tx, error) {
+	return types.TransactionFromBinary(data)
+}
+
+func (binaryEncoding) EncodeBlock(block *types.Block) ([]byte, error) {
+	return block.ToBinary()
+}
+
+func (binaryEncoding) DecodeBlock(data []byte) (*types.Block, error) {
+	return types.BlockFromBinary(data)
+}
+
+func (binaryEncoding) EncodeCompactBlock(block *types.CompactBlock) ([]byte, error) {
+	return block.ToBinary()
+}
+
+func (binaryEncoding) DecodeCompactBlock(data []byte) (*types.CompactBlock, error) {
+	return types.CompactBlockFromBinary(data)
+}
+
+// topicName scopes a topic to one chain and wire version, e.g. /minchain/0x12ab.../blocks/1,
+// so unrelated networks on the same LAN never share topics
+func topicName(genesisHash common.Hash, kind string, version int) string {
+	return fmt.Sprintf("/minchain/%s/%s/%d", genesisHash.Hex(), kind, version)
+}
+
+// versionedTopic is a joined gossip topic of one kind (transactions or blocks) on one wire version.
+// During a wire format upgrade a node subscribes to both the old and the new version.
+type versionedTopic struct {
+	kind         string
+	version      int
+	encoding     wireEncoding
+	topic        *pubsub.Topic
+	subscription *pubsub.Subscription
+}
+
+// encode serializes a message for the topic. On wire versions with metadata the trace context of ctx goes along.
+func (t *versionedTopic) encode(ctx context.Context, encode func(encoding wireEncoding) ([]byte, error)) ([]byte, error) {
+	envelope, ok := t.encoding.(envelopeEncoding)
+	if !ok {
+		return encode(t.encoding)
+	}
+
+	payload, err := encode(envelope.payload)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	tracing.Inject(ctx, metadata)
+	return sealEnvelope(metadata, payload)
+}
+
+// label names the topic in metrics, without the chain scope, e.g. blocks/2
+func (t *versionedTopic) label() string {
+	return fmt.Sprintf("%s/%d", t.kind, t.version)
+}
+
+func checkWireVersions(versions []int) error {
+	if len(versions) == 0 {
+		return fmt.Errorf("no gossip wire versions configured")
+	}
+	for _, version := range versions {
+		if _, ok := wireEncodings[version]; !ok {
+			return fmt.Errorf("unsupported gossip wire version %d", version)
+		}
+	}
+	return nil
+}
+
+func topicNames(genesisHash common.Hash, kind string, versions []int) []string {
+	names := make([]string, 0, len(versions))
+	for _, version := range versions {
+		names = append(names, topicName(genesisHash, kind, version))
+	}
+	return names
+}
@@ -0,0 +1,108 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/lib"
+	"testing"
+	"time"
+)
+
+func TestMixedWireVersions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A node which hasn't upgraded yet and one in the middle of the upgrade share version 2
+	old := gossipTestNode(t, ctx, common.Hash{1}, []int{2})
+	upgrading := gossipTestNode(t, ctx, common.Hash{1}, []int{2, 3})
+	connectNodes(t, ctx, old, upgrading)
+	waitForMesh(t, old, upgrading, topicName(common.Hash{1}, transactionsTopic, 2), topicName(common.Hash{1}, blocksTopic, 2))
+
+	for _, nodes := range [][2]*Node{{old, upgrading}, {upgrading, old}} {
+		sender, receiver := nodes[0], nodes[1]
+		tx := &types.Tx{From: "0x01", Data: fmt.Sprintf("from %s", sender.Hostname()), Signature: make([]byte, 65)}
+		block := &types.Block{Header: types.BlockHeader{ParentHash: common.Hash{1}, Height: 1, Extra: []byte(sender.Hostname())}}
+		require.NoError(t, sender.Publisher.PublishTransaction(ctx, tx))
+		require.NoError(t, sender.Publisher.PublishBlock(ctx, block))
+
+		receiveTransaction(t, ctx, receiver, tx)
+		receiveBlock(t, ctx, receiver, block)
+	}
+}
+
+func TestGossipStaysOnItsChain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender := gossipTestNode(t, ctx, common.Hash{1}, []int{CurrentWireVersion})
+	sameChain := gossipTestNode(t, ctx, common.Hash{1}, []int{CurrentWireVersion})
+	otherChain := gossipTestNode(t, ctx, common.Hash{2}, []int{CurrentWireVersion})
+	connectNodes(t, ctx, sender, sameChain)
+	waitForMesh(t, sender, sameChain, topicName(common.Hash{1}, transactionsTopic, CurrentWireVersion))
+	require.NoError(t, otherChain.p2pHost.Connect(ctx, peer.AddrInfo{ID: sender.p2pHost.ID(), Addrs: sender.p2pHost.Addrs()}))
+
+	// Once a node of the same chain has the transaction, the other chain would have had it too
+	tx := &types.Tx{From: "0x01", Data: "chain 1", Signature: make([]byte, 65)}
+	require.NoError(t, sender.Publisher.PublishTransaction(ctx, tx))
+	receiveTransaction(t, ctx, sameChain, tx)
+
+	consumeCtx, cancelConsume := context.WithTimeout(ctx, time.Second)
+	defer cancelConsume()
+	_, received, err := otherChain.Consumer.ConsumeTransaction(consumeCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "received %v", received)
+}
+
+func gossipTestNode(t *testing.T, ctx context.Context, genesisHash common.Hash, versions []int) *Node {
+	config := lib.Config{
+		DataDir:      t.TempDir(),
+		ChainID:      1,
+		GenesisHash:  genesisHash,
+		WireVersions: versions,
+	}
+	node, err := InitNode(ctx, config, database.NewMemoryDatabase(), nil, lib.NewSystemClock(), MessageValidators{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = node.p2pHost.Close() })
+	return node
+}
+
+// waitForMesh waits until both nodes forward the topics to each other
+func waitForMesh(t *testing.T, a *Node, b *Node, topics ...string) {
+	require.Eventually(t, func() bool {
+		for _, topic := range topics {
+			if !a.mesh.inMesh(topic, b.p2pHost.ID()) || !b.mesh.inMesh(topic, a.p2pHost.ID()) {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+// receiveTransaction skips what the node published itself until the expected transaction arrives
+func receiveTransaction(t *testing.T, ctx context.Context, node *Node, expected *types.Tx) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for {
+		_, tx, err := node.Consumer.ConsumeTransaction(ctx)
+		require.NoError(t, err)
+		if tx.Data == expected.Data {
+			return
+		}
+	}
+}
+
+func receiveBlock(t *testing.T, ctx context.Context, node *Node, expected *types.Block) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for {
+		_, block, err := node.Consumer.ConsumeBlock(ctx)
+		require.NoError(t, err)
+		if block.BlockHash() == expected.BlockHash() {
+			return
+		}
+	}
+}
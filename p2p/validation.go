@@ -0,0 +1,116 @@
+package p2p
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"minchain/core/types"
+)
+
+const (
+	maxTransactionSize = 64 << 10
+	maxBlockSize       = pubsub.DefaultMaxMessageSize
+)
+
+// MessageValidators run the stateless checks on gossiped messages, before they're delivered to us or relayed
+// to other peers. Invalid messages are rejected, which lowers the sender's gossipsub peer score.
+type MessageValidators struct {
+	Transaction func(tx *types.Tx) bool
+	Block       func(block *types.Block) error
+}
+
+func (n *Node) validateTransaction(encoding wireEncoding, isValid func(tx *types.Tx) bool) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if result, ok := n.checkSender(from); !ok {
+			return result
+		}
+
+		if len(msg.Data) > maxTransactionSize {
+			logger.Warn("Rejecting oversized transaction", "peer", from, "size", len(msg.Data))
+			n.penalise(from, invalidTransactionPenalty, "oversized transaction")
+			return pubsub.ValidationReject
+		}
+
+		tx, err := encoding.DecodeTransaction(msg.Data)
+		if err != nil {
+			logger.Warn("Rejecting undecodable transaction", "peer", from, "err", err)
+			n.penalise(from, invalidTransactionPenalty, "undecodable transaction")
+			return pubsub.ValidationReject
+		}
+
+		hash, _ := tx.Hash()
+		if isValid != nil && !isValid(tx) {
+			logger.Warn("Rejecting invalid transaction", "hash", hash, "peer", from)
+			n.penalise(from, invalidTransactionPenalty, "invalid transaction "+hash.Hex())
+			return pubsub.ValidationReject
+		}
+
+		n.recordSource(hash, from)
+		// Saves the consumer from decoding the message again
+		msg.ValidatorData = tx
+		return pubsub.ValidationAccept
+	}
+}
+
+func (n *Node) validateBlock(encoding wireEncoding, validate func(block *types.Block) error) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if result, ok := n.checkSender(from); !ok {
+			return result
+		}
+
+		if len(msg.Data) > maxBlockSize {
+			logger.Warn("Rejecting oversized block", "peer", from, "size", len(msg.Data))
+			n.penalise(from, invalidBlockPenalty, "oversized block")
+			return pubsub.ValidationReject
+		}
+
+		block, err := encoding.DecodeBlock(msg.Data)
+		if err != nil {
+			logger.Warn("Rejecting undecodable block", "peer", from, "err", err)
+			n.penalise(from, invalidBlockPenalty, "undecodable block")
+			return pubsub.ValidationReject
+		}
+
+		if validate != nil {
+			if err := validate(block); err != nil {
+				logger.Warn("Rejecting invalid block", "hash", block.BlockHash(), "peer", from, "err", err)
+				n.penalise(from, invalidBlockPenalty, "invalid block "+block.BlockHash().Hex())
+				return pubsub.ValidationReject
+			}
+		}
+
+		n.recordSource(block.BlockHash(), from)
+		n.updateHead(from, block)
+		msg.ValidatorData = block
+		return pubsub.ValidationAccept
+	}
+}
+
+// checkSender ignores messages relayed by peers which haven't completed the handshake yet.
+// They aren't penalised, we just don't know whether they're on our chain.
+func (n *Node) checkSender(from peer.ID) (pubsub.ValidationResult, bool) {
+	if from == n.p2pHost.ID() || n.Peers.IsCompatible(from, "") {
+		return pubsub.ValidationAccept, true
+	}
+	return pubsub.ValidationIgnore, false
+}
+
+func (n *Node) penalise(from peer.ID, points float64, reason string) {
+	if n.misbehaviour != nil && from != n.p2pHost.ID() {
+		n.misbehaviour.Penalise(from, points, reason)
+	}
+}
+
+// updateHead notes that the peer which relayed a valid block has it
+func (n *Node) updateHead(from peer.ID, block *types.Block) {
+	if from != n.p2pHost.ID() {
+		n.Peers.UpdateHead(from, block.BlockHash(), block.Header.Height)
+	}
+}
+
+func (n *Node) recordSource(hash common.Hash, from peer.ID) {
+	if n.misbehaviour != nil {
+		n.misbehaviour.recordSource(hash, from)
+	}
+}
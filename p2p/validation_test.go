@@ -0,0 +1,68 @@
+package p2p
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"minchain/core/types"
+	"minchain/lib"
+	"testing"
+)
+
+func TestValidateTransaction(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+
+	node := &Node{p2pHost: h, Peers: NewPeerStatuses(lib.NewSystemClock())}
+	compatible := peer.ID("compatible")
+	node.Peers.accept(compatible, Status{})
+
+	validate := node.validateTransaction(jsonEncoding{}, func(tx *types.Tx) bool {
+		return len(tx.Signature) == 65
+	})
+	message := func(data []byte) *pubsub.Message {
+		return &pubsub.Message{Message: &pb.Message{Data: data}}
+	}
+
+	pk, _ := crypto.GenerateKey()
+	tx := &types.Tx{From: crypto.PubkeyToAddress(pk.PublicKey).Hex(), Data: "hello", Signature: make([]byte, 65)}
+	txJson, _ := tx.ToJson()
+
+	valid := message(txJson)
+	require.Equal(t, pubsub.ValidationAccept, validate(context.Background(), compatible, valid))
+	require.Equal(t, tx.Data, valid.ValidatorData.(*types.Tx).Data)
+
+	require.Equal(t, pubsub.ValidationReject, validate(context.Background(), compatible, message([]byte("{garbage"))))
+
+	tx.Signature = []byte{1}
+	badSig, _ := tx.ToJson()
+	require.Equal(t, pubsub.ValidationReject, validate(context.Background(), compatible, message(badSig)))
+
+	require.Equal(t, pubsub.ValidationIgnore, validate(context.Background(), peer.ID("stranger"), message(txJson)))
+}
+
+func TestValidateBlockMovesPeerHead(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+
+	node := &Node{p2pHost: h, Peers: NewPeerStatuses(lib.NewSystemClock())}
+	relay := peer.ID("relay")
+	node.Peers.accept(relay, Status{HeadHeight: 1})
+
+	// The relay moves ahead of the head it reported in the handshake
+	block := &types.Block{Header: types.BlockHeader{Height: 4}}
+	data, err := jsonEncoding{}.EncodeBlock(block)
+	require.NoError(t, err)
+	validate := node.validateBlock(jsonEncoding{}, nil)
+	require.Equal(t, pubsub.ValidationAccept, validate(context.Background(), relay, &pubsub.Message{Message: &pb.Message{Data: data}}))
+
+	status, _ := node.Peers.Get(relay)
+	require.Equal(t, int64(4), status.HeadHeight)
+	require.Equal(t, block.BlockHash(), status.HeadHash)
+}
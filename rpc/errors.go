@@ -0,0 +1,34 @@
+package rpc
+
+import "fmt"
+
+// Standard JSON-RPC 2.0 error codes, -32000 to -32099 are left for the methods
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeLimitExceeded is for requests over a per-client limit, e.g. too many subscriptions or
+	// transaction submissions
+	CodeLimitExceeded = -32005
+)
+
+// Error is returned to the client as is when a method returns it, any other error becomes an internal error
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func InvalidParams(message string) *Error {
+	return NewError(CodeInvalidParams, message)
+}
@@ -0,0 +1,168 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"sync"
+	"time"
+)
+
+const (
+	// sendBuffer is how many replies and notifications a client may fall behind before it's disconnected
+	sendBuffer   = 256
+	writeTimeout = 10 * time.Second
+	// NotificationMethod is the method of the messages pushed to subscribers
+	NotificationMethod = "subscription"
+	// MaxSubscriptions bounds what a single connection costs the node, every subscription runs its own goroutine
+	MaxSubscriptions = 32
+)
+
+var (
+	ErrorSlowConsumer             = errors.New("client too slow, disconnected")
+	ErrorConnectionClosed         = errors.New("connection closed")
+	ErrorNotificationsUnsupported = errors.New("notifications need a websocket connection")
+)
+
+type connection struct {
+	ws        *websocket.Conn
+	send      chan []byte
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+func newConnection(ws *websocket.Conn, cancel context.CancelFunc) *connection {
+	return &connection{
+		ws:     ws,
+		send:   make(chan []byte, sendBuffer),
+		cancel: cancel,
+	}
+}
+
+func (c *connection) writeLoop(ctx context.Context) {
+	defer c.close()
+	for {
+		select {
+		case message := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *connection) close() {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		_ = c.ws.Close()
+	})
+}
+
+// Notifier pushes subscription notifications to a WebSocket client
+type Notifier struct {
+	conn          *connection
+	lock          sync.Mutex
+	nextID        uint64
+	subscriptions map[string]context.CancelFunc
+	// pending subscriptions start once the reply with their ID is queued, so it reaches the client first
+	pending []func()
+}
+
+type notifierKey struct{}
+
+func newNotifier(conn *connection) *Notifier {
+	return &Notifier{
+		conn:          conn,
+		subscriptions: make(map[string]context.CancelFunc),
+	}
+}
+
+func withNotifier(ctx context.Context, notifier *Notifier) context.Context {
+	return context.WithValue(ctx, notifierKey{}, notifier)
+}
+
+// NotifierFromContext returns the notifier of the connection the request came on, there's none over HTTP
+func NotifierFromContext(ctx context.Context) (*Notifier, error) {
+	notifier, ok := ctx.Value(notifierKey{}).(*Notifier)
+	if !ok {
+		return nil, ErrorNotificationsUnsupported
+	}
+	return notifier, nil
+}
+
+// Subscribe runs fn until the client unsubscribes or disconnects and returns the subscription ID. fn sends its
+// notifications with notify. Connections with MaxSubscriptions already get an rpc error.
+func (n *Notifier) Subscribe(ctx context.Context, fn func(ctx context.Context, notify func(result interface{}) error)) (string, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if len(n.subscriptions) >= MaxSubscriptions {
+		return "", NewError(CodeLimitExceeded, fmt.Sprintf("at most %d subscriptions per connection", MaxSubscriptions))
+	}
+
+	n.nextID++
+	id := fmt.Sprintf("0x%x", n.nextID)
+	ctx, cancel := context.WithCancel(ctx)
+	n.subscriptions[id] = cancel
+	n.pending = append(n.pending, func() {
+		defer n.Unsubscribe(id)
+		fn(ctx, func(result interface{}) error {
+			return n.notify(id, result)
+		})
+	})
+	return id, nil
+}
+
+func (n *Notifier) activate() {
+	n.lock.Lock()
+	pending := n.pending
+	n.pending = nil
+	n.lock.Unlock()
+
+	for _, run := range pending {
+		go run()
+	}
+}
+
+func (n *Notifier) Unsubscribe(id string) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	cancel, ok := n.subscriptions[id]
+	if ok {
+		cancel()
+		delete(n.subscriptions, id)
+	}
+	return ok
+}
+
+// Disconnect drops the client, e.g. because it missed events it can't get back
+func (n *Notifier) Disconnect() {
+	n.conn.close()
+}
+
+type notification struct {
+	Version string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  notificationParams `json:"params"`
+}
+
+type notificationParams struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+// notify never blocks, a client which doesn't read its notifications fast enough is disconnected
+func (n *Notifier) notify(id string, result interface{}) error {
+	message := encode(notification{Version: version, Method: NotificationMethod, Params: notificationParams{Subscription: id, Result: result}})
+	select {
+	case n.conn.send <- message:
+		return nil
+	default:
+		n.conn.close()
+		return ErrorSlowConsumer
+	}
+}
@@ -0,0 +1,281 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"minchain/logging"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var logger = logging.Logger(logging.Api)
+
+const (
+	version        = "2.0"
+	maxRequestSize = 1024 * 1024
+	maxBatchSize   = 100
+)
+
+// Handler runs a method. Params are the raw JSON params, nil when the request has none.
+type Handler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// Server dispatches JSON-RPC 2.0 requests to registered methods, over HTTP POST and WebSocket
+type Server struct {
+	lock     sync.RWMutex
+	methods  map[string]Handler
+	upgrader websocket.Upgrader
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func NewServer() *Server {
+	return &Server{
+		methods: make(map[string]Handler),
+	}
+}
+
+// Register adds the methods of a namespace, they're called as namespace_method
+func (s *Server) Register(namespace string, methods map[string]Handler) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name := range methods {
+		if _, ok := s.methods[namespace+"_"+name]; ok {
+			return fmt.Errorf("method %s_%s already registered", namespace, name)
+		}
+	}
+	for name, handler := range methods {
+		s.methods[namespace+"_"+name] = handler
+	}
+	return nil
+}
+
+// Methods lists the registered method names
+func (s *Server) Methods() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	reply := s.Handle(r.Context(), body)
+	if reply == nil {
+		// Only notifications, nothing to answer
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(reply); err != nil {
+		logger.Warn("Error writing the response", "err", err)
+	}
+}
+
+// serveWebSocket answers requests in order. Methods can push notifications to the connection, see Notifier.
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Info("WebSocket upgrade failed", "err", err)
+		return
+	}
+	ws.SetReadLimit(maxRequestSize)
+
+	// The request context ends with the upgrade handler, the connection lives until either side closes it
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := newConnection(ws, cancel)
+	defer conn.close()
+	go conn.writeLoop(ctx)
+
+	notifier := newNotifier(conn)
+	ctx = withNotifier(ctx, notifier)
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		reply := s.Handle(ctx, message)
+		if reply != nil {
+			// Replies wait for room in the buffer, only notifications get a slow client disconnected
+			select {
+			case conn.send <- reply:
+			case <-ctx.Done():
+				return
+			}
+		}
+		notifier.activate()
+	}
+}
+
+// Handle answers a single request or a batch, it returns nil when there's nothing to answer
+func (s *Server) Handle(ctx context.Context, body []byte) []byte {
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		return encode(errorResponse(nil, NewError(CodeParseError, "parse error")))
+	}
+	if body[0] == '[' {
+		return s.handleBatch(ctx, body)
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return encode(errorResponse(nil, NewError(CodeInvalidRequest, "invalid request")))
+	}
+	resp := s.call(ctx, req)
+	if resp == nil {
+		return nil
+	}
+	return encode(resp)
+}
+
+func (s *Server) handleBatch(ctx context.Context, body []byte) []byte {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return encode(errorResponse(nil, NewError(CodeInvalidRequest, "invalid request")))
+	}
+	if len(batch) == 0 {
+		return encode(errorResponse(nil, NewError(CodeInvalidRequest, "empty batch")))
+	}
+	if len(batch) > maxBatchSize {
+		return encode(errorResponse(nil, NewError(CodeInvalidRequest, fmt.Sprintf("batch larger than %d", maxBatchSize))))
+	}
+
+	responses := make([]*response, 0, len(batch))
+	for _, raw := range batch {
+		var req request
+		if err := json.Unmarshal(raw, &req); err != nil {
+			responses = append(responses, errorResponse(nil, NewError(CodeInvalidRequest, "invalid request")))
+			continue
+		}
+		if resp := s.call(ctx, req); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return encode(responses)
+}
+
+// call runs the method, notifications (requests without an id) get no response even when they fail
+func (s *Server) call(ctx context.Context, req request) *response {
+	notification := len(req.ID) == 0
+	if req.Version != version || req.Method == "" || !validID(req.ID) {
+		return errorResponse(req.ID, NewError(CodeInvalidRequest, "invalid request"))
+	}
+
+	s.lock.RLock()
+	handler, ok := s.methods[req.Method]
+	s.lock.RUnlock()
+
+	if !ok {
+		if notification {
+			return nil
+		}
+		return errorResponse(req.ID, NewError(CodeMethodNotFound, "method not found: "+req.Method))
+	}
+
+	result, err := handler(ctx, req.Params)
+	if notification {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			logger.Error("Method failed", "method", req.Method, "err", err)
+			rpcErr = NewError(CodeInternalError, err.Error())
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+	if result == nil {
+		// A successful response must have a result, null is fine
+		result = json.RawMessage("null")
+	}
+	return &response{Version: version, ID: req.ID, Result: result}
+}
+
+// validID accepts what the spec allows for an id: a string, a number, null or nothing
+func validID(id json.RawMessage) bool {
+	if len(id) == 0 {
+		return true
+	}
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &response{Version: version, ID: id, Error: err}
+}
+
+func encode(value interface{}) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		// Results are plain data, so this is a bug in a method
+		logger.Error("Error encoding the response", "err", err)
+		data, _ = json.Marshal(errorResponse(nil, NewError(CodeInternalError, "encoding error")))
+	}
+	return data
+}
+
+// ParseParams decodes positional params into the targets, one param per target
+func ParseParams(params json.RawMessage, targets ...interface{}) error {
+	var values []json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &values); err != nil {
+			return InvalidParams("params must be an array")
+		}
+	}
+	if len(values) != len(targets) {
+		return InvalidParams(fmt.Sprintf("expected %d params, got %d", len(targets), len(values)))
+	}
+	for i, value := range values {
+		if err := json.Unmarshal(value, targets[i]); err != nil {
+			return InvalidParams(fmt.Sprintf("param %d: %s", i, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testServer(t *testing.T) *Server {
+	server := NewServer()
+	require.NoError(t, server.Register("test", map[string]Handler{
+		"echo": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			var value string
+			if err := ParseParams(params, &value); err != nil {
+				return nil, err
+			}
+			return value, nil
+		},
+		"fail": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+		"notFound": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			return nil, NewError(-32001, "not found")
+		},
+	}))
+	return server
+}
+
+func TestServer(t *testing.T) {
+	server := testServer(t)
+
+	tests := []struct {
+		name    string
+		request string
+		reply   string
+	}{
+		{"result", `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["hi"]}`, `{"jsonrpc":"2.0","id":1,"result":"hi"}`},
+		{"string id", `{"jsonrpc":"2.0","id":"a","method":"test_echo","params":["hi"]}`, `{"jsonrpc":"2.0","id":"a","result":"hi"}`},
+		{"parse error", `{"jsonrpc":`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`},
+		{"wrong version", `{"jsonrpc":"1.0","id":1,"method":"test_echo"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"invalid request"}}`},
+		{"not an object", `1`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"test_nope"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found: test_nope"}}`},
+		{"invalid params", `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":[1]}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"param 0: json: cannot unmarshal number into Go value of type string"}}`},
+		{"missing params", `{"jsonrpc":"2.0","id":1,"method":"test_echo"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"expected 1 params, got 0"}}`},
+		{"internal error", `{"jsonrpc":"2.0","id":1,"method":"test_fail"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"boom"}}`},
+		{"method error", `{"jsonrpc":"2.0","id":1,"method":"test_notFound"}`, `{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"not found"}}`},
+		{"empty batch", `[]`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"empty batch"}}`},
+		{"batch", `[{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["a"]},{"jsonrpc":"2.0","method":"test_echo","params":["b"]},1,{"jsonrpc":"2.0","id":2,"method":"test_fail"}]`,
+			`[{"jsonrpc":"2.0","id":1,"result":"a"},{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}},{"jsonrpc":"2.0","id":2,"error":{"code":-32603,"message":"boom"}}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.JSONEq(t, test.reply, string(server.Handle(context.Background(), []byte(test.request))))
+		})
+	}
+
+	// Notifications are never answered
+	require.Nil(t, server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"test_fail"}`)))
+	require.Nil(t, server.Handle(context.Background(), []byte(`[{"jsonrpc":"2.0","method":"test_echo","params":["a"]}]`)))
+}
+
+func TestServerRegistry(t *testing.T) {
+	server := testServer(t)
+	require.Error(t, server.Register("test", map[string]Handler{"echo": nil}))
+	require.NoError(t, server.Register("other", map[string]Handler{"echo": nil}))
+	require.Equal(t, []string{"other_echo", "test_echo", "test_fail", "test_notFound"}, server.Methods())
+}
+
+func TestServerTransports(t *testing.T) {
+	httpServer := httptest.NewServer(testServer(t))
+	defer httpServer.Close()
+
+	response, err := http.Post(httpServer.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["http"]}`))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	var reply struct{ Result string }
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&reply))
+	require.Equal(t, "http", reply.Result)
+
+	response, err = http.Post(httpServer.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"test_echo","params":["http"]}`))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["ws"]}`)))
+	require.NoError(t, conn.ReadJSON(&reply))
+	require.Equal(t, "ws", reply.Result)
+}
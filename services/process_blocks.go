@@ -2,63 +2,159 @@ package services
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"minchain/core"
+	"minchain/core/types"
 	"minchain/database"
+	"minchain/lib"
+	"minchain/logging"
+	"minchain/metrics"
 	"minchain/p2p"
+	"minchain/tracing"
 	"minchain/validator"
 )
 
+var (
+	blocksLogger = logging.Logger(logging.Chain)
+	blocksTracer = tracing.Tracer(logging.Chain)
+)
+
 type ProcessBlocks struct {
 	blockValidator validator.Validator
 	database       database.Database
 	mempool        core.Mempool
 	consumer       p2p.Consumer
+	reporter       p2p.Reporter
+	clock          lib.Clock
+	events         *core.EventBus
 }
 
-func NewProcessBlocksService(blockValidator validator.Validator, database database.Database, mempool core.Mempool, consumer p2p.Consumer) *ProcessBlocks {
+func NewProcessBlocksService(blockValidator validator.Validator, database database.Database, mempool core.Mempool, consumer p2p.Consumer, reporter p2p.Reporter, clock lib.Clock, events *core.EventBus) *ProcessBlocks {
 	return &ProcessBlocks{
 		blockValidator: blockValidator,
 		database:       database,
 		mempool:        mempool,
 		consumer:       consumer,
+		reporter:       reporter,
+		clock:          clock,
+		events:         events,
 	}
 }
 
 func (p *ProcessBlocks) Start(ctx context.Context) {
+	p.initHeadHeight()
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("context cancelled, stopping processing blocks")
+				blocksLogger.Info("Stopping block processing")
 				return
 			default:
-				block, err := p.consumer.ConsumeBlock(ctx)
+				msgCtx, block, err := p.consumer.ConsumeBlock(ctx)
 				if err != nil {
 					return
 				}
-				err = p.blockValidator.Validate(block)
-				if err != nil {
-					log.Println("validator error ", err)
-					continue
-				}
-
-				log.Println("Valid block becomes new head", block.BlockHash().Hex())
-				err = p.database.PutBlock(block)
-				if err != nil {
-					log.Println("Validator.PutBlock ", err)
-				}
-
-				err = p.database.SetHead(block.BlockHash())
-				if err != nil {
-					log.Println("Validator.SetHead ", err)
+				if err := p.importBlock(msgCtx, block); err != nil {
+					blocksLogger.Error("Stopping block processing", "err", err)
 					return
 				}
-				p.mempool.PruneTransactions(block.Transactions)
-
-				blockchainHashes, err := core.PrintBlockHashes(p.database)
-				log.Println("Block added. New blockchain:", blockchainHashes)
 			}
 		}
 	}()
 }
+
+// importBlock validates and stores a block from the network, continuing the trace of the node which produced it.
+// Invalid blocks are only reported, the error is for failures which leave the chain in an unknown state.
+func (p *ProcessBlocks) importBlock(ctx context.Context, block *types.Block) error {
+	received := p.clock.Now()
+	ctx, span := blocksTracer.Start(ctx, "block.import", trace.WithSpanKind(trace.SpanKindConsumer))
+	span.SetAttributes(attribute.String("block.hash", block.BlockHash().Hex()), attribute.Int64("block.height", block.Header.Height))
+	defer span.End()
+
+	err := p.blockValidator.Validate(ctx, block)
+	if err != nil {
+		reason := validator.Reason(err)
+		span.SetAttributes(attribute.String("block.rejected", reason))
+		// Known blocks are just duplicates, e.g. our own blocks coming back
+		if errors.Is(err, validator.ErrorKnownBlock) {
+			blocksLogger.Debug("Skipping known block", "hash", block.BlockHash())
+			return nil
+		}
+		metrics.BlocksRejected.WithLabelValues(reason).Inc()
+		span.SetStatus(codes.Error, err.Error())
+		// The peer which relayed it may well be right, e.g. when we're behind or our clock is late
+		if !validator.IsInvalid(err) {
+			blocksLogger.Info("Dropping block", "hash", block.BlockHash(), "reason", reason, "err", err)
+			return nil
+		}
+		blocksLogger.Warn("Block rejected", "hash", block.BlockHash(), "reason", reason, "err", err)
+		p.reporter.ReportInvalidBlock(block.BlockHash(), err)
+		return nil
+	}
+
+	err = p.database.PutBlock(block)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		blocksLogger.Error("Error storing block", "hash", block.BlockHash(), "err", err)
+		return nil
+	}
+	p.events.BlockImported.Publish(core.BlockImported{Block: block})
+
+	previousHead, err := p.database.GetHead()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("reading the head: %w", err)
+	}
+
+	err = p.database.SetHead(block.BlockHash())
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("setting the head to %s: %w", block.BlockHash(), err)
+	}
+	p.mempool.PruneTransactions(block.Transactions)
+	metrics.BlocksImported.Inc()
+	metrics.HeadHeight.Set(float64(block.Header.Height))
+	metrics.BlockImportDuration.Observe(p.clock.Since(received).Seconds())
+	blocksLogger.Info("Block imported", "hash", block.BlockHash(), "height", block.Header.Height, "txs", len(block.Transactions))
+	p.publishHeadChange(previousHead, block)
+
+	// Walks the whole chain, so only when it's going to be logged
+	if blocksLogger.Enabled(ctx, slog.LevelDebug) {
+		blockchainHashes, _ := core.PrintBlockHashes(p.database)
+		blocksLogger.Debug("New chain", "hashes", blockchainHashes)
+	}
+	return nil
+}
+
+// publishHeadChange announces the new head, preceded by a reorg when it doesn't build on the previous head
+func (p *ProcessBlocks) publishHeadChange(previousHead common.Hash, block *types.Block) {
+	if block.Header.ParentHash != previousHead {
+		reorg, err := core.NewReorg(p.database, previousHead, block.BlockHash())
+		if err != nil {
+			blocksLogger.Error("Error finding the reorg", "err", err)
+		} else {
+			blocksLogger.Warn("Reorg", "depth", reorg.Depth, "from", previousHead, "to", block.BlockHash())
+			p.events.Reorg.Publish(reorg)
+		}
+	}
+	p.events.HeadChanged.Publish(core.HeadChanged{Block: block})
+}
+
+// initHeadHeight reports the head the node starts from, before any block was imported
+func (p *ProcessBlocks) initHeadHeight() {
+	head, err := p.database.GetHead()
+	if err != nil {
+		return
+	}
+	block, err := p.database.GetBlockByHash(head)
+	if err != nil {
+		return
+	}
+	metrics.HeadHeight.Set(float64(block.Header.Height))
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"minchain/core"
+	"minchain/core/chaintest"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/genesis"
+	"minchain/lib"
+	"minchain/metrics"
+	"minchain/p2p"
+	"minchain/validator"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blocksConsumer struct {
+	blocks chan *types.Block
+}
+
+func (c *blocksConsumer) ConsumeTransaction(ctx context.Context) (context.Context, *types.Tx, error) {
+	<-ctx.Done()
+	return ctx, nil, ctx.Err()
+}
+
+func (c *blocksConsumer) ConsumeBlock(ctx context.Context) (context.Context, *types.Block, error) {
+	select {
+	case block := <-c.blocks:
+		return ctx, block, nil
+	case <-ctx.Done():
+		return ctx, nil, ctx.Err()
+	}
+}
+
+type recordingReporter struct {
+	lock   sync.Mutex
+	blocks []common.Hash
+}
+
+func (r *recordingReporter) ReportInvalidBlock(hash common.Hash, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.blocks = append(r.blocks, hash)
+}
+
+func (r *recordingReporter) ReportInvalidTransaction(common.Hash, error) {}
+
+func (r *recordingReporter) reported() []common.Hash {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]common.Hash(nil), r.blocks...)
+}
+
+func TestOnlyInvalidBlocksAreReported(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := database.NewMemoryDatabase()
+	chainGenesis := genesis.Default().Block()
+	require.NoError(t, db.PutBlock(chainGenesis))
+	require.NoError(t, db.SetHead(chainGenesis.BlockHash()))
+
+	blockTime := 5 * time.Second
+	clock := lib.NewManualClock(time.UnixMilli(chainGenesis.Header.Timestamp).Add(time.Minute))
+	events := core.NewEventBus()
+	consumer := &blocksConsumer{blocks: make(chan *types.Block)}
+	reporter := &recordingReporter{}
+	NewProcessBlocksService(validator.NewBlockValidator(db, blockTime, clock), db, core.NewMempool(events, db), consumer, reporter, clock, events).Start(ctx)
+
+	// We may just be behind the peer, or our clock may be late
+	orphan := childBlock(t, &types.Block{Header: types.BlockHeader{Height: 4}}, blockTime)
+	future := childBlock(t, chainGenesis, time.Hour)
+	consumer.blocks <- orphan
+	consumer.blocks <- future
+
+	// Invalid on any node
+	broken := childBlock(t, chainGenesis, blockTime)
+	broken.Header.TransactionHash = common.Hash{1}
+	consumer.blocks <- broken
+
+	require.Eventually(t, func() bool { return len(reporter.reported()) > 0 }, time.Second, time.Millisecond)
+	require.Equal(t, []common.Hash{broken.BlockHash()}, reporter.reported())
+}
+
+func TestImportMetrics(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	chainGenesis := genesis.Default().Block()
+	require.NoError(t, db.PutBlock(chainGenesis))
+	require.NoError(t, db.SetHead(chainGenesis.BlockHash()))
+
+	blockTime := 5 * time.Second
+	clock := lib.NewManualClock(time.UnixMilli(chainGenesis.Header.Timestamp).Add(time.Minute))
+	events := core.NewEventBus()
+	blocks := NewProcessBlocksService(validator.NewBlockValidator(db, blockTime, clock), db, core.NewMempool(events, db), nil, &recordingReporter{}, clock, events)
+
+	// The manual clock doesn't move during the import, so it takes no time
+	durations := func() (uint64, float64) {
+		var metric dto.Metric
+		require.NoError(t, metrics.BlockImportDuration.Write(&metric))
+		return metric.Histogram.GetSampleCount(), metric.Histogram.GetSampleSum()
+	}
+	count, sum := durations()
+	block := childBlock(t, chainGenesis, blockTime)
+	require.NoError(t, blocks.importBlock(context.Background(), block))
+	newCount, newSum := durations()
+	require.Equal(t, count+1, newCount)
+	require.Equal(t, sum, newSum)
+
+	// Our own blocks coming back aren't rejections
+	known := testutil.ToFloat64(metrics.BlocksRejected.WithLabelValues("known"))
+	require.NoError(t, blocks.importBlock(context.Background(), block))
+	require.Equal(t, known, testutil.ToFloat64(metrics.BlocksRejected.WithLabelValues("known")))
+}
+
+// spanRecorder is installed once, the tracers of the package stick to the first provider set
+var spanRecorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+})
+
+func TestImportContinuesSenderTrace(t *testing.T) {
+	recorder := spanRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainGenesis := genesis.Default()
+	config := func() lib.Config {
+		return lib.Config{
+			DataDir:       t.TempDir(),
+			ListeningPort: freePort(t),
+			ChainID:       chainGenesis.ChainID,
+			GenesisHash:   chainGenesis.Hash(),
+			WireVersions:  []int{lib.DefaultWireVersion},
+		}
+	}
+	genesisDb := func() database.Database {
+		db := database.NewMemoryDatabase()
+		require.NoError(t, db.PutBlock(chainGenesis.Block()))
+		require.NoError(t, db.SetHead(chainGenesis.Block().BlockHash()))
+		return db
+	}
+
+	senderConfig := config()
+	sender, err := p2p.InitNode(ctx, senderConfig, genesisDb(), nil, lib.NewSystemClock(), p2p.MessageValidators{})
+	require.NoError(t, err)
+
+	receiverConfig := config()
+	receiverConfig.BootstrapPeers = []string{fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/p2p/%s", senderConfig.ListeningPort, sender.Hostname())}
+	receiverDb := genesisDb()
+	receiver, err := p2p.InitNode(ctx, receiverConfig, receiverDb, nil, lib.NewSystemClock(), p2p.MessageValidators{})
+	require.NoError(t, err)
+	events := core.NewEventBus()
+	blockValidator := validator.NewBlockValidator(receiverDb, time.Duration(chainGenesis.BlockTime), lib.NewSystemClock())
+	NewProcessBlocksService(blockValidator, receiverDb, core.NewMempool(events, receiverDb), receiver.Consumer, receiver.Reporter, lib.NewSystemClock(), events).Start(ctx)
+
+	// Gossip only reaches the receiver once it's in the sender's mesh of every topic
+	receiverId, err := peer.Decode(receiver.Hostname())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		mesh := sender.PeerReport().Mesh
+		for _, peers := range mesh {
+			if !slices.Contains(peers, receiverId) {
+				return false
+			}
+		}
+		return len(mesh) == 3
+	}, 10*time.Second, 50*time.Millisecond)
+
+	produceCtx, produce := otel.Tracer("test").Start(ctx, "block.produce")
+	block := childBlock(t, chainGenesis.Block(), time.Duration(chainGenesis.BlockTime))
+	require.NoError(t, sender.Publisher.PublishBlock(produceCtx, block))
+	produce.End()
+
+	var imported sdktrace.ReadOnlySpan
+	require.Eventually(t, func() bool {
+		for _, span := range recorder.Ended() {
+			if span.Name() == "block.import" && span.SpanContext().TraceID() == produce.SpanContext().TraceID() {
+				imported = span
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, produce.SpanContext().SpanID(), imported.Parent().SpanID())
+	require.True(t, imported.Parent().IsRemote())
+}
+
+// freePort finds a port for a node to listen on
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func childBlock(t *testing.T, parent *types.Block, after time.Duration) *types.Block {
+	return chaintest.Block(t, parent, parent.Header.Timestamp+after.Milliseconds(), *chaintest.Tx(t, "hello"))
+}
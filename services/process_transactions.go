@@ -2,10 +2,21 @@ package services
 
 import (
 	"context"
-	"log"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"minchain/core"
+	"minchain/core/types"
 	"minchain/lib"
+	"minchain/logging"
 	"minchain/p2p"
+	"minchain/tracing"
+)
+
+var (
+	txLogger = logging.Logger(logging.Mempool)
+	txTracer = tracing.Tracer(logging.Mempool)
 )
 
 type ProcessTransactions struct {
@@ -13,15 +24,17 @@ type ProcessTransactions struct {
 	wallet    *core.Wallet
 	publisher p2p.Publisher
 	consumer  p2p.Consumer
+	reporter  p2p.Reporter
 	inputs    []lib.TransactionsInput
 }
 
-func NewProcessTransactionsService(mempool core.Mempool, wallet *core.Wallet, publisher p2p.Publisher, consumer p2p.Consumer, inputs []lib.TransactionsInput) *ProcessTransactions {
+func NewProcessTransactionsService(mempool core.Mempool, wallet *core.Wallet, publisher p2p.Publisher, consumer p2p.Consumer, reporter p2p.Reporter, inputs []lib.TransactionsInput) *ProcessTransactions {
 	return &ProcessTransactions{
 		wallet:    wallet,
 		mempool:   mempool,
 		publisher: publisher,
 		consumer:  consumer,
+		reporter:  reporter,
 		inputs:    inputs,
 	}
 }
@@ -34,27 +47,87 @@ func (p *ProcessTransactions) Start(ctx context.Context) {
 }
 
 func (p *ProcessTransactions) publishTransactionsToNetwork(ctx context.Context, input lib.TransactionsInput) {
-	for message := range input.InputChannel(ctx) {
-		tx, err := p.wallet.SignedTransaction(message)
+	for submission := range input.InputChannel(ctx) {
+		submission.Resolve(p.submit(submission.WithTrace(ctx), submission))
+	}
+}
+
+// submit gossips the transaction once the local mempool took it, rejected transactions aren't sent. Messages are
+// signed by the node's wallet, which is only there when node signing is on.
+func (p *ProcessTransactions) submit(ctx context.Context, submission *lib.Submission) lib.SubmitResult {
+	ctx, span := txTracer.Start(ctx, "tx.submit")
+	defer span.End()
+
+	tx := submission.Tx
+	if tx == nil {
+		if p.wallet == nil {
+			span.SetStatus(codes.Error, lib.ErrorNodeSigningDisabled.Error())
+			return lib.SubmitResult{Err: lib.ErrorNodeSigningDisabled}
+		}
+		signed, err := p.sign(ctx, submission.Message)
 		if err != nil {
-			log.Println("Error building transaction:", err)
-			return
+			txLogger.Error("Error building transaction", "err", err)
+			span.SetStatus(codes.Error, err.Error())
+			return lib.SubmitResult{Err: err}
 		}
+		tx = signed
+	}
 
-		if err := p.publisher.PublishTransaction(ctx, tx); err != nil {
-			log.Println("Publish error:", err)
-		}
+	hash, err := tx.Hash()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return lib.SubmitResult{Err: err}
+	}
+	span.SetAttributes(attribute.String("tx.hash", hash.Hex()))
+
+	if !core.IsValid(tx) {
+		span.SetStatus(codes.Error, core.ErrorInvalidTransaction.Error())
+		return lib.SubmitResult{Hash: hash, Reason: core.ErrorInvalidTransaction.Error()}
+	}
+	if err := p.mempool.ValidateAndStorePending(ctx, tx); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return lib.SubmitResult{Hash: hash, Reason: err.Error()}
+	}
+
+	if err := p.publisher.PublishTransaction(ctx, tx); err != nil {
+		txLogger.Warn("Error publishing transaction", "hash", hash, "err", err)
 	}
+	return lib.SubmitResult{Hash: hash, Accepted: true}
+}
+
+func (p *ProcessTransactions) sign(ctx context.Context, message string) (*types.Tx, error) {
+	_, span := txTracer.Start(ctx, "tx.sign")
+	defer span.End()
+	return p.wallet.SignedTransaction(message)
 }
 
 func (p *ProcessTransactions) consumeTransactionsFromNetwork(ctx context.Context) {
 	for {
-		tx, err := p.consumer.ConsumeTransaction(ctx)
-		log.Println("Received tx from the network: ", tx.PrettyPrint())
+		msgCtx, tx, err := p.consumer.ConsumeTransaction(ctx)
 		if err != nil {
-			log.Println("Error deserializing tx:", err)
+			txLogger.Info("Stopped consuming transactions", "err", err)
 			return
 		}
-		p.mempool.ValidateAndStorePending(tx)
+		p.receive(msgCtx, tx)
+	}
+}
+
+// receive admits a gossiped transaction, its span continues the trace of the node which published it
+func (p *ProcessTransactions) receive(ctx context.Context, tx *types.Tx) {
+	ctx, span := txTracer.Start(ctx, "tx.receive", trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+
+	err := p.mempool.ValidateAndStorePending(ctx, tx)
+	if err == nil {
+		return
+	}
+	hash, _ := tx.Hash()
+	span.SetStatus(codes.Error, err.Error())
+	if !errors.Is(err, core.ErrorInvalidTransaction) {
+		// e.g. already included, the peer may not have the block yet
+		txLogger.Info("Dropping transaction from the network", "hash", hash, "err", err)
+		return
 	}
+	txLogger.Warn("Rejected transaction from the network", "hash", hash, "err", err)
+	p.reporter.ReportInvalidTransaction(hash, err)
 }
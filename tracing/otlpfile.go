@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"sync"
+)
+
+// OTLP JSON wants enums as numbers and IDs in hex, where the protobuf JSON mapping has names and base64
+var (
+	marshalOptions = protojson.MarshalOptions{UseEnumNumbers: true}
+	idFields       = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+)
+
+// fileClient writes spans in the OTLP JSON file format, one export request per line, which collectors and trace
+// viewers can import. It's the transport of the OTLP exporter when there's no collector to send to.
+type fileClient struct {
+	lock   sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func newFileClient(w io.Writer, closer io.Closer) *fileClient {
+	return &fileClient{w: w, closer: closer}
+}
+
+func (c *fileClient) Start(context.Context) error {
+	return nil
+}
+
+func (c *fileClient) Stop(context.Context) error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+func (c *fileClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	line, err := marshalOTLP(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, err = c.w.Write(append(line, '\n'))
+	return err
+}
+
+func marshalOTLP(request *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	data, err := marshalOptions.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	if err := hexIDs(decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+func hexIDs(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if s, ok := field.(string); ok && idFields[key] {
+				id, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return err
+				}
+				v[key] = hex.EncodeToString(id)
+				continue
+			}
+			if err := hexIDs(field); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := hexIDs(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
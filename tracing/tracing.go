@@ -0,0 +1,81 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are exported with OTLP to stdout or a file, so traces can be
+// collected without a collector running next to the node.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+)
+
+const (
+	ExporterOff    = "off"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+const serviceName = "minchain"
+
+func init() {
+	// Trace context is passed on even when this node doesn't export spans itself
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Tracer returns the tracer of a subsystem. It can be created before Setup, spans are dropped until there's an
+// exporter.
+func Tracer(subsystem string) trace.Tracer {
+	return otel.Tracer(serviceName + "/" + subsystem)
+}
+
+// Setup installs the exporter, off, stdout or file, in which case spans are appended to path. The returned function
+// flushes the remaining spans.
+func Setup(ctx context.Context, exporter string, path string, nodeID string) (func(context.Context) error, error) {
+	var w io.Writer
+	var closer io.Closer
+	switch exporter {
+	case ExporterOff, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		w = os.Stdout
+	case ExporterFile:
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = file, file
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s or %s", exporter, ExporterOff, ExporterStdout, ExporterFile)
+	}
+
+	otlpExporter, err := otlptrace.New(ctx, newFileClient(w, closer))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(otlpExporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.instance.id", nodeID),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Inject adds the trace context of ctx to metadata, e.g. of a gossip message
+func Inject(ctx context.Context, metadata map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(metadata))
+}
+
+// Extract returns ctx with the trace context found in metadata, so spans started from it continue the sender's trace
+func Extract(ctx context.Context, metadata map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(metadata))
+}
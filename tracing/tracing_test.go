@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
+
+type exportRequest struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []exportedSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), ExporterFile, path, "node")
+	require.NoError(t, err)
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	tracer := Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	spans := make(map[string]exportedSpan)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var request exportRequest
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &request))
+		for _, resource := range request.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, spans, 2)
+
+	// OTLP JSON has hex IDs, not the base64 of the protobuf JSON mapping
+	require.Regexp(t, regexp.MustCompile("^[0-9a-f]{32}$"), spans["parent"].TraceID)
+	require.Regexp(t, regexp.MustCompile("^[0-9a-f]{16}$"), spans["parent"].SpanID)
+	require.Equal(t, parent.SpanContext().TraceID().String(), spans["parent"].TraceID)
+	require.Equal(t, spans["parent"].TraceID, spans["child"].TraceID)
+	require.Equal(t, spans["parent"].SpanID, spans["child"].ParentSpanID)
+}
+
+func TestSetupOff(t *testing.T) {
+	shutdown, err := Setup(context.Background(), ExporterOff, "", "node")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), "jaeger", "", "node")
+	require.Error(t, err)
+}
+
+func TestPropagation(t *testing.T) {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	metadata := make(map[string]string)
+	Inject(trace.ContextWithSpanContext(context.Background(), spanContext), metadata)
+	require.Contains(t, metadata, "traceparent")
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), metadata))
+	require.Equal(t, spanContext.TraceID(), extracted.TraceID())
+	require.Equal(t, spanContext.SpanID(), extracted.SpanID())
+	require.True(t, extracted.IsRemote())
+
+	empty := make(map[string]string)
+	Inject(context.Background(), empty)
+	require.Empty(t, empty)
+	require.False(t, trace.SpanContextFromContext(Extract(context.Background(), empty)).IsValid())
+}
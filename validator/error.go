@@ -6,4 +6,51 @@ var (
 	ErrorKnownBlock    = errors.New("block already known")
 	ErrorUnknownParent = errors.New("unknown parent")
 	IncorrectTxHash    = errors.New("incorrect transaction hash")
+	InvalidHeight      = errors.New("invalid block height")
+	InvalidTransaction = errors.New("invalid transaction")
+
+	ErrorReplayedTransaction = errors.New("transaction already included")
+
+	ErrorTimestampNotAfterParent = errors.New("block timestamp not after parent")
+	ErrorFutureTimestamp         = errors.New("block timestamp too far in the future")
+	ErrorTimestampOffSchedule    = errors.New("block timestamp not on the block time schedule")
 )
+
+// reasons are short, stable names for the validation errors, e.g. for metric labels. Invalid errors make a block
+// invalid whatever the local chain looks like, the others can be down to this node lagging behind or its clock.
+var reasons = []struct {
+	err     error
+	reason  string
+	invalid bool
+}{
+	{ErrorKnownBlock, "known", false},
+	{ErrorUnknownParent, "unknown_parent", false},
+	{IncorrectTxHash, "tx_hash", true},
+	{InvalidHeight, "height", true},
+	{InvalidTransaction, "invalid_transaction", true},
+	{ErrorTimestampNotAfterParent, "timestamp_not_after_parent", true},
+	{ErrorFutureTimestamp, "future_timestamp", false},
+	{ErrorTimestampOffSchedule, "timestamp_off_schedule", true},
+	{ErrorReplayedTransaction, "replayed_transaction", true},
+}
+
+// Reason names why a block failed validation, "other" for errors which aren't validation errors
+func Reason(err error) string {
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return "other"
+}
+
+// IsInvalid tells whether err proves the block is invalid on every node, so whoever relayed it misbehaved. Blocks
+// which are only unusable here, e.g. with an unknown parent, are no reason to penalise a peer.
+func IsInvalid(err error) bool {
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.invalid
+		}
+	}
+	return false
+}
@@ -1,29 +1,63 @@
 package validator
 
 import (
+	"context"
 	"fmt"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/pkg/errors"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"minchain/core"
 	"minchain/core/types"
 	"minchain/database"
+	"minchain/lib"
+	"minchain/logging"
+	"minchain/tracing"
+	"time"
 )
 
 type Validator interface {
-	Validate(block *types.Block) error
+	Validate(ctx context.Context, block *types.Block) error
 }
 
+// MaxClockDrift is how far ahead of the local clock a block timestamp may be
+const MaxClockDrift = 15 * time.Second
+
+var (
+	logger = logging.Logger(logging.Validator)
+	tracer = tracing.Tracer(logging.Validator)
+)
+
 type BlockValidator struct {
-	db database.Database
+	db        database.Database
+	blockTime time.Duration
+	clock     lib.Clock
 }
 
-func NewBlockValidator(db database.Database) *BlockValidator {
+func NewBlockValidator(db database.Database, blockTime time.Duration, clock lib.Clock) *BlockValidator {
 	return &BlockValidator{
-		db: db,
+		db:        db,
+		blockTime: blockTime,
+		clock:     clock,
+	}
+}
+
+func (v *BlockValidator) Validate(ctx context.Context, block *types.Block) error {
+	blockHash := block.BlockHash()
+	_, span := tracer.Start(ctx, "validator.validate")
+	span.SetAttributes(attribute.String("block.hash", blockHash.Hex()), attribute.Int64("block.height", block.Header.Height))
+	defer span.End()
+
+	err := v.validate(block)
+	if err != nil {
+		span.SetAttributes(attribute.String("reason", Reason(err)))
+		span.SetStatus(codes.Error, err.Error())
 	}
+	return err
 }
 
-func (v *BlockValidator) Validate(block *types.Block) error {
-	log.Println("Validating block", block.BlockHash().Hex())
+func (v *BlockValidator) validate(block *types.Block) error {
+	logger.Debug("Validating block", "hash", block.BlockHash())
 	blockHash := block.BlockHash()
 	foundBlock, err := v.db.GetBlockByHash(blockHash)
 	if err != nil && !errors.Is(err, database.ErrorBlockNotFound) {
@@ -34,7 +68,11 @@ func (v *BlockValidator) Validate(block *types.Block) error {
 		return errors.Wrap(ErrorKnownBlock, fmt.Sprintf("Block hash %s", blockHash.Hex()))
 	}
 
-	_, err = v.db.GetBlockByHash(block.Header.ParentHash)
+	if err := ValidateStateless(block); err != nil {
+		return err
+	}
+
+	parent, err := v.db.GetBlockByHash(block.Header.ParentHash)
 	if errors.Is(err, database.ErrorBlockNotFound) {
 		return ErrorUnknownParent
 	}
@@ -43,6 +81,107 @@ func (v *BlockValidator) Validate(block *types.Block) error {
 		return err
 	}
 
+	// Startup verification treats any other height as corruption, so such a block must never be imported
+	if block.Header.Height != parent.Header.Height+1 {
+		return errors.Wrap(InvalidHeight, fmt.Sprintf("Height %d, parent %d", block.Header.Height, parent.Header.Height))
+	}
+
+	if err := v.validateTimestamp(block, parent); err != nil {
+		return err
+	}
+
+	return v.validateReplays(block, parent)
+}
+
+// validateReplays rejects transactions which the chain ending in parent already includes. Signatures only cover the
+// data, so nothing else stops a signed transaction from being included again.
+func (v *BlockValidator) validateReplays(block *types.Block, parent *types.Block) error {
+	hashes := make(map[common.Hash]int, len(block.Transactions))
+	for i := range block.Transactions {
+		hash, err := block.Transactions[i].Hash()
+		if err != nil {
+			return err
+		}
+		if _, ok := hashes[hash]; ok {
+			return errors.Wrap(ErrorReplayedTransaction, fmt.Sprintf("Transaction %d included twice", i))
+		}
+		hashes[hash] = i
+	}
+
+	// The transaction index only covers the canonical chain, the blocks of a side chain are checked one by one down
+	// to where it forks off
+	ancestor := parent
+	for {
+		canonical, err := v.db.GetCanonicalHash(ancestor.Header.Height)
+		if err != nil && !errors.Is(err, database.ErrorBlockNotFound) {
+			return err
+		}
+		if err == nil && canonical == ancestor.BlockHash() {
+			break
+		}
+		for i := range ancestor.Transactions {
+			hash, err := ancestor.Transactions[i].Hash()
+			if err != nil {
+				return err
+			}
+			if index, ok := hashes[hash]; ok {
+				return errors.Wrap(ErrorReplayedTransaction, fmt.Sprintf("Transaction %d, included in %s", index, ancestor.BlockHash().Hex()))
+			}
+		}
+		if ancestor.Header.Height == 0 {
+			return nil
+		}
+		ancestor, err = v.db.GetBlockByHash(ancestor.Header.ParentHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	for hash, index := range hashes {
+		included, err := v.db.GetTransactionBlock(hash)
+		if errors.Is(err, database.ErrorTransactionNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		includedBlock, err := v.db.GetBlockByHash(included)
+		if err != nil {
+			return err
+		}
+		// Canonical blocks above the fork point aren't on the block's chain
+		if includedBlock.Header.Height <= ancestor.Header.Height {
+			return errors.Wrap(ErrorReplayedTransaction, fmt.Sprintf("Transaction %d, included in %s", index, included.Hex()))
+		}
+	}
+	return nil
+}
+
+// validateTimestamp checks the block comes after its parent, isn't from the future and falls on a PoA slot
+func (v *BlockValidator) validateTimestamp(block *types.Block, parent *types.Block) error {
+	timestamp := block.Header.Timestamp
+	if timestamp <= parent.Header.Timestamp {
+		return errors.Wrap(ErrorTimestampNotAfterParent, fmt.Sprintf("Timestamp %d, parent %d", timestamp, parent.Header.Timestamp))
+	}
+
+	if latest := v.clock.Now().Add(MaxClockDrift).UnixMilli(); timestamp > latest {
+		return errors.Wrap(ErrorFutureTimestamp, fmt.Sprintf("Timestamp %d, latest allowed %d", timestamp, latest))
+	}
+
+	if slot := v.blockTime.Milliseconds(); slot > 0 && (timestamp-parent.Header.Timestamp)%slot != 0 {
+		return errors.Wrap(ErrorTimestampOffSchedule, fmt.Sprintf("Timestamp %d, parent %d, block time %s", timestamp, parent.Header.Timestamp, v.blockTime))
+	}
+
+	return nil
+}
+
+// ValidateStateless runs the checks which don't need the chain, so they can be done before a block is relayed
+func ValidateStateless(block *types.Block) error {
+	// Genesis is never gossiped
+	if block.Header.Height < 1 {
+		return InvalidHeight
+	}
+
 	hash, err := types.CombinedHash(block.Transactions)
 	if err != nil {
 		return err
@@ -52,5 +191,11 @@ func (v *BlockValidator) Validate(block *types.Block) error {
 		return IncorrectTxHash
 	}
 
+	for i := range block.Transactions {
+		if !core.IsValid(&block.Transactions[i]) {
+			return errors.Wrap(InvalidTransaction, fmt.Sprintf("Transaction %d", i))
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,106 @@
+package validator
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"minchain/core/chaintest"
+	"minchain/core/types"
+	"minchain/database"
+	"minchain/genesis"
+	"minchain/lib"
+	"testing"
+	"time"
+)
+
+func TestValidateTimestamp(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	parent := genesis.Default().Block()
+	require.NoError(t, db.PutBlock(parent))
+
+	clock := lib.NewManualClock(time.UnixMilli(parent.Header.Timestamp).Add(time.Minute))
+	validator := NewBlockValidator(db, 5*time.Second, clock)
+	after := func(d time.Duration) int64 { return parent.Header.Timestamp + d.Milliseconds() }
+
+	require.NoError(t, validator.Validate(context.Background(), childBlock(t, parent, after(5*time.Second))))
+	// Skipped slots are fine
+	require.NoError(t, validator.Validate(context.Background(), childBlock(t, parent, after(time.Minute))))
+
+	require.ErrorIs(t, validator.Validate(context.Background(), childBlock(t, parent, parent.Header.Timestamp)), ErrorTimestampNotAfterParent)
+	require.ErrorIs(t, validator.Validate(context.Background(), childBlock(t, parent, after(7*time.Second))), ErrorTimestampOffSchedule)
+	require.ErrorIs(t, validator.Validate(context.Background(), childBlock(t, parent, after(time.Minute+MaxClockDrift+5*time.Second))), ErrorFutureTimestamp)
+
+	// A block from the future becomes valid once the local clock catches up
+	clock.Advance(MaxClockDrift)
+	require.NoError(t, validator.Validate(context.Background(), childBlock(t, parent, after(time.Minute+MaxClockDrift+5*time.Second))))
+}
+
+func TestValidateHeight(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	parent := genesis.Default().Block()
+	require.NoError(t, db.PutBlock(parent))
+
+	clock := lib.NewManualClock(time.UnixMilli(parent.Header.Timestamp).Add(time.Minute))
+	validator := NewBlockValidator(db, 5*time.Second, clock)
+	timestamp := parent.Header.Timestamp + (5 * time.Second).Milliseconds()
+
+	block := childBlock(t, parent, timestamp)
+	require.NoError(t, validator.Validate(context.Background(), block))
+
+	for _, height := range []int64{parent.Header.Height + 2, parent.Header.Height + 10} {
+		block.Header.Height = height
+		require.ErrorIs(t, validator.Validate(context.Background(), block), InvalidHeight)
+	}
+}
+
+func TestValidateReplays(t *testing.T) {
+	db := database.NewMemoryDatabase()
+	genesisBlock := genesis.Default().Block()
+	require.NoError(t, db.PutBlock(genesisBlock))
+
+	clock := lib.NewManualClock(time.UnixMilli(genesisBlock.Header.Timestamp).Add(time.Hour))
+	validator := NewBlockValidator(db, 5*time.Second, clock)
+	next := func(parent *types.Block, txs ...types.Tx) *types.Block {
+		return chaintest.Block(t, parent, parent.Header.Timestamp+(5*time.Second).Milliseconds(), txs...)
+	}
+	hello := *chaintest.Tx(t, "hello")
+	other := *chaintest.Tx(t, "other")
+
+	first := next(genesisBlock, hello)
+	require.NoError(t, validator.Validate(context.Background(), first))
+	require.NoError(t, db.PutBlock(first))
+	require.NoError(t, db.SetHead(first.BlockHash()))
+
+	require.ErrorIs(t, validator.Validate(context.Background(), next(first, other, other)), ErrorReplayedTransaction)
+	// Found through the transaction index
+	require.ErrorIs(t, validator.Validate(context.Background(), next(first, other, hello)), ErrorReplayedTransaction)
+
+	// A side chain may include what the canonical chain did, but not twice itself
+	fork := next(genesisBlock, other, hello)
+	fork.Header.Timestamp += (5 * time.Second).Milliseconds()
+	require.NoError(t, validator.Validate(context.Background(), fork))
+	require.NoError(t, db.PutBlock(fork))
+	require.ErrorIs(t, validator.Validate(context.Background(), next(fork, other)), ErrorReplayedTransaction)
+	require.NoError(t, validator.Validate(context.Background(), next(fork, *chaintest.Tx(t, "third"))))
+}
+
+func childBlock(t *testing.T, parent *types.Block, timestamp int64) *types.Block {
+	return chaintest.Block(t, parent, timestamp, *chaintest.Tx(t, "hello"))
+}
+
+func TestReason(t *testing.T) {
+	require.Equal(t, "known", Reason(errors.Wrap(ErrorKnownBlock, "Block hash")))
+	require.Equal(t, "unknown_parent", Reason(ErrorUnknownParent))
+	require.Equal(t, "future_timestamp", Reason(errors.Wrap(ErrorFutureTimestamp, "Timestamp")))
+	require.Equal(t, "other", Reason(database.ErrorCorruptedBlock))
+}
+
+func TestIsInvalid(t *testing.T) {
+	require.True(t, IsInvalid(IncorrectTxHash))
+	require.True(t, IsInvalid(errors.Wrap(InvalidHeight, "Height")))
+	require.True(t, IsInvalid(errors.Wrap(ErrorTimestampOffSchedule, "Timestamp")))
+	require.False(t, IsInvalid(ErrorUnknownParent))
+	require.False(t, IsInvalid(errors.Wrap(ErrorFutureTimestamp, "Timestamp")))
+	require.False(t, IsInvalid(errors.Wrap(ErrorKnownBlock, "Block hash")))
+	require.False(t, IsInvalid(database.ErrorCorruptedBlock))
+}